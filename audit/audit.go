@@ -0,0 +1,280 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"reflect"
+	"regexp"
+	"time"
+
+	"github.com/Arkariza/API_MyActivity/events"
+	database "github.com/Arkariza/API_MyActivity/models"
+	models "github.com/Arkariza/API_MyActivity/models/Audit"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	Created = models.ActionCreated
+	Updated = models.ActionUpdated
+	Deleted = models.ActionDeleted
+
+	EntityLead           = events.EntityLead
+	EntityCall           = events.EntityCall
+	EntityMeet           = events.EntityMeet
+	EntityComment        = events.EntityComment
+	EntityAttachment     = events.EntityAttachment
+	EntityLeadImport     = events.EntityLeadImport
+	EntityTask           = "task"
+	EntityTarget         = "target"
+	EntityCommission     = "commission"
+	EntityCommissionRule = "commission_rule"
+	EntityUser           = "user"
+
+	RequestIDHeader = "X-Request-ID"
+	requestIDKey    = "requestID"
+)
+
+// Entities lists what the audit log records, for validating filters.
+var Entities = []string{
+	EntityLead, EntityCall, EntityMeet, EntityComment, EntityAttachment, EntityLeadImport,
+	EntityTask, EntityTarget, EntityCommission, EntityCommissionRule, EntityUser,
+}
+
+// redacted fields are recorded as changed without their values.
+var redacted = map[string]bool{
+	"password":      true,
+	"device_tokens": true,
+}
+
+const redactedValue = "[redacted]"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Log appends entries to the audit collection. Nothing in the API updates or
+// deletes them.
+type Log struct {
+	collection *mongo.Collection
+}
+
+func NewLog(collection *mongo.Collection) *Log {
+	return &Log{collection: collection}
+}
+
+// Default is the log Record writes to. Until it is set, mutations are not
+// audited.
+var Default *Log
+
+// Source is who made a mutation and through which request. It is captured
+// from the request so that work finishing after the response, such as a lead
+// import, is attributed correctly.
+type Source struct {
+	ActorID   *primitive.ObjectID
+	ActorRole int
+	IP        string
+	RequestID string
+	Method    string
+	Path      string
+}
+
+func SourceOf(c *gin.Context) Source {
+	source := Source{
+		IP:        c.ClientIP(),
+		RequestID: RequestID(c),
+		Method:    c.Request.Method,
+		Path:      c.FullPath(),
+	}
+	source.ActorID, source.ActorRole = Actor(c)
+	return source
+}
+
+// Record audits a mutation made by the current request on the default log.
+// before is nil for created entities and after for deleted ones.
+func Record(c *gin.Context, entity, action string, entityID primitive.ObjectID, before, after interface{}) {
+	RecordFrom(SourceOf(c), entity, action, entityID, before, after)
+}
+
+// RecordFrom audits a mutation on the default log.
+func RecordFrom(source Source, entity, action string, entityID primitive.ObjectID, before, after interface{}) {
+	if Default == nil {
+		return
+	}
+	Default.Record(source, entity, action, entityID, before, after)
+}
+
+// RecordCreated audits a batch of created entities on the default log in one
+// write. ids and docs are parallel.
+func RecordCreated(source Source, entity string, ids []primitive.ObjectID, docs []interface{}) {
+	if Default == nil {
+		return
+	}
+	Default.RecordCreated(source, entity, ids, docs)
+}
+
+// Record writes the entry synchronously so that a successful response means
+// the change was audited. A failure is logged rather than failing a request
+// whose change is already saved.
+func (l *Log) Record(source Source, entity, action string, entityID primitive.ObjectID, before, after interface{}) {
+	entry, ok := newEntry(source, entity, action, entityID, before, after)
+	if !ok {
+		return
+	}
+	// The change is already made, so the entry is written even if the client
+	// has gone away.
+	ctx, cancel := database.QueryContext(context.Background())
+	defer cancel()
+	if _, err := l.collection.InsertOne(ctx, entry); err != nil {
+		log.Printf("Error writing audit entry for %s %s %s (request %s): %v", entity, action, entityID.Hex(), source.RequestID, err)
+	}
+}
+
+func (l *Log) RecordCreated(source Source, entity string, ids []primitive.ObjectID, docs []interface{}) {
+	entries := make([]interface{}, 0, len(ids))
+	for i, id := range ids {
+		if entry, ok := newEntry(source, entity, Created, id, nil, docs[i]); ok {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		return
+	}
+	ctx, cancel := database.QueryContext(context.Background())
+	defer cancel()
+	if _, err := l.collection.InsertMany(ctx, entries, options.InsertMany().SetOrdered(false)); err != nil {
+		log.Printf("Error writing %d audit entries for created %s (request %s): %v", len(entries), entity, source.RequestID, err)
+	}
+}
+
+func newEntry(source Source, entity, action string, entityID primitive.ObjectID, before, after interface{}) (models.Entry, bool) {
+	changes, err := Diff(before, after)
+	if err != nil {
+		log.Printf("Error diffing %s %s for the audit log: %v", entity, entityID.Hex(), err)
+		return models.Entry{}, false
+	}
+	if action == Updated && len(changes) == 0 {
+		return models.Entry{}, false
+	}
+	return models.Entry{
+		ID:        primitive.NewObjectID(),
+		ActorID:   source.ActorID,
+		ActorRole: source.ActorRole,
+		Action:    action,
+		Entity:    entity,
+		EntityID:  entityID,
+		Changes:   changes,
+		IP:        source.IP,
+		RequestID: source.RequestID,
+		Method:    source.Method,
+		Path:      source.Path,
+		Time:      time.Now(),
+	}, true
+}
+
+// Actor reads the caller from whichever authentication middleware ran.
+func Actor(c *gin.Context) (*primitive.ObjectID, int) {
+	var id *primitive.ObjectID
+	switch value := firstSet(c, "userID", "UserID", "user_id").(type) {
+	case primitive.ObjectID:
+		id = &value
+	case string:
+		if parsed, err := primitive.ObjectIDFromHex(value); err == nil {
+			id = &parsed
+		}
+	}
+	role, _ := firstSet(c, "userRole", "Role", "role").(int)
+	return id, role
+}
+
+func firstSet(c *gin.Context, keys ...string) interface{} {
+	for _, key := range keys {
+		if value, ok := c.Get(key); ok {
+			return value
+		}
+	}
+	return nil
+}
+
+// Diff compares the stored form of two versions of an entity field by field.
+// Either may be nil.
+func Diff(before, after interface{}) (map[string]models.Change, error) {
+	prev, err := document(before)
+	if err != nil {
+		return nil, err
+	}
+	next, err := document(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]models.Change{}
+	for field, value := range next {
+		if previous, ok := prev[field]; ok && reflect.DeepEqual(previous, value) {
+			continue
+		}
+		changes[field] = models.Change{Before: prev[field], After: value}
+	}
+	for field, value := range prev {
+		if _, ok := next[field]; !ok {
+			changes[field] = models.Change{Before: value}
+		}
+	}
+	delete(changes, "_id")
+	for field, change := range changes {
+		if redacted[field] {
+			if change.Before != nil {
+				change.Before = redactedValue
+			}
+			if change.After != nil {
+				change.After = redactedValue
+			}
+			changes[field] = change
+		}
+	}
+	return changes, nil
+}
+
+func document(value interface{}) (bson.M, error) {
+	if value == nil || reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil() {
+		return bson.M{}, nil
+	}
+	raw, err := bson.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	err = bson.Unmarshal(raw, &doc)
+	return doc, err
+}
+
+// RequestIDMiddleware tags each request with an ID, taken from the
+// X-Request-ID header when the caller sent a usable one, and echoes it in
+// the response so that a report can be matched to its audit entries.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// RequestID returns the ID RequestIDMiddleware gave the request.
+func RequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return primitive.NewObjectID().Hex()
+	}
+	return hex.EncodeToString(b)
+}
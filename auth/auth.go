@@ -102,6 +102,7 @@ func (c *AuthCommand) Register(ctx context.Context, req RegisterRequest) (*model
 	}
 
 	user := models.User{
+		ID:        primitive.NewObjectID(),
 		Username:  req.Username,
 		Email:     req.Email,
 		Password:  string(hashedPassword),
@@ -118,6 +119,24 @@ func (c *AuthCommand) Register(ctx context.Context, req RegisterRequest) (*model
 	return &user, nil
 }
 
+// AssignTeam moves the user into team, or out of any team when team is empty,
+// and returns the user as they were before and after. It returns
+// mongo.ErrNoDocuments when there is no such user.
+func (c *AuthCommand) AssignTeam(ctx context.Context, userID primitive.ObjectID, team string) (*models.User, *models.User, error) {
+	update := bson.M{"$set": bson.M{"team": team}}
+	if team == "" {
+		update = bson.M{"$unset": bson.M{"team": ""}}
+	}
+
+	var before models.User
+	if err := c.collection.FindOneAndUpdate(ctx, bson.M{"_id": userID}, update).Decode(&before); err != nil {
+		return nil, nil, err
+	}
+	after := before
+	after.Team = team
+	return &before, &after, nil
+}
+
 func (c *AuthCommand) generateToken(user models.User) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id":  user.ID.Hex(),
@@ -155,14 +174,14 @@ func (c *AuthCommand) ValidateToken(tokenString string) (jwt.MapClaims, error) {
 	return claims, nil
 }
 
-func (c *AuthCommand) GetUserFromToken(claims jwt.MapClaims) (*models.User, error) {
+func (c *AuthCommand) GetUserFromToken(ctx context.Context, claims jwt.MapClaims) (*models.User, error) {
 	userID, err := primitive.ObjectIDFromHex(claims["user_id"].(string))
 	if err != nil {
 		return nil, err
 	}
 
 	var user models.User
-	if err := c.collection.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user); err != nil {
+	if err := c.collection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
 		return nil, err
 	}
 
@@ -5,6 +5,8 @@ import (
     "strings"
     "github.com/gin-gonic/gin"
     "github.com/Arkariza/API_MyActivity/auth"
+    database "github.com/Arkariza/API_MyActivity/models"
+    "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func AuthMiddleware(authCommand *auth.AuthCommand) gin.HandlerFunc {
@@ -40,7 +42,10 @@ func AuthMiddleware(authCommand *auth.AuthCommand) gin.HandlerFunc {
             return
         }
 
-        user, err := authCommand.GetUserFromToken(claims)
+        queryCtx, cancel := database.QueryContext(ctx.Request.Context())
+        defer cancel()
+
+        user, err := authCommand.GetUserFromToken(queryCtx, claims)
         if err != nil {
             ctx.JSON(http.StatusUnauthorized, gin.H{
                 "status":  false,
@@ -95,4 +100,14 @@ func AuthenticateUser(authCommand *auth.AuthCommand) gin.HandlerFunc {
         ctx.Set("claims", claims) 
         ctx.Next()
     }
-}
\ No newline at end of file
+}
+// CurrentUser returns the ID and role AuthMiddleware stored for the caller.
+// When there is none it answers 401 and returns false.
+func CurrentUser(ctx *gin.Context) (primitive.ObjectID, int, bool) {
+    userID, ok := ctx.Value("userID").(primitive.ObjectID)
+    if !ok {
+        ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+        return primitive.NilObjectID, 0, false
+    }
+    return userID, ctx.GetInt("userRole"), true
+}
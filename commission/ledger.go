@@ -0,0 +1,177 @@
+package commission
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	models "github.com/Arkariza/API_MyActivity/models/Commission"
+	leadModels "github.com/Arkariza/API_MyActivity/models/ManageLead"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrNoRule     = errors.New("no active commission rule applies")
+	ErrBothEarned = errors.New("both leads have a commission")
+)
+
+// Ledger accrues and cancels referral commissions as leads are won or
+// reopened. Approval and payment are left to the commission endpoints.
+type Ledger struct {
+	rules       *mongo.Collection
+	commissions *mongo.Collection
+}
+
+func NewLedger(rules, commissions *mongo.Collection) *Ledger {
+	return &Ledger{rules: rules, commissions: commissions}
+}
+
+// Rule returns the rule in force at the given time for a premium: the active
+// rule with the highest minimum premium reached, and of those the latest.
+func (l *Ledger) Rule(ctx context.Context, premium float64, at time.Time) (*models.Rule, error) {
+	var rule models.Rule
+	err := l.rules.FindOne(ctx,
+		bson.M{
+			"active":         true,
+			"effective_from": bson.M{"$lte": at},
+			"min_premium":    bson.M{"$lte": premium},
+		},
+		options.FindOne().SetSort(bson.D{{Key: "min_premium", Value: -1}, {Key: "effective_from", Value: -1}}),
+	).Decode(&rule)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoRule
+	}
+	return &rule, err
+}
+
+// Accrue records the referrer's commission on a won lead. A lead earns at
+// most one commission: calling Accrue again returns the existing one, unless
+// it was cancelled, in which case it is accrued afresh under today's rule.
+// The boolean reports whether anything was accrued by this call, and replaced
+// is the cancelled commission it took the place of, if any.
+func (l *Ledger) Accrue(ctx context.Context, lead leadModels.Lead) (earned *models.Commission, replaced *models.Commission, accrued bool, err error) {
+	if lead.ReferrerID == nil || lead.Status != leadModels.StatusWin {
+		return nil, nil, false, nil
+	}
+
+	var existing models.Commission
+	err = l.commissions.FindOne(ctx, bson.M{"lead_id": lead.ID}).Decode(&existing)
+	if err == nil && existing.Status != models.StatusCancelled {
+		return &existing, nil, false, nil
+	} else if err != nil && err != mongo.ErrNoDocuments {
+		return nil, nil, false, err
+	}
+
+	now := time.Now()
+	rule, err := l.Rule(ctx, lead.Premium, now)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	commission := models.Commission{
+		ID:         existing.ID,
+		LeadID:     lead.ID,
+		ClientName: lead.ClientName,
+		ReferrerID: *lead.ReferrerID,
+		RuleID:     rule.ID,
+		RuleKind:   rule.Kind,
+		RuleValue:  rule.Value,
+		Premium:    lead.Premium,
+		Amount:     rule.AmountFor(lead.Premium),
+		Status:     models.StatusAccrued,
+		AccruedAt:  now,
+	}
+
+	if !existing.ID.IsZero() {
+		// Only a cancelled commission may be accrued again.
+		result, err := l.commissions.ReplaceOne(ctx,
+			bson.M{"_id": existing.ID, "status": models.StatusCancelled}, commission)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if result.ModifiedCount == 0 {
+			return &commission, nil, false, nil
+		}
+		return &commission, &existing, true, nil
+	}
+
+	commission.ID = primitive.NewObjectID()
+	if _, err := l.commissions.InsertOne(ctx, commission); mongo.IsDuplicateKeyError(err) {
+		// Accrued concurrently by another request.
+		err = l.commissions.FindOne(ctx, bson.M{"lead_id": lead.ID}).Decode(&existing)
+		return &existing, nil, false, err
+	} else if err != nil {
+		return nil, nil, false, err
+	}
+	return &commission, nil, true, nil
+}
+
+// Cancel withdraws the commission of a lead that is no longer won, as long
+// as it has not been approved yet. It returns the commission before and after
+// cancelling, or nils when there was nothing to cancel.
+func (l *Ledger) Cancel(ctx context.Context, leadID primitive.ObjectID) (before, after *models.Commission, err error) {
+	now := time.Now()
+	var previous models.Commission
+	err = l.commissions.FindOneAndUpdate(ctx,
+		bson.M{"lead_id": leadID, "status": models.StatusAccrued},
+		bson.M{"$set": bson.M{"status": models.StatusCancelled, "cancelled_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	cancelled := previous
+	cancelled.Status = models.StatusCancelled
+	cancelled.CancelledAt = &now
+	return &previous, &cancelled, nil
+}
+
+// Move hands the commission of a lead merged away to the lead it was merged
+// into. A lead earns at most one commission, so when both leads have one the
+// cancelled one is dropped, and if neither is cancelled Move fails with
+// ErrBothEarned. It returns the commission that was dropped, if any.
+func (l *Ledger) Move(ctx context.Context, from, to primitive.ObjectID) (dropped *models.Commission, err error) {
+	var moving models.Commission
+	err = l.commissions.FindOne(ctx, bson.M{"lead_id": from}).Decode(&moving)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var kept models.Commission
+	err = l.commissions.FindOne(ctx, bson.M{"lead_id": to}).Decode(&kept)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	if err == nil {
+		switch {
+		case kept.Status == models.StatusCancelled:
+			dropped = &kept
+		case moving.Status == models.StatusCancelled:
+			dropped = &moving
+		default:
+			return nil, ErrBothEarned
+		}
+		// Filtered on the status so that a commission accrued again in the
+		// meantime is kept; the move then fails on the lead_id index below.
+		if _, err := l.commissions.DeleteOne(ctx, bson.M{"_id": dropped.ID, "status": models.StatusCancelled}); err != nil {
+			return nil, err
+		}
+		if dropped == &moving {
+			return dropped, nil
+		}
+	}
+
+	_, err = l.commissions.UpdateOne(ctx, bson.M{"_id": moving.ID}, bson.M{"$set": bson.M{"lead_id": to}})
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrBothEarned
+	} else if err != nil {
+		return nil, err
+	}
+	return dropped, nil
+}
@@ -0,0 +1,100 @@
+package commission
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	models "github.com/Arkariza/API_MyActivity/models/Commission"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestMove(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	from, to := primitive.NewObjectID(), primitive.NewObjectID()
+	movingID, keptID := primitive.NewObjectID(), primitive.NewObjectID()
+	found := func(id, leadID primitive.ObjectID, status string) bson.D {
+		return mtest.CreateCursorResponse(0, "db.commissions", mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: id}, {Key: "lead_id", Value: leadID}, {Key: "status", Value: status}})
+	}
+	none := mtest.CreateCursorResponse(0, "db.commissions", mtest.FirstBatch)
+	written := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+	duplicateKey := mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"})
+
+	tests := []struct {
+		name        string
+		responses   []bson.D
+		wantDropped primitive.ObjectID
+		wantErr     error
+		wantMoved   bool
+	}{
+		{
+			name:      "duplicate without a commission",
+			responses: []bson.D{none},
+		},
+		{
+			name:      "only the duplicate has a commission",
+			responses: []bson.D{found(movingID, from, models.StatusAccrued), none, written},
+			wantMoved: true,
+		},
+		{
+			name:      "both commissions are live",
+			responses: []bson.D{found(movingID, from, models.StatusAccrued), found(keptID, to, models.StatusPaid)},
+			wantErr:   ErrBothEarned,
+		},
+		{
+			name:        "the kept lead's commission is cancelled",
+			responses:   []bson.D{found(movingID, from, models.StatusApproved), found(keptID, to, models.StatusCancelled), written, written},
+			wantDropped: keptID,
+			wantMoved:   true,
+		},
+		{
+			name:        "the duplicate's commission is cancelled",
+			responses:   []bson.D{found(movingID, from, models.StatusCancelled), found(keptID, to, models.StatusAccrued), written},
+			wantDropped: movingID,
+		},
+		{
+			name:      "accrued concurrently on the kept lead",
+			responses: []bson.D{found(movingID, from, models.StatusAccrued), none, duplicateKey},
+			wantErr:   ErrBothEarned,
+			wantMoved: true,
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.responses...)
+			ledger := NewLedger(mt.DB.Collection("commission_rules"), mt.Coll)
+
+			dropped, err := ledger.Move(context.Background(), from, to)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Move() error = %v, want %v", err, tt.wantErr)
+			}
+			var droppedID primitive.ObjectID
+			if dropped != nil {
+				droppedID = dropped.ID
+			}
+			if droppedID != tt.wantDropped {
+				t.Fatalf("Move() dropped %s, want %s", droppedID.Hex(), tt.wantDropped.Hex())
+			}
+
+			var moved bool
+			for _, event := range mt.GetAllStartedEvents() {
+				if event.CommandName != "update" {
+					continue
+				}
+				update, _ := event.Command.Lookup("updates").Array().IndexErr(0)
+				id, _ := update.Value().Document().Lookup("q", "_id").ObjectIDOK()
+				leadID, _ := update.Value().Document().Lookup("u", "$set", "lead_id").ObjectIDOK()
+				if id == movingID && leadID == to {
+					moved = true
+				}
+			}
+			if moved != tt.wantMoved {
+				t.Fatalf("commission moved = %v, want %v", moved, tt.wantMoved)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package AnalyticsControllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	database "github.com/Arkariza/API_MyActivity/models"
+	userModels "github.com/Arkariza/API_MyActivity/models/User"
+	"github.com/Arkariza/API_MyActivity/respond"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// reportTimeZone is where periods start and end: a "day" is a Jakarta day.
+const reportTimeZone = "Asia/Jakarta"
+
+// periodUnits are the $dateTrunc units a report can be grouped by.
+var periodUnits = map[string]bool{"day": true, "week": true, "month": true, "quarter": true, "year": true}
+
+type AnalyticsController struct {
+	leads    *mongo.Collection
+	calls    *mongo.Collection
+	meets    *mongo.Collection
+	users    *mongo.Collection
+	location *time.Location
+
+	leaderboards leaderboardCache
+}
+
+func NewAnalyticsController(leads, calls, meets, users *mongo.Collection) *AnalyticsController {
+	location, err := time.LoadLocation(reportTimeZone)
+	if err != nil {
+		location = time.UTC
+	}
+	return &AnalyticsController{
+		leads:    leads,
+		calls:    calls,
+		meets:    meets,
+		users:    users,
+		location: location,
+	}
+}
+
+// dateRange reads the from and to query values as Jakarta dates. Both are
+// inclusive; to is returned as the start of the following day.
+func (ac *AnalyticsController) dateRange(c *gin.Context) (from, to time.Time, err error) {
+	if raw := c.Query("from"); raw != "" {
+		if from, err = time.ParseInLocation("2006-01-02", raw, ac.location); err != nil {
+			return from, to, fmt.Errorf("invalid from date %q, expected YYYY-MM-DD", raw)
+		}
+	}
+	if raw := c.Query("to"); raw != "" {
+		if to, err = time.ParseInLocation("2006-01-02", raw, ac.location); err != nil {
+			return from, to, fmt.Errorf("invalid to date %q, expected YYYY-MM-DD", raw)
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return from, to, fmt.Errorf("from must not be after to")
+	}
+	return from, to, nil
+}
+
+// dateFilter matches from <= field < to, skipping whichever bound is unset.
+func dateFilter(from, to time.Time) bson.M {
+	filter := bson.M{}
+	if !from.IsZero() {
+		filter["$gte"] = from
+	}
+	if !to.IsZero() {
+		filter["$lt"] = to
+	}
+	return filter
+}
+
+// reportScope is what a report covers: whose activity, as a user_id
+// condition where nil means everyone, between from and to.
+type reportScope struct {
+	owner interface{}
+	from  time.Time
+	to    time.Time
+}
+
+// match adds the scope to a filter on the given date field.
+func (s reportScope) match(filter bson.M, dateField string) bson.M {
+	if s.owner != nil {
+		filter["user_id"] = s.owner
+	}
+	if dates := dateFilter(s.from, s.to); len(dates) > 0 {
+		filter[dateField] = dates
+	}
+	return filter
+}
+
+// scope reads the from, to, bfa and team query values. Staff may filter by
+// BFA or team; everyone else only ever sees their own activity. It writes
+// the error response itself and reports whether the handler may go on.
+func (ac *AnalyticsController) scope(ctx context.Context, c *gin.Context, userID primitive.ObjectID, role int) (reportScope, bool) {
+	var scope reportScope
+	var err error
+	if scope.from, scope.to, err = ac.dateRange(c); err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid date range", err)
+		return scope, false
+	}
+	if role != userModels.RoleStaff {
+		scope.owner = userID
+		return scope, true
+	}
+
+	var bfa primitive.ObjectID
+	if raw := c.Query("bfa"); raw != "" {
+		if bfa, err = primitive.ObjectIDFromHex(raw); err != nil {
+			respond.Error(c, http.StatusBadRequest, "Invalid bfa ID", err)
+			return scope, false
+		}
+		scope.owner = bfa
+	}
+	if team := strings.TrimSpace(c.Query("team")); team != "" {
+		filter := bson.M{"team": team}
+		if !bfa.IsZero() {
+			filter["_id"] = bfa
+		}
+		members, err := ac.teamMembers(ctx, filter)
+		if err != nil {
+			respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to load team members", err)
+			return scope, false
+		}
+		scope.owner = bson.M{"$in": members}
+	}
+	return scope, true
+}
+
+func (ac *AnalyticsController) teamMembers(ctx context.Context, filter bson.M) ([]primitive.ObjectID, error) {
+	cursor, err := ac.users.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	members := []primitive.ObjectID{}
+	for cursor.Next(ctx) {
+		var user struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&user); err != nil {
+			return nil, err
+		}
+		members = append(members, user.ID)
+	}
+	return members, cursor.Err()
+}
+
+// rate divides without failing on empty stages.
+func rate(part, whole int64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole)
+}
@@ -0,0 +1,154 @@
+package AnalyticsControllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Arkariza/API_MyActivity/auth/middleware"
+	database "github.com/Arkariza/API_MyActivity/models"
+	callModels "github.com/Arkariza/API_MyActivity/models/CallAndMeet"
+	leadModels "github.com/Arkariza/API_MyActivity/models/ManageLead"
+	"github.com/Arkariza/API_MyActivity/respond"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// FunnelCounts counts the leads created in a period that reached each stage:
+// at least one call logged, at least one completed meet, and the outcome.
+type FunnelCounts struct {
+	Leads  int64 `bson:"leads" json:"leads"`
+	Called int64 `bson:"called" json:"called"`
+	Met    int64 `bson:"met" json:"met"`
+	Won    int64 `bson:"won" json:"won"`
+	Lost   int64 `bson:"lost" json:"lost"`
+}
+
+// FunnelRates are the conversions between consecutive stages. WinRate only
+// counts decided leads, so leads still open do not drag it down.
+type FunnelRates struct {
+	LeadToCall float64 `json:"lead_to_call"`
+	CallToMeet float64 `json:"call_to_meet"`
+	WinRate    float64 `json:"win_rate"`
+	LeadToWin  float64 `json:"lead_to_win"`
+}
+
+type FunnelPeriod struct {
+	Start        time.Time `bson:"_id" json:"start"`
+	FunnelCounts `bson:",inline"`
+	Rates        FunnelRates `bson:"-" json:"rates"`
+}
+
+type FunnelReport struct {
+	Period  string         `json:"period"`
+	Totals  FunnelCounts   `json:"totals"`
+	Rates   FunnelRates    `json:"rates"`
+	Periods []FunnelPeriod `json:"periods"`
+}
+
+func (f FunnelCounts) rates() FunnelRates {
+	return FunnelRates{
+		LeadToCall: rate(f.Called, f.Leads),
+		CallToMeet: rate(f.Met, f.Called),
+		WinRate:    rate(f.Won, f.Won+f.Lost),
+		LeadToWin:  rate(f.Won, f.Leads),
+	}
+}
+
+// reached is 1 for a lead whose lookup into field found anything.
+func reached(field string) bson.M {
+	return bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{bson.M{"$size": field}, 0}}, 1, 0}}
+}
+
+func hasStatus(status string) bson.M {
+	return bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", status}}, 1, 0}}
+}
+
+// Funnel follows the leads created in each period through calls and meets to
+// their outcome. Calls and meets count towards a lead through their lead_id.
+func (ac *AnalyticsController) Funnel(c *gin.Context) {
+	userID, role, ok := AuthMiddleware.CurrentUser(c)
+	if !ok {
+		return
+	}
+	period := c.DefaultQuery("period", "month")
+	if !periodUnits[period] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid period, expected day, week, month, quarter or year"})
+		return
+	}
+	typeLead := c.Query("type_lead")
+	if typeLead != "" && typeLead != leadModels.TypeReferral && typeLead != leadModels.TypeSelf {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid type_lead, expected Reff or Self"})
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	scope, ok := ac.scope(ctx, c, userID, role)
+	if !ok {
+		return
+	}
+	match := scope.match(bson.M{}, "created_at")
+	if typeLead != "" {
+		match["type_lead"] = typeLead
+	}
+
+	truncate := bson.M{"date": "$created_at", "unit": period, "timezone": reportTimeZone}
+	if period == "week" {
+		truncate["startOfWeek"] = "monday"
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$lookup", Value: bson.M{
+			"from": ac.calls.Name(), "localField": "_id", "foreignField": "lead_id", "as": "calls",
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"deleted_at": bson.M{"$exists": false}}},
+				bson.M{"$limit": 1},
+				bson.M{"$project": bson.M{"_id": 1}},
+			},
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from": ac.meets.Name(), "localField": "_id", "foreignField": "lead_id", "as": "meets",
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"status": callModels.MeetCompleted}},
+				bson.M{"$limit": 1},
+				bson.M{"$project": bson.M{"_id": 1}},
+			},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    bson.M{"$dateTrunc": truncate},
+			"leads":  bson.M{"$sum": 1},
+			"called": bson.M{"$sum": reached("$calls")},
+			"met":    bson.M{"$sum": reached("$meets")},
+			"won":    bson.M{"$sum": hasStatus(leadModels.StatusWin)},
+			"lost":   bson.M{"$sum": hasStatus(leadModels.StatusLose)},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+	cursor, err := ac.leads.Aggregate(ctx, pipeline)
+	if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to compute funnel", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	report := FunnelReport{Period: period, Periods: []FunnelPeriod{}}
+	if err := cursor.All(ctx, &report.Periods); err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to parse funnel", err)
+		return
+	}
+	for i := range report.Periods {
+		p := &report.Periods[i]
+		p.Start = p.Start.In(ac.location)
+		p.Rates = p.FunnelCounts.rates()
+		report.Totals.Leads += p.Leads
+		report.Totals.Called += p.Called
+		report.Totals.Met += p.Met
+		report.Totals.Won += p.Won
+		report.Totals.Lost += p.Lost
+	}
+	report.Rates = report.Totals.rates()
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,378 @@
+package AnalyticsControllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Arkariza/API_MyActivity/auth/middleware"
+	database "github.com/Arkariza/API_MyActivity/models"
+	targetModels "github.com/Arkariza/API_MyActivity/models/Target"
+	userModels "github.com/Arkariza/API_MyActivity/models/User"
+	"github.com/Arkariza/API_MyActivity/respond"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	leaderboardWeightsEnvKey  = "LEADERBOARD_WEIGHTS"
+	defaultLeaderboardWeights = "calls=1,meets=3,leads=2,wins=10"
+
+	// A running period keeps changing, so its board is recomputed often;
+	// ended periods only change through late edits.
+	currentPeriodTTL = time.Minute
+	endedPeriodTTL   = time.Hour
+
+	// maxCachedLeaderboards bounds the cache; past periods and other teams
+	// can be asked for without end.
+	maxCachedLeaderboards = 256
+)
+
+// leaderboardMetrics are the scored metrics, in the order they break ties.
+var leaderboardMetrics = []string{
+	targetModels.MetricWins,
+	targetModels.MetricMeets,
+	targetModels.MetricCalls,
+	targetModels.MetricLeads,
+}
+
+// Weights are the points each unit of a metric is worth.
+type Weights map[string]float64
+
+// ParseWeights reads "calls=1,meets=3,leads=2,wins=10". Metrics left out
+// score nothing.
+func ParseWeights(raw string) (Weights, error) {
+	weights := Weights{}
+	for _, part := range strings.Split(raw, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		metric, value, found := strings.Cut(part, "=")
+		metric = strings.TrimSpace(metric)
+		if !found || !isLeaderboardMetric(metric) {
+			return nil, fmt.Errorf("invalid weight %q, expected metric=number with metric one of calls, meets, leads, wins", part)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight for %s: %q", metric, value)
+		}
+		weights[metric] = weight
+	}
+	if len(weights) == 0 {
+		return nil, fmt.Errorf("no weights given")
+	}
+	return weights, nil
+}
+
+func isLeaderboardMetric(metric string) bool {
+	for _, m := range leaderboardMetrics {
+		if m == metric {
+			return true
+		}
+	}
+	return false
+}
+
+func (w Weights) key() string {
+	parts := make([]string, 0, len(leaderboardMetrics))
+	for _, metric := range leaderboardMetrics {
+		parts = append(parts, metric+"="+strconv.FormatFloat(w[metric], 'g', -1, 64))
+	}
+	return strings.Join(parts, ",")
+}
+
+type LeaderboardEntry struct {
+	Rank     int                `json:"rank"`
+	UserID   primitive.ObjectID `json:"user_id"`
+	Username string             `json:"username"`
+	Calls    int64              `json:"calls"`
+	Meets    int64              `json:"meets"`
+	Leads    int64              `json:"leads"`
+	Wins     int64              `json:"wins"`
+	Score    float64            `json:"score"`
+}
+
+func (e *LeaderboardEntry) counts() []int64 {
+	return []int64{e.Wins, e.Meets, e.Calls, e.Leads}
+}
+
+type Leaderboard struct {
+	Period      string             `json:"period"`
+	PeriodStart time.Time          `json:"period_start"`
+	PeriodEnd   time.Time          `json:"period_end"`
+	Team        string             `json:"team"`
+	Weights     Weights            `json:"weights"`
+	ComputedAt  time.Time          `json:"computed_at"`
+	Entries     []LeaderboardEntry `json:"data"`
+}
+
+type cachedLeaderboard struct {
+	board   *Leaderboard
+	expires time.Time
+}
+
+// leaderboardCache keeps computed boards per team, period and weights. It
+// holds at most maxCachedLeaderboards boards.
+type leaderboardCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedLeaderboard
+}
+
+func (lc *leaderboardCache) get(key string, now time.Time) *Leaderboard {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if entry, ok := lc.entries[key]; ok && now.Before(entry.expires) {
+		return entry.board
+	}
+	return nil
+}
+
+func (lc *leaderboardCache) put(key string, board *Leaderboard, expires time.Time) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if lc.entries == nil {
+		lc.entries = map[string]cachedLeaderboard{}
+	}
+	for k, entry := range lc.entries {
+		if !board.ComputedAt.Before(entry.expires) {
+			delete(lc.entries, k)
+		}
+	}
+	// When still full, the board closest to expiring makes room.
+	if _, ok := lc.entries[key]; !ok && len(lc.entries) >= maxCachedLeaderboards {
+		var oldest string
+		for k, entry := range lc.entries {
+			if oldest == "" || entry.expires.Before(lc.entries[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(lc.entries, oldest)
+	}
+	lc.entries[key] = cachedLeaderboard{board: board, expires: expires}
+}
+
+// sortLeaderboard orders by score, then by wins, meets, calls and leads,
+// then by username and ID, so equal results always come out the same way.
+// Users share a rank only when all their counts are equal.
+func sortLeaderboard(entries []LeaderboardEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := &entries[i], &entries[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		ac, bc := a.counts(), b.counts()
+		for k := range ac {
+			if ac[k] != bc[k] {
+				return ac[k] > bc[k]
+			}
+		}
+		if a.Username != b.Username {
+			return a.Username < b.Username
+		}
+		return a.UserID.Hex() < b.UserID.Hex()
+	})
+	for i := range entries {
+		entries[i].Rank = i + 1
+		if i > 0 && entries[i].Score == entries[i-1].Score && equalCounts(entries[i].counts(), entries[i-1].counts()) {
+			entries[i].Rank = entries[i-1].Rank
+		}
+	}
+}
+
+func equalCounts(a, b []int64) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// GetLeaderboard ranks the members of the caller's team by weighted
+// activity in a day, week or month. Staff may look at another team. The
+// weights come from the weights query value or LEADERBOARD_WEIGHTS; only
+// boards computed with the configured weights are cached, though a request
+// naming the same weights is served from the cache too.
+func (ac *AnalyticsController) GetLeaderboard(c *gin.Context) {
+	userID, role, ok := AuthMiddleware.CurrentUser(c)
+	if !ok {
+		return
+	}
+
+	period := c.DefaultQuery("period", targetModels.PeriodWeek)
+	if period != targetModels.PeriodDay && period != targetModels.PeriodWeek && period != targetModels.PeriodMonth {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid period, expected day, week or month"})
+		return
+	}
+	now := time.Now()
+	at := now
+	if raw := c.Query("date"); raw != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", raw, ac.location)
+		if err != nil {
+			respond.Error(c, http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD", err)
+			return
+		}
+		at = parsed
+	}
+	start, end := targetModels.PeriodBounds(period, at, ac.location)
+
+	rawWeights := c.Query("weights")
+	cacheable := rawWeights == ""
+	if rawWeights == "" {
+		rawWeights = os.Getenv(leaderboardWeightsEnvKey)
+	}
+	if rawWeights == "" {
+		rawWeights = defaultLeaderboardWeights
+	}
+	weights, err := ParseWeights(rawWeights)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid weights", err)
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	var caller userModels.User
+	if err := ac.users.FindOne(ctx, bson.M{"_id": userID}).Decode(&caller); err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to load user", err)
+		return
+	}
+	team := caller.Team
+	if requested, ok := c.GetQuery("team"); ok && requested != team {
+		if role != userModels.RoleStaff {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only staff can view another team's leaderboard"})
+			return
+		}
+		team = strings.TrimSpace(requested)
+	}
+
+	key := strings.Join([]string{team, period, start.Format(time.RFC3339), weights.key()}, "|")
+	if board := ac.leaderboards.get(key, now); board != nil {
+		c.JSON(http.StatusOK, board)
+		return
+	}
+
+	board, err := ac.computeLeaderboard(ctx, team, weights, start, end)
+	if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to compute leaderboard", err)
+		return
+	}
+	board.Period = period
+	board.ComputedAt = now
+	ttl := endedPeriodTTL
+	if now.Before(end) {
+		ttl = currentPeriodTTL
+	}
+	if cacheable {
+		ac.leaderboards.put(key, board, now.Add(ttl))
+	}
+
+	c.JSON(http.StatusOK, board)
+}
+
+func (ac *AnalyticsController) computeLeaderboard(ctx context.Context, team string, weights Weights, start, end time.Time) (*Leaderboard, error) {
+	// Users without a team compete with each other.
+	filter := bson.M{"team": team}
+	if team == "" {
+		filter["team"] = bson.M{"$in": bson.A{nil, ""}}
+	}
+	cursor, err := ac.users.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1, "username": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var members []userModels.User
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(members))
+	entries := make([]LeaderboardEntry, len(members))
+	index := make(map[primitive.ObjectID]*LeaderboardEntry, len(members))
+	for i, member := range members {
+		ids[i] = member.ID
+		entries[i] = LeaderboardEntry{UserID: member.ID, Username: member.Username}
+		index[member.ID] = &entries[i]
+	}
+
+	sources := map[string]*mongo.Collection{
+		targetModels.MetricCalls: ac.calls,
+		targetModels.MetricMeets: ac.meets,
+		targetModels.MetricLeads: ac.leads,
+		targetModels.MetricWins:  ac.leads,
+	}
+	for _, metric := range leaderboardMetrics {
+		match := targetModels.MetricFilter(metric, start, end)
+		match["user_id"] = bson.M{"$in": ids}
+		counts, err := countByUser(ctx, sources[metric], match)
+		if err != nil {
+			return nil, err
+		}
+		for userID, count := range counts {
+			entry, ok := index[userID]
+			if !ok {
+				continue
+			}
+			switch metric {
+			case targetModels.MetricCalls:
+				entry.Calls = count
+			case targetModels.MetricMeets:
+				entry.Meets = count
+			case targetModels.MetricLeads:
+				entry.Leads = count
+			case targetModels.MetricWins:
+				entry.Wins = count
+			}
+		}
+	}
+
+	for i := range entries {
+		e := &entries[i]
+		e.Score = float64(e.Calls)*weights[targetModels.MetricCalls] +
+			float64(e.Meets)*weights[targetModels.MetricMeets] +
+			float64(e.Leads)*weights[targetModels.MetricLeads] +
+			float64(e.Wins)*weights[targetModels.MetricWins]
+	}
+	sortLeaderboard(entries)
+
+	return &Leaderboard{
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Team:        team,
+		Weights:     weights,
+		Entries:     entries,
+	}, nil
+}
+
+func countByUser(ctx context.Context, collection *mongo.Collection, match bson.M) (map[primitive.ObjectID]int64, error) {
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{"_id": "$user_id", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	counts := map[primitive.ObjectID]int64{}
+	for cursor.Next(ctx) {
+		var group struct {
+			UserID primitive.ObjectID `bson:"_id"`
+			Count  int64              `bson:"count"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return nil, err
+		}
+		counts[group.UserID] = group.Count
+	}
+	return counts, cursor.Err()
+}
@@ -0,0 +1,341 @@
+package AttachmentControllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Arkariza/API_MyActivity/audit"
+	"github.com/Arkariza/API_MyActivity/auth/middleware"
+	"github.com/Arkariza/API_MyActivity/events"
+	database "github.com/Arkariza/API_MyActivity/models"
+	"github.com/Arkariza/API_MyActivity/models/Attachment"
+	userModels "github.com/Arkariza/API_MyActivity/models/User"
+	"github.com/Arkariza/API_MyActivity/storage"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// multipartOverhead is the room left for multipart headers and boundaries on
+// top of the file itself when limiting the request body.
+const multipartOverhead = 1 << 20
+
+type AttachmentController struct {
+	collection *mongo.Collection
+	entities   map[string]*mongo.Collection
+	store      storage.Storage
+}
+
+func NewAttachmentController(collection, leads, meets *mongo.Collection, store storage.Storage) *AttachmentController {
+	return &AttachmentController{
+		collection: collection,
+		entities: map[string]*mongo.Collection{
+			models.AttachOnLead: leads,
+			models.AttachOnMeet: meets,
+		},
+		store: store,
+	}
+}
+
+// entityOwner returns the user the lead or meet currently belongs to.
+func (ac *AttachmentController) entityOwner(ctx context.Context, entityType string, entityID primitive.ObjectID) (primitive.ObjectID, error) {
+	var entity struct {
+		UserID primitive.ObjectID `bson:"user_id"`
+	}
+	err := ac.entities[entityType].FindOne(ctx, bson.M{"_id": entityID}).Decode(&entity)
+	return entity.UserID, err
+}
+
+// authorizeEntity loads the owner of the lead or meet in the path and checks
+// the caller may see its attachments: staff may see all of them, everyone
+// else only those on their own leads and meets.
+func (ac *AttachmentController) authorizeEntity(c *gin.Context, ctx context.Context, entityType string, userID primitive.ObjectID, role int) (primitive.ObjectID, primitive.ObjectID, bool) {
+	entityID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + entityType + " ID"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	owner, err := ac.entityOwner(ctx, entityType, entityID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": entityType + " not found"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	} else if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to fetch " + entityType})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	if role != userModels.RoleStaff && owner != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this " + entityType})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	return entityID, owner, true
+}
+
+// Upload stores the multipart "file" field against the lead or meet in the
+// path. The content type is sniffed from the bytes rather than trusted from
+// the client, and the SHA-256 of the contents is recorded.
+func (ac *AttachmentController) Upload(entityType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, role, ok := AuthMiddleware.CurrentUser(c)
+		if !ok {
+			return
+		}
+
+		maxSize := models.MaxSize()
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+multipartOverhead)
+
+		file, header, err := c.Request.FormFile("file")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File exceeds the maximum size of " + strconv.FormatInt(maxSize, 10) + " bytes"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A multipart file field named \"file\" is required", "details": err.Error()})
+			return
+		}
+		defer file.Close()
+
+		if header.Size > maxSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File exceeds the maximum size of " + strconv.FormatInt(maxSize, 10) + " bytes"})
+			return
+		}
+
+		head := make([]byte, 512)
+		n, err := io.ReadFull(file, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file", "details": err.Error()})
+			return
+		}
+		if n == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "File is empty"})
+			return
+		}
+		head = head[:n]
+
+		contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+		if !models.AllowedTypes[contentType] {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "File type " + contentType + " is not allowed"})
+			return
+		}
+
+		ctx, cancel := database.QueryContext(c.Request.Context())
+		defer cancel()
+
+		entityID, owner, ok := ac.authorizeEntity(c, ctx, entityType, userID, role)
+		if !ok {
+			return
+		}
+
+		attachment := models.Attachment{
+			ID:          primitive.NewObjectID(),
+			EntityType:  entityType,
+			EntityID:    entityID,
+			UploadedBy:  userID,
+			FileName:    cleanFileName(header.Filename),
+			ContentType: contentType,
+			CreatedAt:   time.Now(),
+		}
+		attachment.StorageKey = attachment.Key()
+
+		// Writing the file may take longer than a query, so it runs on the
+		// request context instead of the query timeout.
+		hash := sha256.New()
+		body := &io.LimitedReader{
+			R: io.TeeReader(io.MultiReader(bytes.NewReader(head), file), hash),
+			N: maxSize + 1,
+		}
+		if err := ac.store.Put(c.Request.Context(), attachment.StorageKey, body); err != nil {
+			c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to store file", "details": err.Error()})
+			return
+		}
+		attachment.Size = maxSize + 1 - body.N
+		if attachment.Size > maxSize {
+			ac.discard(attachment)
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File exceeds the maximum size of " + strconv.FormatInt(maxSize, 10) + " bytes"})
+			return
+		}
+		attachment.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+		if _, err := ac.collection.InsertOne(ctx, attachment); err != nil {
+			ac.discard(attachment)
+			c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to save attachment", "details": err.Error()})
+			return
+		}
+		events.Publish(events.EntityAttachment, events.Created, attachment.ID, owner, attachment)
+		audit.Record(c, audit.EntityAttachment, audit.Created, attachment.ID, nil, attachment)
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "Attachment uploaded successfully",
+			"data":    attachment,
+		})
+	}
+}
+
+// List returns the attachments on the lead or meet in the path, newest first.
+func (ac *AttachmentController) List(entityType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, role, ok := AuthMiddleware.CurrentUser(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := database.QueryContext(c.Request.Context())
+		defer cancel()
+
+		entityID, _, ok := ac.authorizeEntity(c, ctx, entityType, userID, role)
+		if !ok {
+			return
+		}
+
+		cursor, err := ac.collection.Find(ctx,
+			bson.M{"entity_type": entityType, "entity_id": entityID},
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+		if err != nil {
+			c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to fetch attachments"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		attachments := []models.Attachment{}
+		if err := cursor.All(ctx, &attachments); err != nil {
+			c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to decode attachments"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": attachments})
+	}
+}
+
+// findAuthorized loads the attachment in the path if the caller is staff,
+// uploaded it, or owns the lead or meet it belongs to.
+func (ac *AttachmentController) findAuthorized(c *gin.Context, ctx context.Context) (models.Attachment, primitive.ObjectID, bool) {
+	var attachment models.Attachment
+
+	userID, role, ok := AuthMiddleware.CurrentUser(c)
+	if !ok {
+		return attachment, primitive.NilObjectID, false
+	}
+
+	attachmentID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return attachment, primitive.NilObjectID, false
+	}
+
+	err = ac.collection.FindOne(ctx, bson.M{"_id": attachmentID}).Decode(&attachment)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return attachment, primitive.NilObjectID, false
+	} else if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to fetch attachment"})
+		return attachment, primitive.NilObjectID, false
+	}
+
+	owner, err := ac.entityOwner(ctx, attachment.EntityType, attachment.EntityID)
+	if err != nil && err != mongo.ErrNoDocuments {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to fetch " + attachment.EntityType})
+		return attachment, primitive.NilObjectID, false
+	}
+
+	if role != userModels.RoleStaff && attachment.UploadedBy != userID && owner != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this attachment"})
+		return attachment, primitive.NilObjectID, false
+	}
+	return attachment, owner, true
+}
+
+func (ac *AttachmentController) Download(c *gin.Context) {
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	attachment, _, ok := ac.findAuthorized(c, ctx)
+	if !ok {
+		return
+	}
+
+	etag := `"` + attachment.SHA256 + `"`
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	reader, err := ac.store.Open(c.Request.Context(), attachment.StorageKey)
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment contents are missing"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open attachment"})
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, reader, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}),
+		"ETag":                   etag,
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// Delete removes an attachment. Only staff and the uploader may delete.
+func (ac *AttachmentController) Delete(c *gin.Context) {
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	attachment, owner, ok := ac.findAuthorized(c, ctx)
+	if !ok {
+		return
+	}
+	if c.GetInt("userRole") != userModels.RoleStaff && attachment.UploadedBy != c.MustGet("userID").(primitive.ObjectID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only staff or the uploader can delete an attachment"})
+		return
+	}
+
+	result, err := ac.collection.DeleteOne(ctx, bson.M{"_id": attachment.ID})
+	if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to delete attachment"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	ac.discard(attachment)
+	events.Publish(events.EntityAttachment, events.Deleted, attachment.ID, owner, nil)
+	audit.Record(c, audit.EntityAttachment, audit.Deleted, attachment.ID, attachment, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted successfully"})
+}
+
+// discard removes stored contents that no longer have, or never got, a
+// metadata document. Failures only leave an orphaned file, so they are logged.
+func (ac *AttachmentController) discard(attachment models.Attachment) {
+	if err := ac.store.Delete(context.Background(), attachment.StorageKey); err != nil {
+		log.Printf("Error removing stored attachment %s: %v", attachment.StorageKey, err)
+	}
+}
+
+func cleanFileName(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	if len(name) > 255 {
+		name = name[len(name)-255:]
+	}
+	return name
+}
@@ -0,0 +1,130 @@
+package AuditControllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Arkariza/API_MyActivity/audit"
+	database "github.com/Arkariza/API_MyActivity/models"
+	"github.com/Arkariza/API_MyActivity/models/Audit"
+	userModels "github.com/Arkariza/API_MyActivity/models/User"
+	"github.com/Arkariza/API_MyActivity/respond"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AuditController struct {
+	collection *mongo.Collection
+}
+
+func NewAuditController(collection *mongo.Collection) *AuditController {
+	return &AuditController{collection: collection}
+}
+
+// GetEntries lists audit entries, newest first. Staff only. Entries can be
+// narrowed by entity, entity_id, actor_id, action, request_id and a from/to
+// date range.
+func (ac *AuditController) GetEntries(c *gin.Context) {
+	if c.GetInt("userRole") != userModels.RoleStaff {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only staff can view the audit log"})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	filter := bson.M{}
+	if entity := c.Query("entity"); entity != "" {
+		if !knownEntity(entity) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown entity " + entity})
+			return
+		}
+		filter["entity"] = entity
+	}
+	if action := c.Query("action"); action != "" {
+		if action != audit.Created && action != audit.Updated && action != audit.Deleted {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action, expected created, updated or deleted"})
+			return
+		}
+		filter["action"] = action
+	}
+	for param, field := range map[string]string{"entity_id": "entity_id", "actor_id": "actor_id"} {
+		if raw := c.Query(param); raw != "" {
+			id, err := primitive.ObjectIDFromHex(raw)
+			if err != nil {
+				respond.Error(c, http.StatusBadRequest, "Invalid "+param, err)
+				return
+			}
+			filter[field] = id
+		}
+	}
+	if requestID := c.Query("request_id"); requestID != "" {
+		filter["request_id"] = requestID
+	}
+	at := bson.M{}
+	for param, operator := range map[string]string{"from": "$gte", "to": "$lt"} {
+		if raw := c.Query(param); raw != "" {
+			parsed, err := time.Parse("2006-01-02", raw)
+			if err != nil {
+				respond.Error(c, http.StatusBadRequest, "Invalid "+param+" date, expected YYYY-MM-DD", err)
+				return
+			}
+			if param == "to" {
+				parsed = parsed.AddDate(0, 0, 1)
+			}
+			at[operator] = parsed
+		}
+	}
+	if len(at) > 0 {
+		filter["time"] = at
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	total, err := ac.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to count audit entries", err)
+		return
+	}
+	cursor, err := ac.collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64((page-1)*limit)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to fetch audit entries", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.Entry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to parse audit entries", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  entries,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+func knownEntity(entity string) bool {
+	for _, known := range audit.Entities {
+		if known == entity {
+			return true
+		}
+	}
+	return false
+}
@@ -4,13 +4,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"math"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Arkariza/API_MyActivity/audit"
+	"github.com/Arkariza/API_MyActivity/etag"
+	"github.com/Arkariza/API_MyActivity/events"
+	"github.com/Arkariza/API_MyActivity/metrics"
+	database "github.com/Arkariza/API_MyActivity/models"
 	"github.com/Arkariza/API_MyActivity/models/CallAndMeet"
+	taskModels "github.com/Arkariza/API_MyActivity/models/Task"
+	"github.com/Arkariza/API_MyActivity/phone"
+	"github.com/Arkariza/API_MyActivity/spreadsheet"
+	"github.com/Arkariza/API_MyActivity/tombstone"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -20,31 +30,38 @@ import (
 
 type CallController struct {
 	collection *mongo.Collection
+	tasks      *mongo.Collection
 }
 
-func NewCallController(collection *mongo.Collection) *CallController {
+func NewCallController(collection *mongo.Collection, tasks *mongo.Collection) *CallController {
 	return &CallController{
 		collection: collection,
+		tasks:      tasks,
 	}
 }
 
 type AddCallRequest struct {
     ClientName      string `json:"client_name" binding:"required"`
-    PhoneNum        string `json:"phonenum" binding:"required"`
+    PhoneNum        string `json:"phonenum" binding:"required,phone"`
 	Date 			time.Time `json:"date" binding:"required"`
     Note            string `json:"note,omitempty"`
     ProspectStatus  string `json:"prospect_status,omitempty"`
     CallResult      string `json:"call_result,omitempty"`
+    LeadID          string `json:"lead_id,omitempty" binding:"omitempty,mongodb"`
+    FollowUpDate    *time.Time `json:"follow_up_date,omitempty"`
 }
 
 type UpdateCallRequest struct {
 	ClientName     string `json:"client_name"`
-	PhoneNum       string `json:"phone_num"`
+	PhoneNum       string `json:"phone_num" binding:"omitempty,phone"`
 	Note           string `json:"note"`
 	ProspectStatus string `json:"prospect_status"`
 	CallResult     string `json:"call_result"`
+	FollowUpDate   *time.Time `json:"follow_up_date,omitempty"`
 }
 
+const defaultFollowUpDelay = 24 * time.Hour
+
 func validateToken(c *gin.Context) (string, error) {
     authHeader := c.GetHeader("Authorization")
     if !strings.HasPrefix(authHeader, "Bearer ") {
@@ -69,12 +86,25 @@ func (cc *CallController) AddCall(c *gin.Context, req AddCallRequest) (*models.C
     call := models.Call{
         ID:              primitive.NewObjectID(),
         ClientName:      req.ClientName,
-        PhoneNum:        req.PhoneNum,
+        PhoneNum:        phone.Format(req.PhoneNum),
         Note:            req.Note,
         CreatedAt:       time.Now(),
         Date:            time.Now(),
         ProspectStatus:  req.ProspectStatus,
         CallResult:      req.CallResult,
+        Version:         1,
+        ModifiedAt:      time.Now(),
+    }
+
+    if userID, exists := c.Get("user_id"); exists {
+        if ownerID, err := primitive.ObjectIDFromHex(userID.(string)); err == nil {
+            call.UserID = ownerID
+        }
+    }
+    if req.LeadID != "" {
+        // Validated by the binding.
+        leadID, _ := primitive.ObjectIDFromHex(req.LeadID)
+        call.LeadID = &leadID
     }
 
     if call.ProspectStatus == "" {
@@ -87,14 +117,24 @@ func (cc *CallController) AddCall(c *gin.Context, req AddCallRequest) (*models.C
         call.Note = "No additional notes provided."
     }
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    ctx, cancel := database.QueryContext(c.Request.Context())
     defer cancel()
 
     _, err = cc.collection.InsertOne(ctx, call)
     if err != nil {
-        return nil, fmt.Errorf("failed to create call: %v", err)
+        return nil, fmt.Errorf("failed to create call: %w", err)
+    }
+    metrics.CallsLogged.Inc()
+    events.Publish(events.EntityCall, events.Created, call.ID, call.UserID, call)
+    audit.Record(c, audit.EntityCall, audit.Created, call.ID, nil, call)
+
+    if call.ProspectStatus == models.ProspectFollowUp {
+        if err := cc.scheduleFollowUp(c, ctx, &call, req.FollowUpDate); err != nil {
+            log.Printf("Error scheduling follow-up for call %s: %v", call.ID.Hex(), err)
+        }
     }
 
+    etag.Set(c, call.Version)
     c.JSON(http.StatusCreated, gin.H{
         "message": "Call created successfully",
         "data":    call,
@@ -103,10 +143,99 @@ func (cc *CallController) AddCall(c *gin.Context, req AddCallRequest) (*models.C
     return &call, nil
 }
 
+// scheduleFollowUp opens a follow-up task for the call unless one is already
+// open, due at the requested date or a day after the call.
+func (cc *CallController) scheduleFollowUp(c *gin.Context, ctx context.Context, call *models.Call, due *time.Time) error {
+	dueDate := call.Date.Add(defaultFollowUpDelay)
+	if due != nil && !due.IsZero() {
+		dueDate = *due
+	}
+
+	task := taskModels.NewFollowUpTask(call.UserID, call.ID, call.LeadID, call.ClientName, dueDate)
+	result, err := cc.tasks.UpdateOne(ctx,
+		bson.M{"call_id": call.ID, "status": taskModels.TaskOpen},
+		bson.M{"$setOnInsert": task},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return err
+	}
+	if result.UpsertedCount > 0 {
+		audit.Record(c, audit.EntityTask, audit.Created, task.ID, nil, task)
+	}
+	return nil
+}
+
 func handleError(c *gin.Context, i int, s string, err error) {
 	panic("unimplemented")
 }
 
+// callFilter builds the search and status filter shared by GetCalls and
+// ExportCalls.
+func callFilter(c *gin.Context) bson.M {
+	filter := bson.M{"deleted_at": bson.M{"$exists": false}}
+
+	if searchQuery := c.Query("search"); searchQuery != "" {
+		filter["$or"] = []bson.M{
+			{"client_name": bson.M{"$regex": primitive.Regex{Pattern: searchQuery, Options: "i"}}},
+			{"phonenum": bson.M{"$regex": primitive.Regex{Pattern: searchQuery, Options: "i"}}},
+		}
+		// Numbers are stored as E.164, so "0812..." is matched by its digits.
+		if digits := phone.SearchDigits(searchQuery); digits != "" {
+			filter["$or"] = append(filter["$or"].([]bson.M), bson.M{"phonenum": bson.M{"$regex": primitive.Regex{Pattern: digits}}})
+		}
+	}
+
+	if status := c.Query("status"); status != "" {
+		filter["prospect_status"] = status
+	}
+	return filter
+}
+
+var callExportColumns = []spreadsheet.Column{
+	{Key: "id", Title: "ID"},
+	{Key: "client_name", Title: "Client Name"},
+	{Key: "phone_num", Title: "Phone Number"},
+	{Key: "prospect_status", Title: "Prospect Status"},
+	{Key: "call_result", Title: "Call Result"},
+	{Key: "note", Title: "Note"},
+	{Key: "date", Title: "Date"},
+	{Key: "created_at", Title: "Created At"},
+}
+
+// ExportCalls streams every call matching the GetCalls filters as CSV, XLSX
+// or NDJSON.
+func (cc *CallController) ExportCalls(c *gin.Context) {
+	filter := callFilter(c)
+	spreadsheet.Download(c, "calls", callExportColumns, func(write func([]interface{}) error) error {
+		// An export can take longer than QueryTimeout, so it is bounded
+		// by the request instead.
+		ctx := c.Request.Context()
+		cursor, err := cc.collection.Find(ctx, filter, options.Find().
+			SetSort(bson.D{{Key: "date", Value: -1}}).
+			SetBatchSize(500))
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+
+		for cursor.Next(ctx) {
+			var call models.Call
+			if err := cursor.Decode(&call); err != nil {
+				return err
+			}
+			err := write([]interface{}{
+				call.ID.Hex(), call.ClientName, call.PhoneNum, call.ProspectStatus,
+				call.CallResult, call.Note, call.Date, call.CreatedAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return cursor.Err()
+	})
+}
+
 func (cc *CallController) GetCalls(c *gin.Context) {
 	limit := 10
 	page := 1
@@ -127,41 +256,32 @@ func (cc *CallController) GetCalls(c *gin.Context) {
 	}
 
 	skip := (page - 1) * limit
-
-	filter := bson.M{"deleted_at": bson.M{"$exists": false}}
-
-	if searchQuery := c.Query("search"); searchQuery != "" {
-		filter["$or"] = []bson.M{
-			{"client_name": bson.M{"$regex": primitive.Regex{Pattern: searchQuery, Options: "i"}}},
-			{"phonenum": bson.M{"$regex": primitive.Regex{Pattern: searchQuery, Options: "i"}}},
-		}
-	}
-
-	if status := c.Query("status"); status != "" {
-		filter["prospect_status"] = status
-	}
+	filter := callFilter(c)
 
 	findOptions := options.Find().
 		SetSkip(int64(skip)).
 		SetLimit(int64(limit)).
 		SetSort(bson.D{{Key: "date", Value: -1}})
 
-	cursor, err := cc.collection.Find(context.Background(), filter, findOptions)
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	cursor, err := cc.collection.Find(ctx, filter, findOptions)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch calls"})
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to fetch calls"})
 		return
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
 	var calls []bson.M
-	if err := cursor.All(context.Background(), &calls); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode calls"})
+	if err := cursor.All(ctx, &calls); err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to decode calls"})
 		return
 	}
 
-	totalCount, err := cc.collection.CountDocuments(context.Background(), filter)
+	totalCount, err := cc.collection.CountDocuments(ctx, filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count calls"})
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to count calls"})
 		return
 	}
 
@@ -187,18 +307,22 @@ func (cc *CallController) GetCallByID(c *gin.Context) {
 		return
 	}
 
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
 	filter := bson.M{"_id": id, "deleted_at": bson.M{"$exists": false}}
 	var call bson.M
-	err = cc.collection.FindOne(context.Background(), filter).Decode(&call)
+	err = cc.collection.FindOne(ctx, filter).Decode(&call)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Call not found"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 		return
 	}
 
+	etag.Set(c, etag.Of(call))
 	c.JSON(http.StatusOK, call)
 }
 
@@ -245,7 +369,7 @@ func (cc *CallController) UpdateCall(c *gin.Context) {
 
 	update := bson.M{"$set": bson.M{
 		"client_name":     req.ClientName,
-		"phone_num":       req.PhoneNum,
+		"phonenum":        phone.Format(req.PhoneNum),
 		"note":            req.Note,
 		"prospect_status": req.ProspectStatus,
 		"call_result":     req.CallResult,
@@ -257,24 +381,53 @@ func (cc *CallController) UpdateCall(c *gin.Context) {
 		}
 	}
 
-	result, err := cc.collection.UpdateOne(
-		context.Background(), 
-		bson.M{"_id": id, "deleted_at": bson.M{"$exists": false}}, 
-		update,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	filter := bson.M{"_id": id, "deleted_at": bson.M{"$exists": false}}
+	var before models.Call
+	if err := cc.collection.FindOne(ctx, filter).Decode(&before); err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Call not found"})
+		return
+	} else if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{
 			"error":   "Failed to update call",
 			"details": err.Error(),
 		})
 		return
 	}
+	if !etag.Check(c, before.Version) {
+		return
+	}
 
-	if result.ModifiedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Call not found or no changes made"})
+	var call models.Call
+	err = cc.collection.FindOneAndUpdate(
+		ctx,
+		etag.Match(filter, before.Version),
+		etag.Bump(update),
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&call)
+	if err == mongo.ErrNoDocuments {
+		etag.Conflict(c)
 		return
+	} else if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{
+			"error":   "Failed to update call",
+			"details": err.Error(),
+		})
+		return
+	}
+	events.Publish(events.EntityCall, events.Updated, call.ID, call.UserID, call)
+	audit.Record(c, audit.EntityCall, audit.Updated, call.ID, before, call)
+
+	if req.ProspectStatus == models.ProspectFollowUp {
+		call.Date = time.Now()
+		if err := cc.scheduleFollowUp(c, ctx, &call, req.FollowUpDate); err != nil {
+			log.Printf("Error scheduling follow-up for call %s: %v", id.Hex(), err)
+		}
 	}
 
+	etag.Set(c, call.Version)
 	c.JSON(http.StatusOK, gin.H{"message": "Call updated successfully"})
 }
 
@@ -285,22 +438,27 @@ func (cc *CallController) DeleteCall(c *gin.Context) {
         return
     }
 
-    result, err := cc.collection.DeleteOne(
-        context.Background(), 
+    ctx, cancel := database.QueryContext(c.Request.Context())
+    defer cancel()
+
+    var call models.Call
+    err = cc.collection.FindOneAndDelete(
+        ctx,
         bson.M{"_id": id},
-    )
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{
+    ).Decode(&call)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Call not found"})
+        return
+    } else if err != nil {
+        c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{
             "error":   "Failed to delete call",
             "details": err.Error(),
         })
         return
     }
-
-    if result.DeletedCount == 0 {
-        c.JSON(http.StatusNotFound, gin.H{"error": "Call not found"})
-        return
-    }
+    events.Publish(events.EntityCall, events.Deleted, call.ID, call.UserID, nil)
+    audit.Record(c, audit.EntityCall, audit.Deleted, call.ID, call, nil)
+    tombstone.Record(events.EntityCall, call.ID, call.UserID, tombstone.Deleted)
 
     c.JSON(http.StatusOK, gin.H{"message": "Call deleted successfully"})
 }
\ No newline at end of file
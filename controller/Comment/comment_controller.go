@@ -3,12 +3,21 @@ package CommentController
 import (
 	"context"
 	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Arkariza/API_MyActivity/audit"
+	"github.com/Arkariza/API_MyActivity/etag"
+	"github.com/Arkariza/API_MyActivity/events"
+	database "github.com/Arkariza/API_MyActivity/models"
 	"github.com/Arkariza/API_MyActivity/models/CallAndMeet"
+	notificationModels "github.com/Arkariza/API_MyActivity/models/Notification"
+	userModels "github.com/Arkariza/API_MyActivity/models/User"
+	"github.com/Arkariza/API_MyActivity/notify"
+	"github.com/Arkariza/API_MyActivity/tombstone"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -18,10 +27,119 @@ import (
 
 type CommentController struct {
 	Collection *mongo.Collection
+	users      *mongo.Collection
+	entities   map[string]*mongo.Collection
+	notifier   *notify.Notifier
 }
 
-func NewCommentController(collection *mongo.Collection) *CommentController {
-	return &CommentController{Collection: collection}
+func NewCommentController(collection, users, leads, calls, meets *mongo.Collection, notifier *notify.Notifier) *CommentController {
+	return &CommentController{
+		Collection: collection,
+		users:      users,
+		entities: map[string]*mongo.Collection{
+			models.CommentOnLead: leads,
+			models.CommentOnCall: calls,
+			models.CommentOnMeet: meets,
+		},
+		notifier: notifier,
+	}
+}
+
+type CreateCommentRequest struct {
+	Title       string `json:"title" binding:"required"`
+	Description string `json:"description"`
+	EntityType  string `json:"entity_type" binding:"required,oneof=lead call meet"`
+	EntityID    string `json:"entity_id" binding:"required"`
+	ParentID    string `json:"parent_id"`
+}
+
+type UpdateCommentRequest struct {
+	Title       string `json:"title" binding:"required"`
+	Description string `json:"description"`
+}
+
+// CommentThread is a comment with its replies, oldest first.
+type CommentThread struct {
+	models.Comment `bson:",inline"`
+	Replies        []*CommentThread `json:"replies"`
+}
+
+// author returns the caller as set by the comment middleware. Comments are
+// attributed from the token, never from the request body.
+func author(c *gin.Context) (primitive.ObjectID, string, int, bool) {
+	userID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID in token"})
+		return primitive.NilObjectID, "", 0, false
+	}
+	return userID, c.GetString("username"), c.GetInt("role"), true
+}
+
+// entityOwner returns the user the commented lead, call or meet belongs to.
+func (cc *CommentController) entityOwner(ctx context.Context, entityType string, entityID primitive.ObjectID) (primitive.ObjectID, error) {
+	var entity struct {
+		UserID primitive.ObjectID `bson:"user_id"`
+	}
+	err := cc.entities[entityType].FindOne(ctx, bson.M{"_id": entityID}).Decode(&entity)
+	return entity.UserID, err
+}
+
+// resolveMentions looks up the users mentioned in text. Names that do not
+// match a user are ignored so that an email address or a typo does not fail
+// the comment.
+func (cc *CommentController) resolveMentions(ctx context.Context, text string) ([]primitive.ObjectID, error) {
+	mentioned := []primitive.ObjectID{}
+	usernames := models.ParseMentions(text)
+	if len(usernames) == 0 {
+		return mentioned, nil
+	}
+
+	cursor, err := cc.users.Find(ctx, bson.M{"username": bson.M{"$in": usernames}},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		mentioned = append(mentioned, user.ID)
+	}
+	return mentioned, nil
+}
+
+// notify sends kind to each recipient except the comment's own author.
+func (cc *CommentController) notify(ctx context.Context, comment models.Comment, kind, title string, recipients []primitive.ObjectID) {
+	for _, recipient := range recipients {
+		if recipient.IsZero() || recipient == comment.UserID {
+			continue
+		}
+		_, err := cc.notifier.Notify(ctx, recipient, kind, title, comment.Description,
+			map[string]string{
+				"comment_id":  comment.ID.Hex(),
+				"entity_type": comment.EntityType,
+				"entity_id":   comment.EntityID.Hex(),
+			},
+		)
+		if err != nil {
+			log.Printf("Error notifying user %s about comment %s: %v", recipient.Hex(), comment.ID.Hex(), err)
+		}
+	}
+}
+
+// ownerOf is entityOwner for events on existing comments, where a missing
+// entity only means the event is not scoped to anyone.
+func (cc *CommentController) ownerOf(ctx context.Context, comment models.Comment) primitive.ObjectID {
+	if !models.ValidCommentEntity(comment.EntityType) {
+		return primitive.NilObjectID
+	}
+	owner, _ := cc.entityOwner(ctx, comment.EntityType, comment.EntityID)
+	return owner
 }
 
 func validateToken(c *gin.Context) (string, error) {
@@ -45,29 +163,112 @@ func (cc *CommentController) CreateComment(c *gin.Context) {
         return
     }
 
-    var comment models.Comment
-    if err := c.ShouldBindJSON(&comment); err != nil {
+    userID, username, role, ok := author(c)
+    if !ok {
+        return
+    }
+
+    var req CreateCommentRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
 
-    comment.ID = primitive.NewObjectID()
+    entityID, err := primitive.ObjectIDFromHex(req.EntityID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid entity ID"})
+        return
+    }
+
+    comment := models.Comment{
+        ID:          primitive.NewObjectID(),
+        Title:       strings.TrimSpace(req.Title),
+        Description: strings.TrimSpace(req.Description),
+        Date:        time.Now(),
+        PostedBy:    username,
+        UserRole:    role,
+        UserID:      userID,
+        EntityType:  req.EntityType,
+        EntityID:    entityID,
+        Version:     1,
+        ModifiedAt:  time.Now(),
+    }
 
     if err := comment.Validate(); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
-    if comment.Date.IsZero() {
-        comment.Date = time.Now()
+    ctx, cancel := database.QueryContext(c.Request.Context())
+    defer cancel()
+
+    owner, err := cc.entityOwner(ctx, comment.EntityType, comment.EntityID)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusNotFound, gin.H{"error": comment.EntityType + " not found"})
+        return
+    } else if err != nil {
+        c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to fetch " + comment.EntityType})
+        return
+    }
+
+    var parent models.Comment
+    if req.ParentID != "" {
+        parentID, err := primitive.ObjectIDFromHex(req.ParentID)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid parent comment ID"})
+            return
+        }
+        err = cc.Collection.FindOne(ctx, bson.M{
+            "_id":         parentID,
+            "entity_type": comment.EntityType,
+            "entity_id":   comment.EntityID,
+        }).Decode(&parent)
+        if err == mongo.ErrNoDocuments {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "parent comment not found on this " + comment.EntityType})
+            return
+        } else if err != nil {
+            c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to fetch parent comment"})
+            return
+        }
+        comment.ParentID = &parentID
+    }
+
+    comment.Mentions, err = cc.resolveMentions(ctx, comment.Description)
+    if err != nil {
+        c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to resolve mentions"})
+        return
     }
-    result, err := cc.Collection.InsertOne(context.Background(), comment)
+
+    result, err := cc.Collection.InsertOne(ctx, comment)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{
+        c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{
             "error":   "failed to insert comment",
             "details": err.Error(),
         })
         return
     }
+    events.Publish(events.EntityComment, events.Created, comment.ID, owner, comment)
+    audit.Record(c, audit.EntityComment, audit.Created, comment.ID, nil, comment)
+
+    // Coaching notes from staff go to the owner of the activity, replies go
+    // to the author of the comment being replied to. Anyone mentioned gets a
+    // mention instead, never both.
+    cc.notify(ctx, comment, notificationModels.TypeMention, username+" mentioned you: "+comment.Title, comment.Mentions)
+
+    mentioned := map[primitive.ObjectID]bool{}
+    for _, id := range comment.Mentions {
+        mentioned[id] = true
+    }
+    var recipients []primitive.ObjectID
+    if role == userModels.RoleStaff && !mentioned[owner] {
+        recipients = append(recipients, owner)
+        mentioned[owner] = true
+    }
+    if comment.ParentID != nil && !mentioned[parent.UserID] {
+        recipients = append(recipients, parent.UserID)
+    }
+    cc.notify(ctx, comment, notificationModels.TypeComment, username+" commented: "+comment.Title, recipients)
+
+    etag.Set(c, comment.Version)
     c.JSON(http.StatusCreated, gin.H{
         "message": "Comment created successfully",
         "comment": comment,
@@ -75,6 +276,61 @@ func (cc *CommentController) CreateComment(c *gin.Context) {
     })
 }
 
+// ListForEntity returns the comments on one lead, call or meet as threads.
+func (cc *CommentController) ListForEntity(entityType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		entityID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + entityType + " ID"})
+			return
+		}
+
+		ctx, cancel := database.QueryContext(c.Request.Context())
+		defer cancel()
+
+		cursor, err := cc.Collection.Find(ctx,
+			bson.M{"entity_type": entityType, "entity_id": entityID},
+			options.Find().SetSort(bson.D{{Key: "date", Value: 1}}))
+		if err != nil {
+			c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to fetch comments"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		var comments []models.Comment
+		if err := cursor.All(ctx, &comments); err != nil {
+			c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to decode comments"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"comments": buildThreads(comments),
+			"total":    len(comments),
+		})
+	}
+}
+
+// buildThreads nests replies under their parent. Replies whose parent has
+// been deleted are shown at the top level rather than dropped.
+func buildThreads(comments []models.Comment) []*CommentThread {
+	nodes := make(map[primitive.ObjectID]*CommentThread, len(comments))
+	for _, comment := range comments {
+		nodes[comment.ID] = &CommentThread{Comment: comment, Replies: []*CommentThread{}}
+	}
+
+	roots := []*CommentThread{}
+	for _, comment := range comments {
+		node := nodes[comment.ID]
+		if comment.ParentID != nil {
+			if parent, ok := nodes[*comment.ParentID]; ok {
+				parent.Replies = append(parent.Replies, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots
+}
 
 func (cc *CommentController) GetAllComments(c *gin.Context) {
 	page := c.DefaultQuery("page", "1")
@@ -92,23 +348,79 @@ func (cc *CommentController) GetAllComments(c *gin.Context) {
 
 	skip := (pageNum - 1) * limitNum
 
-	totalCount, err := cc.Collection.CountDocuments(context.Background(), bson.M{})
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	totalCount, err := cc.Collection.CountDocuments(ctx, bson.M{})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count comments"})
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to count comments"})
 		return
 	}
 
-	cursor, err := cc.Collection.Find(context.Background(), bson.M{}, 
+	cursor, err := cc.Collection.Find(ctx, bson.M{},
 		options.Find().SetSkip(int64(skip)).SetLimit(int64(limitNum)))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch comments"})
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to fetch comments"})
 		return
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
 	var comments []models.Comment
-	if err := cursor.All(context.Background(), &comments); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode comments"})
+	if err := cursor.All(ctx, &comments); err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to decode comments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"comments": comments,
+		"page":     pageNum,
+		"limit":    limitNum,
+		"total":    totalCount,
+	})
+}
+
+// GetMentions lists the comments that mention the caller, newest first.
+func (cc *CommentController) GetMentions(c *gin.Context) {
+	userID, _, _, ok := author(c)
+	if !ok {
+		return
+	}
+
+	pageNum, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || pageNum < 1 {
+		pageNum = 1
+	}
+
+	limitNum, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limitNum < 1 || limitNum > 100 {
+		limitNum = 10
+	}
+
+	skip := (pageNum - 1) * limitNum
+	filter := bson.M{"mentions": userID}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	totalCount, err := cc.Collection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to count comments"})
+		return
+	}
+
+	cursor, err := cc.Collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "date", Value: -1}}).
+		SetSkip(int64(skip)).
+		SetLimit(int64(limitNum)))
+	if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to fetch comments"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	comments := []models.Comment{}
+	if err := cursor.All(ctx, &comments); err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to decode comments"})
 		return
 	}
 
@@ -128,16 +440,20 @@ func (cc *CommentController) GetCommentByID(c *gin.Context) {
 		return
 	}
 
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
 	var comment models.Comment
-	err = cc.Collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&comment)
+	err = cc.Collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&comment)
 	if err == mongo.ErrNoDocuments {
 		c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
 		return
 	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch comment"})
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to fetch comment"})
 		return
 	}
 
+	etag.Set(c, comment.Version)
 	c.JSON(http.StatusOK, comment)
 }
 
@@ -149,9 +465,8 @@ func (cc *CommentController) UpdateComment(c *gin.Context) {
 		return
 	}
 
-	userRole, exists := c.Get("userRole")
-	if !exists {
-		c.JSON(http.StatusForbidden, gin.H{"error": "user role not found"})
+	userID, _, role, ok := author(c)
+	if !ok {
 		return
 	}
 
@@ -162,36 +477,92 @@ func (cc *CommentController) UpdateComment(c *gin.Context) {
 		return
 	}
 
-	var updatedComment models.Comment
-	if err := c.ShouldBindJSON(&updatedComment); err != nil {
+	var req UpdateCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if userRole.(int) != 1 {
-		c.JSON(http.StatusForbidden, gin.H{"error": "only users with Role 1 can update comments"})
+	title := strings.TrimSpace(req.Title)
+	if len(title) < 2 || len(title) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "title must be between 2 and 255 characters"})
 		return
 	}
 
-	if err := updatedComment.Validate(); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	// Staff may edit any comment, everyone else only their own.
+	filter := bson.M{"_id": objectID}
+	if role != userModels.RoleStaff {
+		filter["user_id"] = userID
 	}
 
-	updatedComment.Date = time.Now()
+	description := strings.TrimSpace(req.Description)
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	var current models.Comment
+	if err := cc.Collection.FindOne(ctx, filter).Decode(&current); err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+		return
+	} else if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to fetch comment"})
+		return
+	}
+	if !etag.Check(c, current.Version) {
+		return
+	}
 
-	update := bson.M{"$set": updatedComment}
-	result, err := cc.Collection.UpdateOne(context.Background(), bson.M{"_id": objectID}, update)
+	mentions, err := cc.resolveMentions(ctx, description)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update comment"})
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to resolve mentions"})
 		return
 	}
 
-	if result.ModifiedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "comment not found or no changes made"})
+	now := time.Now()
+	update := bson.M{"$set": bson.M{
+		"title":             title,
+		"description":       description,
+		"mentions":          mentions,
+		"updated_at":        now,
+		etag.ModifiedField: now,
+	}}
+
+	// The previous version tells us who was already mentioned, so an edit
+	// only notifies people it newly mentions.
+	var updatedComment models.Comment
+	err = cc.Collection.FindOneAndUpdate(ctx, etag.Match(filter, current.Version), etag.Bump(update),
+		options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(&updatedComment)
+	if err == mongo.ErrNoDocuments {
+		etag.Conflict(c)
 		return
+	} else if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to update comment"})
+		return
+	}
+
+	alreadyMentioned := map[primitive.ObjectID]bool{}
+	for _, id := range updatedComment.Mentions {
+		alreadyMentioned[id] = true
+	}
+	var newlyMentioned []primitive.ObjectID
+	for _, id := range mentions {
+		if !alreadyMentioned[id] {
+			newlyMentioned = append(newlyMentioned, id)
+		}
 	}
 
+	before := updatedComment
+	updatedComment.Title = title
+	updatedComment.Description = description
+	updatedComment.Mentions = mentions
+	updatedComment.UpdatedAt = &now
+	updatedComment.ModifiedAt = now
+	updatedComment.Version++
+	events.Publish(events.EntityComment, events.Updated, objectID, cc.ownerOf(ctx, updatedComment), updatedComment)
+	audit.Record(c, audit.EntityComment, audit.Updated, objectID, before, updatedComment)
+	cc.notify(ctx, updatedComment, notificationModels.TypeMention,
+		c.GetString("username")+" mentioned you: "+updatedComment.Title, newlyMentioned)
+
+	etag.Set(c, updatedComment.Version)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Comment updated successfully",
 		"id":      objectID.Hex(),
@@ -204,13 +575,9 @@ func (cc *CommentController) DeleteComment(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized: " + err.Error()})
 		return
 	}
-	userRole, exists := c.Get("userRole")
-	if !exists {
-		c.JSON(http.StatusForbidden, gin.H{"error": "user role not found"})
-		return
-	}
-	if userRole.(int) != 1 {
-		c.JSON(http.StatusForbidden, gin.H{"error": "only users with Role 1 can delete comments"})
+
+	userID, _, role, ok := author(c)
+	if !ok {
 		return
 	}
 
@@ -221,19 +588,54 @@ func (cc *CommentController) DeleteComment(c *gin.Context) {
 		return
 	}
 
-	result, err := cc.Collection.DeleteOne(context.Background(), bson.M{"_id": objectID})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete comment"})
-		return
+	// Staff may delete any comment, everyone else only their own.
+	filter := bson.M{"_id": objectID}
+	if role != userModels.RoleStaff {
+		filter["user_id"] = userID
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	// With If-Match the comment is only deleted while it is still the
+	// version the client saw.
+	conditional := etag.Conditional(c)
+	if conditional {
+		var current models.Comment
+		err = cc.Collection.FindOne(ctx, filter).Decode(&current)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+			return
+		} else if err != nil {
+			c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to fetch comment"})
+			return
+		}
+		if !etag.Check(c, current.Version) {
+			return
+		}
+		filter = etag.Match(filter, current.Version)
 	}
 
-	if result.DeletedCount == 0 {
+	var deleted models.Comment
+	err = cc.Collection.FindOneAndDelete(ctx, filter).Decode(&deleted)
+	if err == mongo.ErrNoDocuments {
+		if conditional {
+			etag.Conflict(c)
+			return
+		}
 		c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
 		return
+	} else if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to delete comment"})
+		return
 	}
+	owner := cc.ownerOf(ctx, deleted)
+	events.Publish(events.EntityComment, events.Deleted, objectID, owner, nil)
+	audit.Record(c, audit.EntityComment, audit.Deleted, objectID, deleted, nil)
+	tombstone.Record(events.EntityComment, objectID, owner, tombstone.Deleted)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Comment deleted successfully",
 		"id":      objectID.Hex(),
 	})
-}
\ No newline at end of file
+}
@@ -0,0 +1,399 @@
+package CommissionControllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Arkariza/API_MyActivity/audit"
+	"github.com/Arkariza/API_MyActivity/auth/middleware"
+	database "github.com/Arkariza/API_MyActivity/models"
+	"github.com/Arkariza/API_MyActivity/models/Commission"
+	userModels "github.com/Arkariza/API_MyActivity/models/User"
+	"github.com/Arkariza/API_MyActivity/respond"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CommissionController struct {
+	rules       *mongo.Collection
+	commissions *mongo.Collection
+}
+
+func NewCommissionController(rules, commissions *mongo.Collection) *CommissionController {
+	return &CommissionController{
+		rules:       rules,
+		commissions: commissions,
+	}
+}
+
+type CreateRuleRequest struct {
+	Name       string  `json:"name" binding:"required"`
+	Kind       string  `json:"kind" binding:"required,oneof=flat percentage"`
+	Value      float64 `json:"value" binding:"required,gt=0"`
+	MinPremium float64 `json:"min_premium" binding:"omitempty,min=0"`
+	// EffectiveFrom defaults to now.
+	EffectiveFrom *time.Time `json:"effective_from,omitempty"`
+}
+
+type UpdateRuleRequest struct {
+	Name       string   `json:"name"`
+	Value      *float64 `json:"value,omitempty" binding:"omitempty,gt=0"`
+	MinPremium *float64 `json:"min_premium,omitempty" binding:"omitempty,min=0"`
+	Active     *bool    `json:"active,omitempty"`
+}
+
+type PayCommissionRequest struct {
+	PaymentRef string `json:"payment_ref" binding:"required"`
+}
+
+// StatementTotal sums the commissions in one status.
+type StatementTotal struct {
+	Count  int64   `bson:"count" json:"count"`
+	Amount float64 `bson:"amount" json:"amount"`
+}
+
+func requireStaff(c *gin.Context, message string) bool {
+	if c.GetInt("userRole") != userModels.RoleStaff {
+		c.JSON(http.StatusForbidden, gin.H{"error": message})
+		return false
+	}
+	return true
+}
+
+// CreateRule adds a commission rule. Staff only.
+func (cc *CommissionController) CreateRule(c *gin.Context) {
+	userID, _, ok := AuthMiddleware.CurrentUser(c)
+	if !ok || !requireStaff(c, "Only staff can manage commission rules") {
+		return
+	}
+	var req CreateRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid request payload", err)
+		return
+	}
+	if req.Kind == models.RulePercentage && req.Value > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A percentage rule cannot exceed 100"})
+		return
+	}
+
+	now := time.Now()
+	rule := models.Rule{
+		ID:            primitive.NewObjectID(),
+		Name:          req.Name,
+		Kind:          req.Kind,
+		Value:         req.Value,
+		MinPremium:    req.MinPremium,
+		EffectiveFrom: now,
+		Active:        true,
+		CreatedBy:     userID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if req.EffectiveFrom != nil {
+		rule.EffectiveFrom = *req.EffectiveFrom
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	if _, err := cc.rules.InsertOne(ctx, rule); err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to create commission rule", err)
+		return
+	}
+	audit.Record(c, audit.EntityCommissionRule, audit.Created, rule.ID, nil, rule)
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Commission rule has been created",
+		"data":    rule,
+	})
+}
+
+// GetRules lists the active rules, highest tier first. Staff may pass
+// all=true to include inactive ones.
+func (cc *CommissionController) GetRules(c *gin.Context) {
+	_, role, ok := AuthMiddleware.CurrentUser(c)
+	if !ok {
+		return
+	}
+	filter := bson.M{"active": true}
+	if role == userModels.RoleStaff && c.Query("all") == "true" {
+		filter = bson.M{}
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	cursor, err := cc.rules.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "min_premium", Value: -1}, {Key: "effective_from", Value: -1}}))
+	if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to fetch commission rules", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	rules := []models.Rule{}
+	if err := cursor.All(ctx, &rules); err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to parse commission rules", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rules})
+}
+
+// UpdateRule renames, re-prices or (de)activates a rule. Staff only.
+// Commissions already accrued keep the rule value they were computed with.
+func (cc *CommissionController) UpdateRule(c *gin.Context) {
+	if !requireStaff(c, "Only staff can manage commission rules") {
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid rule ID", err)
+		return
+	}
+	var req UpdateRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid request payload", err)
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	var rule models.Rule
+	if err := cc.rules.FindOne(ctx, bson.M{"_id": id}).Decode(&rule); err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commission rule not found"})
+		return
+	} else if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to fetch commission rule", err)
+		return
+	}
+	if req.Value != nil && rule.Kind == models.RulePercentage && *req.Value > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A percentage rule cannot exceed 100"})
+		return
+	}
+
+	set := bson.M{"updated_at": time.Now()}
+	if req.Name != "" {
+		set["name"] = req.Name
+	}
+	if req.Value != nil {
+		set["value"] = *req.Value
+	}
+	if req.MinPremium != nil {
+		set["min_premium"] = *req.MinPremium
+	}
+	if req.Active != nil {
+		set["active"] = *req.Active
+	}
+	before := rule
+	err = cc.rules.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&rule)
+	if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to update commission rule", err)
+		return
+	}
+	audit.Record(c, audit.EntityCommissionRule, audit.Updated, rule.ID, before, rule)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Commission rule has been updated",
+		"data":    rule,
+	})
+}
+
+// GetStatement lists a user's commissions, newest first, with the count and
+// amount in each status. Users see their own; staff may pass user_id or
+// leave it out to see everyone's.
+func (cc *CommissionController) GetStatement(c *gin.Context) {
+	userID, role, ok := AuthMiddleware.CurrentUser(c)
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	filter := bson.M{"referrer_id": userID}
+	if role == userModels.RoleStaff {
+		filter = bson.M{}
+		if raw := c.Query("user_id"); raw != "" {
+			referrerID, err := primitive.ObjectIDFromHex(raw)
+			if err != nil {
+				respond.Error(c, http.StatusBadRequest, "Invalid user ID", err)
+				return
+			}
+			filter["referrer_id"] = referrerID
+		}
+	}
+	accrued := bson.M{}
+	for param, operator := range map[string]string{"from": "$gte", "to": "$lt"} {
+		if raw := c.Query(param); raw != "" {
+			parsed, err := time.Parse("2006-01-02", raw)
+			if err != nil {
+				respond.Error(c, http.StatusBadRequest, "Invalid "+param+" date, expected YYYY-MM-DD", err)
+				return
+			}
+			if param == "to" {
+				parsed = parsed.AddDate(0, 0, 1)
+			}
+			accrued[operator] = parsed
+		}
+	}
+	if len(accrued) > 0 {
+		filter["accrued_at"] = accrued
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	totals, err := cc.totals(ctx, filter)
+	if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to total commissions", err)
+		return
+	}
+
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+	total, err := cc.commissions.CountDocuments(ctx, filter)
+	if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to count commissions", err)
+		return
+	}
+	cursor, err := cc.commissions.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "accrued_at", Value: -1}}).
+		SetSkip(int64((page-1)*limit)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to fetch commissions", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	commissions := []models.Commission{}
+	if err := cursor.All(ctx, &commissions); err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to parse commissions", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":   commissions,
+		"totals": totals,
+		"page":   page,
+		"limit":  limit,
+		"total":  total,
+	})
+}
+
+func (cc *CommissionController) totals(ctx context.Context, filter bson.M) (map[string]StatementTotal, error) {
+	cursor, err := cc.commissions.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    "$status",
+			"count":  bson.M{"$sum": 1},
+			"amount": bson.M{"$sum": "$amount"},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	totals := map[string]StatementTotal{
+		models.StatusAccrued:   {},
+		models.StatusApproved:  {},
+		models.StatusPaid:      {},
+		models.StatusCancelled: {},
+	}
+	for cursor.Next(ctx) {
+		var group struct {
+			Status         string `bson:"_id"`
+			StatementTotal `bson:",inline"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return nil, err
+		}
+		totals[group.Status] = group.StatementTotal
+	}
+	return totals, cursor.Err()
+}
+
+// transition moves a commission from one status to the next, writing the
+// response either way.
+func (cc *CommissionController) transition(c *gin.Context, from string, set bson.M, message string) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid commission ID", err)
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	var before models.Commission
+	if err := cc.commissions.FindOne(ctx, bson.M{"_id": id}).Decode(&before); err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commission not found"})
+		return
+	} else if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to fetch commission", err)
+		return
+	}
+
+	// The status is checked again in the update so that a concurrent
+	// transition is detected.
+	var commission models.Commission
+	err = cc.commissions.FindOneAndUpdate(ctx, bson.M{"_id": id, "status": from}, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&commission)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusConflict, gin.H{"error": "Commission is not " + from})
+		return
+	} else if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to update commission", err)
+		return
+	}
+	audit.Record(c, audit.EntityCommission, audit.Updated, commission.ID, before, commission)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"data":    commission,
+	})
+}
+
+// ApproveCommission confirms an accrued commission for payment. Staff only.
+func (cc *CommissionController) ApproveCommission(c *gin.Context) {
+	userID, _, ok := AuthMiddleware.CurrentUser(c)
+	if !ok || !requireStaff(c, "Only staff can approve commissions") {
+		return
+	}
+	cc.transition(c, models.StatusAccrued, bson.M{
+		"status":      models.StatusApproved,
+		"approved_at": time.Now(),
+		"approved_by": userID,
+	}, "Commission has been approved")
+}
+
+// PayCommission records the payment of an approved commission. Staff only.
+func (cc *CommissionController) PayCommission(c *gin.Context) {
+	userID, _, ok := AuthMiddleware.CurrentUser(c)
+	if !ok || !requireStaff(c, "Only staff can pay commissions") {
+		return
+	}
+	var req PayCommissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid request payload", err)
+		return
+	}
+	cc.transition(c, models.StatusApproved, bson.M{
+		"status":      models.StatusPaid,
+		"paid_at":     time.Now(),
+		"paid_by":     userID,
+		"payment_ref": req.PaymentRef,
+	}, "Commission has been paid")
+}
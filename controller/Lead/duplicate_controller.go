@@ -0,0 +1,400 @@
+package LeadController
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Arkariza/API_MyActivity/audit"
+	"github.com/Arkariza/API_MyActivity/commission"
+	"github.com/Arkariza/API_MyActivity/etag"
+	"github.com/Arkariza/API_MyActivity/events"
+	database "github.com/Arkariza/API_MyActivity/models"
+	attachmentModels "github.com/Arkariza/API_MyActivity/models/Attachment"
+	commentModels "github.com/Arkariza/API_MyActivity/models/CallAndMeet"
+	"github.com/Arkariza/API_MyActivity/models/ManageLead"
+	notificationModels "github.com/Arkariza/API_MyActivity/models/Notification"
+	userModels "github.com/Arkariza/API_MyActivity/models/User"
+	"github.com/Arkariza/API_MyActivity/tombstone"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DuplicatePhone = "phone"
+	DuplicateName  = "name"
+
+	maxDuplicateCandidates = 200
+	maxDuplicateGroups     = 100
+	// maxLeadsPerGroup keeps a group well under the 16MB document limit
+	// however many leads share a key.
+	maxLeadsPerGroup = 50
+)
+
+// duplicateFields are the lead fields shown when reviewing duplicates.
+var duplicateFields = bson.M{
+	"_id":         "$_id",
+	"user_id":     "$user_id",
+	"numphone":    "$numphone",
+	"clientname":  "$clientname",
+	"priority":    "$priority",
+	"type_lead":   "$type_lead",
+	"status":      "$status",
+	"created_at":  "$created_at",
+	"referrer_id": "$referrer_id",
+	"version":     "$version",
+}
+
+// LinkedCollections hold the records that point at a lead. They follow the
+// surviving lead when two leads are merged.
+type LinkedCollections struct {
+	Calls       *mongo.Collection
+	Meets       *mongo.Collection
+	Tasks       *mongo.Collection
+	Comments    *mongo.Collection
+	Attachments *mongo.Collection
+}
+
+// DuplicateMatch is an existing lead that looks like the same client.
+type DuplicateMatch struct {
+	LeadID     primitive.ObjectID `json:"lead_id"`
+	ClientName string             `json:"client_name"`
+	NumPhone   string             `json:"num_phone"`
+	OwnerID    primitive.ObjectID `json:"owner_id"`
+	OwnerName  string             `json:"owner_name"`
+	Reason     string             `json:"reason"`
+	Score      float64            `json:"score"`
+}
+
+// DuplicateGroup lists the oldest leads sharing a key, at most
+// maxLeadsPerGroup of them, with only the fields needed to pick which to
+// keep. Count is the size of the whole group.
+type DuplicateGroup struct {
+	Reason string        `json:"reason"`
+	Count  int           `json:"count"`
+	Leads  []models.Lead `json:"leads"`
+}
+
+type MergeLeadRequest struct {
+	DuplicateID string `json:"duplicate_id" binding:"required,mongodb"`
+}
+
+// findDuplicates returns the leads other than exclude that share the lead's
+// phone key, or whose client name is at least DuplicateNameThreshold alike.
+// Every phone match is returned; names are only compared against at most
+// maxDuplicateCandidates leads starting with the same word, which keeps the
+// lookup on the name_key index.
+func (lc *LeadController) findDuplicates(ctx context.Context, lead models.Lead, exclude primitive.ObjectID) ([]DuplicateMatch, error) {
+	var candidates []models.Lead
+	if lead.PhoneKey != "" {
+		found, err := lc.findLeads(ctx, bson.M{"phone_key": lead.PhoneKey, "_id": bson.M{"$ne": exclude}}, options.Find())
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, found...)
+	}
+	if lead.NameKey != "" {
+		firstWord := strings.Fields(lead.NameKey)[0]
+		filter := bson.M{"name_key": bson.M{"$regex": "^" + regexp.QuoteMeta(firstWord)}, "_id": bson.M{"$ne": exclude}}
+		if lead.PhoneKey != "" {
+			filter["phone_key"] = bson.M{"$ne": lead.PhoneKey}
+		}
+		found, err := lc.findLeads(ctx, filter, options.Find().SetLimit(maxDuplicateCandidates))
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, found...)
+	}
+
+	matches := []DuplicateMatch{}
+	owners := map[primitive.ObjectID]string{}
+	for _, candidate := range candidates {
+		match := DuplicateMatch{
+			LeadID:     candidate.ID,
+			ClientName: candidate.ClientName,
+			NumPhone:   candidate.NumPhone,
+			OwnerID:    candidate.UserID,
+		}
+		if lead.PhoneKey != "" && candidate.PhoneKey == lead.PhoneKey {
+			match.Reason, match.Score = DuplicatePhone, 1
+		} else if score := models.NameSimilarity(lead.NameKey, candidate.NameKey); score >= models.DuplicateNameThreshold {
+			match.Reason, match.Score = DuplicateName, score
+		} else {
+			continue
+		}
+		owners[candidate.UserID] = ""
+		matches = append(matches, match)
+	}
+
+	if err := lc.ownerNames(ctx, owners); err != nil {
+		return nil, err
+	}
+	for i := range matches {
+		matches[i].OwnerName = owners[matches[i].OwnerID]
+	}
+	return matches, nil
+}
+
+func (lc *LeadController) findLeads(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.Lead, error) {
+	cursor, err := lc.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var leads []models.Lead
+	if err := cursor.All(ctx, &leads); err != nil {
+		return nil, err
+	}
+	return leads, nil
+}
+
+// ownerNames fills in the username of each user ID key.
+func (lc *LeadController) ownerNames(ctx context.Context, owners map[primitive.ObjectID]string) error {
+	if len(owners) == 0 {
+		return nil
+	}
+	ids := make([]primitive.ObjectID, 0, len(owners))
+	for id := range owners {
+		ids = append(ids, id)
+	}
+
+	cursor, err := lc.users.Find(ctx, bson.M{"_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"username": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user struct {
+			ID       primitive.ObjectID `bson:"_id"`
+			Username string             `bson:"username"`
+		}
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+		owners[user.ID] = user.Username
+	}
+	return cursor.Err()
+}
+
+// GetDuplicates reports groups of leads sharing a phone number or an exactly
+// matching client name, largest first. Only staff may see it. Each group
+// shows its oldest leads only, so a key shared by thousands of leads cannot
+// push a group past the document size limit.
+func (lc *LeadController) GetDuplicates(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != userModels.RoleStaff {
+		handleError(c, http.StatusForbidden, "Only staff can review duplicate leads", nil)
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	groups := []DuplicateGroup{}
+	for _, key := range []struct{ field, reason string }{
+		{"phone_key", DuplicatePhone},
+		{"name_key", DuplicateName},
+	} {
+		cursor, err := lc.collection.Aggregate(ctx, []bson.M{
+			{"$match": bson.M{key.field: bson.M{"$nin": []interface{}{nil, ""}}}},
+			{"$sort": bson.M{"created_at": 1}},
+			{"$group": bson.M{"_id": "$" + key.field, "leads": bson.M{"$push": duplicateFields}, "count": bson.M{"$sum": 1}}},
+			{"$match": bson.M{"count": bson.M{"$gt": 1}}},
+			{"$sort": bson.M{"count": -1}},
+			{"$limit": maxDuplicateGroups},
+			{"$project": bson.M{"count": 1, "leads": bson.M{"$slice": bson.A{"$leads", maxLeadsPerGroup}}}},
+		}, options.Aggregate().SetAllowDiskUse(true))
+		if err != nil {
+			handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to find duplicate leads", err)
+			return
+		}
+
+		var found []struct {
+			Count int           `bson:"count"`
+			Leads []models.Lead `bson:"leads"`
+		}
+		err = cursor.All(ctx, &found)
+		cursor.Close(ctx)
+		if err != nil {
+			handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to decode duplicate leads", err)
+			return
+		}
+		for _, group := range found {
+			groups = append(groups, DuplicateGroup{Reason: key.reason, Count: group.Count, Leads: group.Leads})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"groups": groups,
+		"total":  len(groups),
+	})
+}
+
+// MergeLead folds the duplicate lead into the lead in the path: calls, meets,
+// tasks, comments, attachments and the referral commission are moved over,
+// empty fields are filled from the duplicate, and the duplicate is deleted.
+// Only staff may merge. A won duplicate can only be merged into a won lead,
+// and two leads that both have a live commission cannot be merged.
+func (lc *LeadController) MergeLead(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != userModels.RoleStaff {
+		handleError(c, http.StatusForbidden, "Only staff can merge leads", nil)
+		return
+	}
+
+	primaryID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid lead ID format", err)
+		return
+	}
+	var req MergeLeadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid input", err)
+		return
+	}
+	duplicateID, _ := primitive.ObjectIDFromHex(req.DuplicateID)
+	if duplicateID == primaryID {
+		handleError(c, http.StatusBadRequest, "A lead cannot be merged into itself", nil)
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	var primary, duplicate models.Lead
+	for _, lookup := range []struct {
+		id   primitive.ObjectID
+		into *models.Lead
+	}{{primaryID, &primary}, {duplicateID, &duplicate}} {
+		if err := lc.collection.FindOne(ctx, bson.M{"_id": lookup.id}).Decode(lookup.into); err != nil {
+			if err == mongo.ErrNoDocuments {
+				handleError(c, http.StatusNotFound, fmt.Sprintf("Lead %s not found", lookup.id.Hex()), nil)
+				return
+			}
+			handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to fetch lead", err)
+			return
+		}
+	}
+	if !etag.Check(c, primary.Version) {
+		return
+	}
+
+	if duplicate.Status == models.StatusWin && primary.Status != models.StatusWin {
+		handleError(c, http.StatusConflict, "The duplicate lead is won, merge the other lead into it instead", nil)
+		return
+	}
+
+	// Linked records move first: if a step fails, retrying the merge picks
+	// up where it stopped and nothing is left pointing at a deleted lead.
+	// Moving a versioned record is a change to it, so its version goes up.
+	moves := []struct {
+		collection *mongo.Collection
+		filter     bson.M
+		field      string
+		versioned  bool
+	}{
+		{lc.linked.Calls, bson.M{"lead_id": duplicateID}, "lead_id", true},
+		{lc.linked.Meets, bson.M{"lead_id": duplicateID}, "lead_id", true},
+		{lc.linked.Tasks, bson.M{"lead_id": duplicateID}, "lead_id", false},
+		{lc.linked.Comments, bson.M{"entity_type": commentModels.CommentOnLead, "entity_id": duplicateID}, "entity_id", true},
+		{lc.linked.Attachments, bson.M{"entity_type": attachmentModels.AttachOnLead, "entity_id": duplicateID}, "entity_id", false},
+	}
+	dropped, err := lc.ledger.Move(ctx, duplicateID, primaryID)
+	if errors.Is(err, commission.ErrBothEarned) {
+		handleError(c, http.StatusConflict, "Both leads have a commission, cancel one before merging", err)
+		return
+	} else if err != nil {
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to move the commission to the merged lead", err)
+		return
+	}
+	if dropped != nil {
+		audit.Record(c, audit.EntityCommission, audit.Deleted, dropped.ID, dropped, nil)
+	}
+
+	moved := map[string]int64{}
+	for _, move := range moves {
+		var update interface{} = bson.M{"$set": bson.M{move.field: primaryID}}
+		if move.versioned {
+			update = etag.Bump(update)
+		}
+		result, err := move.collection.UpdateMany(ctx, move.filter, update)
+		if err != nil {
+			handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to move records to the merged lead", err)
+			return
+		}
+		moved[move.collection.Name()] = result.ModifiedCount
+	}
+
+	fields := bson.M{}
+	if primary.Information == "" {
+		fields["information"] = duplicate.Information
+	} else if duplicate.Information != "" && duplicate.Information != primary.Information {
+		fields["information"] = primary.Information + "\n" + duplicate.Information
+	}
+	if primary.NoPolicy == 0 && duplicate.NoPolicy != 0 {
+		fields["no_policy"] = duplicate.NoPolicy
+	}
+	if primary.Location == nil && duplicate.Location != nil {
+		fields["location"] = duplicate.Location
+		fields["latitude"] = duplicate.Latitude
+		fields["longitude"] = duplicate.Longitude
+	}
+	if primary.DateSubmit.IsZero() && !duplicate.DateSubmit.IsZero() {
+		fields["date_submit"] = duplicate.DateSubmit
+	}
+	if primary.ReferrerID == nil && duplicate.ReferrerID != nil {
+		fields["referrer_id"] = duplicate.ReferrerID
+	}
+	if primary.Premium == 0 && duplicate.Premium != 0 {
+		fields["premium"] = duplicate.Premium
+	}
+	update := bson.M{"$addToSet": bson.M{"merged_from": bson.M{"$each": append(duplicate.MergedFrom, duplicateID)}}}
+	if len(fields) > 0 {
+		update["$set"] = fields
+	}
+
+	var merged models.Lead
+	err = lc.collection.FindOneAndUpdate(ctx, etag.Match(bson.M{"_id": primaryID}, primary.Version), etag.Bump(update),
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&merged)
+	if err == mongo.ErrNoDocuments {
+		etag.Conflict(c)
+		return
+	} else if err != nil {
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to update merged lead", err)
+		return
+	}
+	if _, err := lc.collection.DeleteOne(ctx, bson.M{"_id": duplicateID}); err != nil {
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to delete duplicate lead", err)
+		return
+	}
+	events.Publish(events.EntityLead, events.Updated, merged.ID, merged.UserID, merged)
+	events.Publish(events.EntityLead, events.Deleted, duplicateID, duplicate.UserID, nil)
+	audit.Record(c, audit.EntityLead, audit.Updated, merged.ID, primary, merged)
+	audit.Record(c, audit.EntityLead, audit.Deleted, duplicateID, duplicate, nil)
+	tombstone.Record(events.EntityLead, duplicateID, duplicate.UserID, tombstone.Deleted)
+
+	if duplicate.UserID != merged.UserID {
+		_, err := lc.notifier.Notify(ctx, duplicate.UserID, notificationModels.TypeLeadMerged,
+			"Lead merged", fmt.Sprintf("%s was merged into a lead owned by another user", duplicate.ClientName),
+			map[string]string{"lead_id": merged.ID.Hex(), "merged_id": duplicateID.Hex()},
+		)
+		if err != nil {
+			log.Printf("Error notifying user %s about merged lead %s: %v", duplicate.UserID.Hex(), duplicateID.Hex(), err)
+		}
+	}
+
+	etag.Set(c, merged.Version)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Leads have been merged",
+		"data":    merged,
+		"moved":   moved,
+	})
+}
@@ -0,0 +1,542 @@
+package LeadController
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Arkariza/API_MyActivity/audit"
+	"github.com/Arkariza/API_MyActivity/events"
+	"github.com/Arkariza/API_MyActivity/geo"
+	"github.com/Arkariza/API_MyActivity/metrics"
+	database "github.com/Arkariza/API_MyActivity/models"
+	"github.com/Arkariza/API_MyActivity/models/ManageLead"
+	userModels "github.com/Arkariza/API_MyActivity/models/User"
+	"github.com/Arkariza/API_MyActivity/phone"
+	"github.com/Arkariza/API_MyActivity/spreadsheet"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxImportBytes  = 20 << 20
+	importBatchSize = 100
+)
+
+// importColumns are the models.LeadInput fields a spreadsheet column can be
+// mapped to, by json name, and referrerId, the BFA user who referred a Reff
+// lead.
+var importColumns = []string{
+	"numPhone", "priority", "latitude", "longitude", "clientName",
+	"typeLead", "noPolicy", "information", "status", "referrerId",
+}
+
+// ImportPreview is the dry-run report: what an import of the file would do.
+type ImportPreview struct {
+	Total      int                     `json:"total"`
+	Valid      int                     `json:"valid"`
+	Duplicates int                     `json:"duplicates"`
+	Invalid    int                     `json:"invalid"`
+	Errors     []models.ImportRowError `json:"errors"`
+}
+
+// importRow is one spreadsheet row converted to a lead input. errors is empty
+// when the row passed validation.
+type importRow struct {
+	line     int
+	input    models.LeadInput
+	referrer *primitive.ObjectID
+	errors   []models.ImportRowError
+}
+
+// parseMapping reads the optional "mapping" form field, a JSON object from
+// LeadInput field to spreadsheet header, e.g. {"numPhone": "Phone No"}.
+// Unmapped fields are looked up by their own name. explicit tells which
+// fields were mapped by the caller, whose columns must then exist.
+func parseMapping(raw string) (mapping map[string]string, explicit map[string]bool, err error) {
+	mapping = map[string]string{}
+	explicit = map[string]bool{}
+	if strings.TrimSpace(raw) != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			return nil, nil, fmt.Errorf("mapping must be a JSON object of field to column: %w", err)
+		}
+	}
+	for field := range mapping {
+		known := false
+		for _, column := range importColumns {
+			known = known || column == field
+		}
+		if !known {
+			return nil, nil, fmt.Errorf("unknown field %q in mapping, expected one of: %s", field, strings.Join(importColumns, ", "))
+		}
+		explicit[field] = true
+	}
+	for _, field := range importColumns {
+		if _, ok := mapping[field]; !ok {
+			mapping[field] = field
+		}
+	}
+	return mapping, explicit, nil
+}
+
+// importRows converts the table to lead inputs and validates each of them
+// against the same rules as models.LeadInput. Duplicate phone numbers within
+// the file are reported here; duplicates of existing leads need the database.
+func importRows(table *spreadsheet.Table, mapping map[string]string, explicit map[string]bool) ([]importRow, error) {
+	columns := map[string]int{}
+	for _, field := range importColumns {
+		index := table.Column(mapping[field])
+		if index < 0 && explicit[field] {
+			return nil, fmt.Errorf("column %q mapped to %s is not in the header", mapping[field], field)
+		}
+		columns[field] = index
+	}
+	value := func(row spreadsheet.Row, field string) string {
+		if columns[field] < 0 {
+			return ""
+		}
+		return row.Values[columns[field]]
+	}
+
+	rows := make([]importRow, 0, len(table.Rows))
+	seen := map[string]int{}
+	for _, record := range table.Rows {
+		row := importRow{line: record.Line}
+		fail := func(field, message string) {
+			row.errors = append(row.errors, models.ImportRowError{Row: record.Line, Field: field, Message: message})
+		}
+
+		row.input = models.LeadInput{
+			NumPhone:    value(record, "numPhone"),
+			Priority:    value(record, "priority"),
+			ClientName:  value(record, "clientName"),
+			TypeLead:    value(record, "typeLead"),
+			Information: value(record, "information"),
+			Status:      value(record, "status"),
+		}
+		for field, target := range map[string]*float64{"latitude": &row.input.Latitude, "longitude": &row.input.Longitude} {
+			if raw := value(record, field); raw != "" {
+				parsed, err := strconv.ParseFloat(strings.ReplaceAll(raw, ",", "."), 64)
+				if err != nil {
+					fail(field, "must be a number")
+				}
+				*target = parsed
+			}
+		}
+		if raw := value(record, "noPolicy"); raw != "" {
+			parsed, err := strconv.ParseInt(raw, 10, 32)
+			if err != nil {
+				fail("noPolicy", "must be a whole number")
+			}
+			row.input.NoPolicy = int32(parsed)
+		}
+
+		if err := binding.Validator.ValidateStruct(&row.input); err != nil {
+			if fieldErrors, ok := err.(validator.ValidationErrors); ok {
+				for _, fieldError := range fieldErrors {
+					if fieldError.Tag() == "required" {
+						fail(jsonField(fieldError.StructField()), "is required")
+					} else {
+						fail(jsonField(fieldError.StructField()), "failed the "+fieldError.Tag()+" check")
+					}
+				}
+			} else {
+				fail("", err.Error())
+			}
+		}
+
+		if row.input.NumPhone != "" {
+			if numPhone, err := phone.Normalize(row.input.NumPhone); err != nil {
+				fail("numPhone", "is not a valid phone number")
+			} else {
+				row.input.NumPhone = numPhone
+			}
+		}
+
+		lead := models.Lead{Status: row.input.Status, TypeLead: row.input.TypeLead}
+		if row.input.Status != "" && !lead.ValidateStatus() {
+			fail("status", "must be one of: Pending, Win, Lose, Open")
+		} else if lead.Status == models.StatusWin || lead.Status == models.StatusLose {
+			// Closing a lead records when it closed and settles the referral
+			// commission, which only the status endpoint does.
+			fail("status", "must be Pending or Open; close imported leads through the status endpoint")
+		}
+		if row.input.TypeLead != "" && !lead.ValidateTypeLead() {
+			fail("typeLead", "must be one of: Reff, Self")
+		}
+		// Staff import the leads, so the referrer who earns the commission
+		// on a Reff lead has to be named in the file.
+		switch raw := value(record, "referrerId"); {
+		case row.input.TypeLead != models.TypeReferral:
+			if raw != "" {
+				fail("referrerId", "only applies to Reff leads")
+			}
+		case raw == "":
+			fail("referrerId", "is required for Reff leads")
+		default:
+			if referrer, err := primitive.ObjectIDFromHex(raw); err != nil {
+				fail("referrerId", "must be a user ID")
+			} else {
+				row.referrer = &referrer
+			}
+		}
+		if !geo.ValidCoordinates(row.input.Latitude, row.input.Longitude) {
+			fail("latitude", "coordinates are out of range")
+		}
+
+		if key := models.PhoneKey(row.input.NumPhone); key != "" {
+			if first, ok := seen[key]; ok {
+				fail("numPhone", fmt.Sprintf("duplicate of row %d", first))
+			} else {
+				seen[key] = record.Line
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// jsonField maps a LeadInput struct field to its json name for row errors.
+func jsonField(structField string) string {
+	if field, ok := reflect.TypeOf(models.LeadInput{}).FieldByName(structField); ok {
+		return strings.Split(field.Tag.Get("json"), ",")[0]
+	}
+	return structField
+}
+
+// checkReferrers fails the rows whose referrer is not a BFA user, the only
+// users who refer leads.
+func (lc *LeadController) checkReferrers(ctx context.Context, rows []importRow) error {
+	referrers := map[primitive.ObjectID]bool{}
+	for _, row := range rows {
+		if row.referrer != nil {
+			referrers[*row.referrer] = false
+		}
+	}
+	if len(referrers) == 0 {
+		return nil
+	}
+	ids := make([]primitive.ObjectID, 0, len(referrers))
+	for id := range referrers {
+		ids = append(ids, id)
+	}
+
+	found, err := lc.users.Distinct(ctx, "_id", bson.M{"_id": bson.M{"$in": ids}, "role": userModels.RoleBFA})
+	if err != nil {
+		return err
+	}
+	for _, id := range found {
+		if id, ok := id.(primitive.ObjectID); ok {
+			referrers[id] = true
+		}
+	}
+	for i := range rows {
+		if rows[i].referrer != nil && !referrers[*rows[i].referrer] {
+			rows[i].errors = append(rows[i].errors, models.ImportRowError{Row: rows[i].line, Field: "referrerId", Message: "is not a BFA user"})
+		}
+	}
+	return nil
+}
+
+// existingPhones returns which of the phone keys already belong to a lead.
+func (lc *LeadController) existingPhones(ctx context.Context, phones []string) (map[string]bool, error) {
+	existing := map[string]bool{}
+	if len(phones) == 0 {
+		return existing, nil
+	}
+
+	cursor, err := lc.collection.Find(ctx, bson.M{"phone_key": bson.M{"$in": phones}},
+		options.Find().SetProjection(bson.M{"phone_key": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var lead struct {
+			PhoneKey string `bson:"phone_key"`
+		}
+		if err := cursor.Decode(&lead); err != nil {
+			return nil, err
+		}
+		existing[lead.PhoneKey] = true
+	}
+	return existing, cursor.Err()
+}
+
+// ImportLeads accepts a CSV or XLSX file of leads (multipart field "file").
+// With dry_run=true it only reports what would happen; otherwise it starts a
+// background job and returns it for polling. Only staff may import.
+func (lc *LeadController) ImportLeads(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != userModels.RoleStaff {
+		handleError(c, http.StatusForbidden, "Only staff can import leads", nil)
+		return
+	}
+	userID, _ := c.Get("UserID")
+	ownerID, err := primitive.ObjectIDFromHex(fmt.Sprint(userID))
+	if err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid user ID format", err)
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		handleError(c, http.StatusBadRequest, "A CSV or XLSX file is required in the \"file\" field", err)
+		return
+	}
+	defer file.Close()
+
+	format, err := spreadsheet.FormatOf(header.Filename)
+	if err != nil {
+		handleError(c, http.StatusUnsupportedMediaType, "Unsupported file", err)
+		return
+	}
+	table, err := spreadsheet.Read(file, format)
+	if err != nil {
+		handleError(c, http.StatusBadRequest, "Failed to read file", err)
+		return
+	}
+
+	mapping, explicit, err := parseMapping(c.PostForm("mapping"))
+	if err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid mapping", err)
+		return
+	}
+
+	rows, err := importRows(table, mapping, explicit)
+	if err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid mapping", err)
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+	if err := lc.checkReferrers(ctx, rows); err != nil {
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to check referrers", err)
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(c.PostForm("dry_run"))
+	if dryRun {
+		lc.previewImport(c, rows)
+		return
+	}
+
+	job := models.ImportJob{
+		ID:        primitive.NewObjectID(),
+		UserID:    ownerID,
+		FileName:  header.Filename,
+		Status:    models.ImportPending,
+		Total:     len(rows),
+		Errors:    []models.ImportRowError{},
+		CreatedAt: time.Now(),
+	}
+
+	if _, err := lc.imports.InsertOne(ctx, job); err != nil {
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to start import", err)
+		return
+	}
+	source := audit.SourceOf(c)
+	audit.RecordFrom(source, audit.EntityLeadImport, audit.Created, job.ID, nil, job)
+
+	go lc.runImport(job, rows, source)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Import started",
+		"data":    job,
+	})
+}
+
+func (lc *LeadController) previewImport(c *gin.Context, rows []importRow) {
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	preview := ImportPreview{Total: len(rows), Errors: []models.ImportRowError{}}
+	var phones []string
+	for _, row := range rows {
+		if len(row.errors) == 0 {
+			phones = append(phones, models.PhoneKey(row.input.NumPhone))
+		}
+	}
+	existing, err := lc.existingPhones(ctx, phones)
+	if err != nil {
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to check for duplicates", err)
+		return
+	}
+
+	for _, row := range rows {
+		switch {
+		case len(row.errors) > 0:
+			preview.Invalid++
+			if len(preview.Errors) < models.MaxImportErrors {
+				preview.Errors = append(preview.Errors, row.errors...)
+			}
+		case existing[models.PhoneKey(row.input.NumPhone)]:
+			preview.Duplicates++
+			preview.Errors = append(preview.Errors, models.ImportRowError{Row: row.line, Field: "numPhone", Message: "a lead with this phone number already exists"})
+		default:
+			preview.Valid++
+		}
+	}
+	if len(preview.Errors) > models.MaxImportErrors {
+		preview.Errors = preview.Errors[:models.MaxImportErrors]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Dry run, nothing was imported",
+		"data":    preview,
+	})
+}
+
+// runImport inserts the valid rows in batches, skipping phone numbers that
+// already have a lead, and records progress on the job after every batch.
+// It runs after the request has finished, so it uses its own contexts.
+// runImport attributes the leads it creates to source, the request that
+// started the import.
+func (lc *LeadController) runImport(job models.ImportJob, rows []importRow, source audit.Source) {
+	job.Status = models.ImportRunning
+	lc.saveImport(&job)
+
+	for start := 0; start < len(rows); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		if err := lc.importBatch(&job, rows[start:end], source); err != nil {
+			log.Printf("Lead import %s failed: %v", job.ID.Hex(), err)
+			job.Status = models.ImportFailed
+			job.Failure = err.Error()
+			break
+		}
+		job.Processed = end
+		if end < len(rows) {
+			lc.saveImport(&job)
+		}
+	}
+
+	if job.Status != models.ImportFailed {
+		job.Status = models.ImportDone
+	}
+	finished := time.Now()
+	job.FinishedAt = &finished
+	lc.saveImport(&job)
+}
+
+func (lc *LeadController) importBatch(job *models.ImportJob, rows []importRow, source audit.Source) error {
+	ctx, cancel := database.QueryContext(context.Background())
+	defer cancel()
+
+	var phones []string
+	for _, row := range rows {
+		if len(row.errors) == 0 {
+			phones = append(phones, models.PhoneKey(row.input.NumPhone))
+		}
+	}
+	existing, err := lc.existingPhones(ctx, phones)
+	if err != nil {
+		return err
+	}
+
+	var leads []interface{}
+	var ids []primitive.ObjectID
+	for _, row := range rows {
+		switch {
+		case len(row.errors) > 0:
+			job.Invalid++
+			for _, rowError := range row.errors {
+				job.AddError(rowError.Row, rowError.Field, rowError.Message)
+			}
+		case existing[models.PhoneKey(row.input.NumPhone)]:
+			job.Duplicates++
+			job.AddError(row.line, "numPhone", "a lead with this phone number already exists")
+		default:
+			lead := models.Lead{
+				UserID:      job.UserID,
+				NumPhone:    row.input.NumPhone,
+				Priority:    row.input.Priority,
+				Latitude:    row.input.Latitude,
+				Longitude:   row.input.Longitude,
+				ClientName:  row.input.ClientName,
+				TypeLead:    row.input.TypeLead,
+				NoPolicy:    row.input.NoPolicy,
+				Information: row.input.Information,
+				Status:      row.input.Status,
+				ReferrerID:  row.referrer,
+				Location:    geo.NewPoint(row.input.Latitude, row.input.Longitude),
+				Version:     1,
+			}
+			lead.BeforeCreate()
+			leads = append(leads, lead)
+			ids = append(ids, lead.ID)
+		}
+	}
+	if len(leads) == 0 {
+		return nil
+	}
+
+	if _, err := lc.collection.InsertMany(ctx, leads); err != nil {
+		return err
+	}
+	job.Created += len(leads)
+	for _, created := range leads {
+		lead := created.(models.Lead)
+		metrics.LeadsCreated.WithLabelValues(lead.Status).Inc()
+		events.Publish(events.EntityLead, events.Created, lead.ID, lead.UserID, lead)
+	}
+	audit.RecordCreated(source, audit.EntityLead, ids, leads)
+	return nil
+}
+
+// saveImport stores the job's progress and announces it on the activity
+// stream, where the importing user can follow along.
+func (lc *LeadController) saveImport(job *models.ImportJob) {
+	ctx, cancel := database.QueryContext(context.Background())
+	defer cancel()
+
+	if _, err := lc.imports.ReplaceOne(ctx, bson.M{"_id": job.ID}, job); err != nil {
+		log.Printf("Error saving lead import %s: %v", job.ID.Hex(), err)
+	}
+	events.Publish(events.EntityLeadImport, events.Updated, job.ID, job.UserID, job)
+}
+
+// GetImport returns the progress of one of the caller's import jobs.
+func (lc *LeadController) GetImport(c *gin.Context) {
+	userID, _ := c.Get("UserID")
+	ownerID, err := primitive.ObjectIDFromHex(fmt.Sprint(userID))
+	if err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid user ID format", err)
+		return
+	}
+	jobID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid import ID format", err)
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	var job models.ImportJob
+	err = lc.imports.FindOne(ctx, bson.M{"_id": jobID, "user_id": ownerID}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		handleError(c, http.StatusNotFound, "Import not found", nil)
+		return
+	} else if err != nil {
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to fetch import", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": job})
+}
@@ -2,37 +2,72 @@ package LeadController
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Arkariza/API_MyActivity/audit"
+	"github.com/Arkariza/API_MyActivity/commission"
+	"github.com/Arkariza/API_MyActivity/etag"
+	"github.com/Arkariza/API_MyActivity/events"
+	"github.com/Arkariza/API_MyActivity/geo"
+	"github.com/Arkariza/API_MyActivity/metrics"
+	database "github.com/Arkariza/API_MyActivity/models"
+	commentModels "github.com/Arkariza/API_MyActivity/models/CallAndMeet"
 	"github.com/Arkariza/API_MyActivity/models/ManageLead"
+	notificationModels "github.com/Arkariza/API_MyActivity/models/Notification"
+	userModels "github.com/Arkariza/API_MyActivity/models/User"
+	"github.com/Arkariza/API_MyActivity/notify"
+	"github.com/Arkariza/API_MyActivity/phone"
+	"github.com/Arkariza/API_MyActivity/spreadsheet"
+	"github.com/Arkariza/API_MyActivity/tombstone"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type LeadController struct {
 	collection *mongo.Collection
+	users      *mongo.Collection
+	imports    *mongo.Collection
+	linked     LinkedCollections
+	notifier   *notify.Notifier
+	ledger     *commission.Ledger
 }
 
-func NewLeadController(collection *mongo.Collection) *LeadController {
-	return &LeadController{collection: collection}
+func NewLeadController(collection, users, imports *mongo.Collection, linked LinkedCollections, notifier *notify.Notifier, ledger *commission.Ledger) *LeadController {
+	return &LeadController{collection: collection, users: users, imports: imports, linked: linked, notifier: notifier, ledger: ledger}
 }
 
 type AddLeadRequest struct {
 	UserID      primitive.ObjectID `json:"user_id"`
 	ClientName  string             `json:"clientname" binding:"required"`
-	NumPhone    string             `json:"numphone" binding:"required"`
+	NumPhone    string             `json:"numphone" binding:"required,phone"`
 	Priority    string             `json:"priority" binding:"required"`
 	Information string             `json:"information"`
 	Status      string             `json:"status"`
 	TypeLead    string             `json:"type_lead"`
+	Latitude    float64            `json:"latitude"`
+	Longitude   float64            `json:"longitude"`
+	// Force lets staff create a lead despite possible duplicates.
+	Force bool `json:"force"`
+}
+
+type AssignLeadRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+}
+
+type NearbyLead struct {
+	models.Lead `bson:",inline"`
+	Distance    float64 `bson:"distance" json:"distance"`
 }
 
 func ValidateLeadInput() gin.HandlerFunc {
@@ -59,22 +94,25 @@ func ValidateLeadInput() gin.HandlerFunc {
 }
 
 func (lc *LeadController) GetAllLead(c *gin.Context) {
-    cursor, err := lc.collection.Find(context.Background(), bson.M{})
+    ctx, cancel := database.QueryContext(c.Request.Context())
+    defer cancel()
+
+    cursor, err := lc.collection.Find(ctx, bson.M{})
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch leads"})
+        c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to fetch leads"})
         return
     }
-    defer cursor.Close(context.Background())
+    defer cursor.Close(ctx)
 
     var leads []models.Lead
-    if err := cursor.All(context.Background(), &leads); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode leads"})
+    if err := cursor.All(ctx, &leads); err != nil {
+        c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to decode leads"})
         return
     }
 
-    totalCount, err := lc.collection.CountDocuments(context.Background(), bson.M{})
+    totalCount, err := lc.collection.CountDocuments(ctx, bson.M{})
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count leads"})
+        c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to count leads"})
         return
     }
 
@@ -84,6 +122,233 @@ func (lc *LeadController) GetAllLead(c *gin.Context) {
     })
 }
 
+// GetLeadByID returns one lead with its version as the ETag, which updates
+// to the lead must send back in If-Match.
+func (lc *LeadController) GetLeadByID(c *gin.Context) {
+    leadID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        handleError(c, http.StatusBadRequest, "Invalid lead ID format", err)
+        return
+    }
+
+    ctx, cancel := database.QueryContext(c.Request.Context())
+    defer cancel()
+
+    var lead models.Lead
+    if err := lc.collection.FindOne(ctx, bson.M{"_id": leadID}).Decode(&lead); err == mongo.ErrNoDocuments {
+        handleError(c, http.StatusNotFound, "Lead not found", nil)
+        return
+    } else if err != nil {
+        handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to fetch lead", err)
+        return
+    }
+
+    etag.Set(c, lead.Version)
+    c.JSON(http.StatusOK, gin.H{"data": lead})
+}
+
+
+var leadExportColumns = []spreadsheet.Column{
+	{Key: "id", Title: "ID"},
+	{Key: "client_name", Title: "Client Name"},
+	{Key: "num_phone", Title: "Phone Number"},
+	{Key: "priority", Title: "Priority"},
+	{Key: "status", Title: "Status"},
+	{Key: "type_lead", Title: "Type"},
+	{Key: "no_policy", Title: "Policy Number"},
+	{Key: "information", Title: "Information"},
+	{Key: "latitude", Title: "Latitude"},
+	{Key: "longitude", Title: "Longitude"},
+	{Key: "user_id", Title: "Owner"},
+	{Key: "date_submit", Title: "Date Submitted"},
+	{Key: "created_at", Title: "Created At"},
+}
+
+// ExportLeads streams every lead, like GetAllLead, as CSV, XLSX or NDJSON.
+func (lc *LeadController) ExportLeads(c *gin.Context) {
+    spreadsheet.Download(c, "leads", leadExportColumns, func(write func([]interface{}) error) error {
+        // An export can take longer than QueryTimeout, so it is bounded
+        // by the request instead.
+        ctx := c.Request.Context()
+        cursor, err := lc.collection.Find(ctx, bson.M{}, options.Find().
+            SetSort(bson.D{{Key: "created_at", Value: -1}}).
+            SetBatchSize(500))
+        if err != nil {
+            return err
+        }
+        defer cursor.Close(ctx)
+
+        for cursor.Next(ctx) {
+            var lead models.Lead
+            if err := cursor.Decode(&lead); err != nil {
+                return err
+            }
+            err := write([]interface{}{
+                lead.ID.Hex(), lead.ClientName, lead.NumPhone, lead.Priority,
+                lead.Status, lead.TypeLead, lead.NoPolicy, lead.Information,
+                lead.Latitude, lead.Longitude, lead.UserID.Hex(), lead.DateSubmit, lead.CreateAt,
+            })
+            if err != nil {
+                return err
+            }
+        }
+        return cursor.Err()
+    })
+}
+
+// NearbyLeads returns the caller's leads within radius meters of lat/lng,
+// nearest first.
+func (lc *LeadController) NearbyLeads(c *gin.Context) {
+    lat, lng, radius, err := geo.ParseNear(c.Query("lat"), c.Query("lng"), c.Query("radius"))
+    if err != nil {
+        handleError(c, http.StatusBadRequest, "Invalid nearby query", err)
+        return
+    }
+
+    userID, _ := c.Get("UserID")
+    ownerID, err := primitive.ObjectIDFromHex(fmt.Sprint(userID))
+    if err != nil {
+        handleError(c, http.StatusBadRequest, "Invalid user ID format", err)
+        return
+    }
+
+    limit := 50
+    if parsed, err := strconv.Atoi(c.Query("limit")); err == nil && parsed > 0 && parsed <= 200 {
+        limit = parsed
+    }
+
+    ctx, cancel := database.QueryContext(c.Request.Context())
+    defer cancel()
+
+    pipeline := []interface{}{
+        geo.NearStage(lat, lng, radius, bson.M{"user_id": ownerID}),
+        bson.M{"$limit": limit},
+    }
+    cursor, err := lc.collection.Aggregate(ctx, pipeline)
+    if err != nil {
+        handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to search nearby leads", err)
+        return
+    }
+    defer cursor.Close(ctx)
+
+    leads := []NearbyLead{}
+    if err := cursor.All(ctx, &leads); err != nil {
+        handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to decode leads", err)
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "leads":  leads,
+        "radius": radius,
+    })
+}
+
+// AssignLead hands a lead over to another user and notifies them. Only staff
+// may reassign leads.
+func (lc *LeadController) AssignLead(c *gin.Context) {
+    role, _ := c.Get("Role")
+    if role != userModels.RoleStaff {
+        handleError(c, http.StatusForbidden, "Only staff can reassign leads", nil)
+        return
+    }
+
+    leadID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        handleError(c, http.StatusBadRequest, "Invalid lead ID format", err)
+        return
+    }
+
+    var req AssignLeadRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        handleError(c, http.StatusBadRequest, "Invalid input", err)
+        return
+    }
+    assigneeID, err := primitive.ObjectIDFromHex(req.UserID)
+    if err != nil {
+        handleError(c, http.StatusBadRequest, "Invalid user ID format", err)
+        return
+    }
+
+    ctx, cancel := database.QueryContext(c.Request.Context())
+    defer cancel()
+
+    var assignee userModels.User
+    if err := lc.users.FindOne(ctx, bson.M{"_id": assigneeID}).Decode(&assignee); err != nil {
+        if err == mongo.ErrNoDocuments {
+            handleError(c, http.StatusNotFound, "User not found", nil)
+            return
+        }
+        handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to fetch user", err)
+        return
+    }
+
+    var before models.Lead
+    if err := lc.collection.FindOne(ctx, bson.M{"_id": leadID}).Decode(&before); err == mongo.ErrNoDocuments {
+        handleError(c, http.StatusNotFound, "Lead not found", nil)
+        return
+    } else if err != nil {
+        handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to fetch lead", err)
+        return
+    }
+    if !etag.Check(c, before.Version) {
+        return
+    }
+
+    var lead models.Lead
+    err = lc.collection.FindOneAndUpdate(ctx,
+        etag.Match(bson.M{"_id": leadID}, before.Version),
+        etag.Bump(bson.M{"$set": bson.M{"user_id": assigneeID}}),
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&lead)
+    if err == mongo.ErrNoDocuments {
+        etag.Conflict(c)
+        return
+    } else if err != nil {
+        handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to reassign lead", err)
+        return
+    }
+    events.Publish(events.EntityLead, events.Updated, lead.ID, lead.UserID, lead)
+    audit.Record(c, audit.EntityLead, audit.Updated, lead.ID, before, lead)
+
+    // The previous owner's devices drop the lead and the comments on it, and
+    // the comments are marked changed so that the new owner's devices pick
+    // them up.
+    if before.UserID != lead.UserID {
+        tombstone.Record(events.EntityLead, lead.ID, before.UserID, tombstone.Reassigned)
+        onLead := bson.M{"entity_type": commentModels.CommentOnLead, "entity_id": lead.ID}
+        if commentIDs, err := lc.linked.Comments.Distinct(ctx, "_id", onLead); err != nil {
+            log.Printf("Error listing comments on lead %s: %v", lead.ID.Hex(), err)
+        } else {
+            ids := make([]primitive.ObjectID, 0, len(commentIDs))
+            for _, id := range commentIDs {
+                if id, ok := id.(primitive.ObjectID); ok {
+                    ids = append(ids, id)
+                }
+            }
+            tombstone.RecordAll(events.EntityComment, ids, before.UserID, tombstone.Reassigned)
+        }
+        _, err := lc.linked.Comments.UpdateMany(ctx, onLead,
+            bson.M{"$set": bson.M{etag.ModifiedField: time.Now()}},
+        )
+        if err != nil {
+            log.Printf("Error marking comments on lead %s as changed: %v", lead.ID.Hex(), err)
+        }
+    }
+
+    _, err = lc.notifier.Notify(ctx, assigneeID, notificationModels.TypeLeadReassigned,
+        "Lead assigned to you", fmt.Sprintf("%s has been assigned to you", lead.ClientName),
+        map[string]string{"lead_id": lead.ID.Hex()},
+    )
+    if err != nil {
+        log.Printf("Error notifying user %s about lead %s: %v", assigneeID.Hex(), lead.ID.Hex(), err)
+    }
+
+    etag.Set(c, lead.Version)
+    c.JSON(http.StatusOK, gin.H{
+        "message": "Lead has been reassigned",
+        "data":    lead,
+    })
+}
 
 func validateToken(c *gin.Context) (string, error) {
 	authHeader := c.GetHeader("Authorization")
@@ -137,17 +402,31 @@ func (cc *LeadController) AddLead(c *gin.Context, req AddLeadRequest) (*models.L
         handleError(c, http.StatusForbidden, "User role or ID missing", nil)
         return nil, errors.New("user role or ID missing")
     }
+    numPhone, err := phone.Normalize(req.NumPhone)
+    if err != nil {
+        handleError(c, http.StatusBadRequest, "Invalid phone number", err)
+        return nil, err
+    }
     lead := models.Lead{
         ID:          primitive.NewObjectID(),
         UserID:      req.UserID,
-        NumPhone:    req.NumPhone,
+        NumPhone:    numPhone,
         Priority:    req.Priority,
-        Latitude:    0,
-        Longitude:   0,
+        Latitude:    req.Latitude,
+        Longitude:   req.Longitude,
         CreateAt:    time.Now(),
         DateSubmit:  time.Time{},
         ClientName:  req.ClientName,
         Information: req.Information,
+        Version:     1,
+        ModifiedAt:  time.Now(),
+    }
+    if req.Latitude != 0 || req.Longitude != 0 {
+        if !geo.ValidCoordinates(req.Latitude, req.Longitude) {
+            handleError(c, http.StatusBadRequest, "Invalid coordinates", nil)
+            return nil, errors.New("invalid coordinates")
+        }
+        lead.Location = geo.NewPoint(req.Latitude, req.Longitude)
     }
     switch userRole.(int) {
     case 1:
@@ -166,11 +445,35 @@ func (cc *LeadController) AddLead(c *gin.Context, req AddLeadRequest) (*models.L
         return nil, parseErr
     }
     lead.UserID = parsedID
-    _, dbErr := cc.collection.InsertOne(c, lead)
+    if lead.TypeLead == models.TypeReferral {
+        lead.ReferrerID = &parsedID
+    }
+    lead.SetKeys()
+    ctx, cancel := database.QueryContext(c.Request.Context())
+    defer cancel()
+
+    duplicates, err := cc.findDuplicates(ctx, lead, lead.ID)
+    if err != nil {
+        handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to check for duplicate leads", err)
+        return nil, err
+    }
+    if len(duplicates) > 0 && !(req.Force && userRole.(int) == userModels.RoleStaff) {
+        c.JSON(http.StatusConflict, gin.H{
+            "error":      "This client may already be registered",
+            "duplicates": duplicates,
+        })
+        return nil, errors.New("duplicate lead")
+    }
+
+    _, dbErr := cc.collection.InsertOne(ctx, lead)
     if dbErr != nil {
-        handleError(c, http.StatusInternalServerError, "Failed to save lead", dbErr)
+        handleError(c, database.ErrorStatus(dbErr, http.StatusInternalServerError), "Failed to save lead", dbErr)
         return nil, dbErr
     }
+    metrics.LeadsCreated.WithLabelValues(lead.Status).Inc()
+    events.Publish(events.EntityLead, events.Created, lead.ID, lead.UserID, lead)
+    audit.Record(c, audit.EntityLead, audit.Created, lead.ID, nil, lead)
+    etag.Set(c, lead.Version)
     return &lead, nil
 }
 
@@ -0,0 +1,152 @@
+package LeadController
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Arkariza/API_MyActivity/audit"
+	"github.com/Arkariza/API_MyActivity/commission"
+	"github.com/Arkariza/API_MyActivity/etag"
+	"github.com/Arkariza/API_MyActivity/events"
+	database "github.com/Arkariza/API_MyActivity/models"
+	"github.com/Arkariza/API_MyActivity/models/ManageLead"
+	notificationModels "github.com/Arkariza/API_MyActivity/models/Notification"
+	userModels "github.com/Arkariza/API_MyActivity/models/User"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type UpdateLeadStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=Pending Open Win Lose"`
+	// Premium is the policy premium in rupiah, needed to win a referral lead
+	// unless it was recorded before.
+	Premium  float64 `json:"premium" binding:"omitempty,min=0"`
+	NoPolicy int32   `json:"no_policy"`
+}
+
+// UpdateLeadStatus moves a lead through its pipeline. Closing it as Win or
+// Lose records when; reopening clears that. Winning a referral lead accrues
+// the referrer's commission, and a won lead that is reopened or lost has an
+// unapproved commission cancelled. Staff and the lead's owner may do this.
+func (lc *LeadController) UpdateLeadStatus(c *gin.Context) {
+	leadID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid lead ID format", err)
+		return
+	}
+	var req UpdateLeadStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid input", err)
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	var lead models.Lead
+	if err := lc.collection.FindOne(ctx, bson.M{"_id": leadID}).Decode(&lead); err == mongo.ErrNoDocuments {
+		handleError(c, http.StatusNotFound, "Lead not found", nil)
+		return
+	} else if err != nil {
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to fetch lead", err)
+		return
+	}
+	role, _ := c.Get("Role")
+	userID, _ := c.Get("UserID")
+	if role != userModels.RoleStaff && lead.UserID.Hex() != userID {
+		handleError(c, http.StatusForbidden, "Only staff or the lead's owner can change its status", nil)
+		return
+	}
+	if !etag.Check(c, lead.Version) {
+		return
+	}
+
+	premium := lead.Premium
+	if req.Premium > 0 {
+		premium = req.Premium
+	}
+	if req.Status == models.StatusWin && lead.ReferrerID != nil && premium == 0 {
+		handleError(c, http.StatusBadRequest, "A premium is required to win a referral lead", nil)
+		return
+	}
+
+	set := bson.M{"status": req.Status}
+	unset := bson.M{}
+	if req.Premium > 0 {
+		set["premium"] = req.Premium
+	}
+	if req.NoPolicy != 0 {
+		set["no_policy"] = req.NoPolicy
+	}
+	switch {
+	case req.Status == lead.Status:
+	case req.Status == models.StatusWin || req.Status == models.StatusLose:
+		set["closed_at"] = time.Now()
+	default:
+		unset["closed_at"] = ""
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	// Decode into a fresh value so that unset fields do not linger.
+	before := lead
+	lead = models.Lead{}
+	err = lc.collection.FindOneAndUpdate(ctx, etag.Match(bson.M{"_id": leadID}, before.Version), etag.Bump(update),
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&lead)
+	if err == mongo.ErrNoDocuments {
+		etag.Conflict(c)
+		return
+	} else if err != nil {
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to update lead status", err)
+		return
+	}
+	events.Publish(events.EntityLead, events.Updated, lead.ID, lead.UserID, lead)
+	audit.Record(c, audit.EntityLead, audit.Updated, lead.ID, before, lead)
+
+	response := gin.H{
+		"message": "Lead status has been updated",
+		"data":    lead,
+	}
+	if lead.Status == models.StatusWin {
+		earned, replaced, accrued, err := lc.ledger.Accrue(ctx, lead)
+		switch {
+		case errors.Is(err, commission.ErrNoRule):
+			log.Printf("No commission rule for won lead %s", lead.ID.Hex())
+		case err != nil:
+			// Setting the status again retries the accrual.
+			handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Lead updated but the commission could not be recorded", err)
+			return
+		case earned != nil:
+			response["commission"] = earned
+		}
+		if accrued {
+			if replaced != nil {
+				audit.Record(c, audit.EntityCommission, audit.Updated, earned.ID, replaced, earned)
+			} else {
+				audit.Record(c, audit.EntityCommission, audit.Created, earned.ID, nil, earned)
+			}
+			_, err := lc.notifier.Notify(ctx, earned.ReferrerID, notificationModels.TypeCommission,
+				"Commission earned", fmt.Sprintf("%s was won, earning you a commission of Rp%.0f", lead.ClientName, earned.Amount),
+				map[string]string{"lead_id": lead.ID.Hex(), "commission_id": earned.ID.Hex()},
+			)
+			if err != nil {
+				log.Printf("Error notifying referrer %s about commission %s: %v", earned.ReferrerID.Hex(), earned.ID.Hex(), err)
+			}
+		}
+	} else if previous, cancelled, err := lc.ledger.Cancel(ctx, lead.ID); err != nil {
+		log.Printf("Error cancelling commission for lead %s: %v", lead.ID.Hex(), err)
+	} else if cancelled != nil {
+		audit.Record(c, audit.EntityCommission, audit.Updated, cancelled.ID, previous, cancelled)
+	}
+
+	etag.Set(c, lead.Version)
+	c.JSON(http.StatusOK, response)
+}
@@ -1,15 +1,25 @@
 package MeetControllers
 
 import (
-	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Arkariza/API_MyActivity/audit"
+	"github.com/Arkariza/API_MyActivity/etag"
+	"github.com/Arkariza/API_MyActivity/events"
+	"github.com/Arkariza/API_MyActivity/geo"
+	"github.com/Arkariza/API_MyActivity/metrics"
+	database "github.com/Arkariza/API_MyActivity/models"
 	"github.com/Arkariza/API_MyActivity/models/CallAndMeet"
+	"github.com/Arkariza/API_MyActivity/phone"
+	"github.com/Arkariza/API_MyActivity/spreadsheet"
+	"github.com/Arkariza/API_MyActivity/tombstone"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -19,22 +29,81 @@ import (
 
 type MeetController struct {
 	collection *mongo.Collection
+	location   *time.Location
 }
 
 func NewMeetController(collection *mongo.Collection) *MeetController {
+	location, err := time.LoadLocation(routeTimeZone)
+	if err != nil {
+		location = time.UTC
+	}
 	return &MeetController{
 		collection: collection,
+		location:   location,
 	}
 }
 
 type AddMeetRequest struct {
 	ClientName string  `json:"client_name" binding:"required,min=2,max=100"`
-	PhoneNum   string  `json:"phone_num" binding:"required"`
+	PhoneNum   string  `json:"phone_num" binding:"required,phone"`
 	Latitude   float64 `json:"latitude" binding:"required"`
 	Longitude  float64 `json:"longitude" binding:"required"`
 	Address    string  `json:"address" binding:"required"`
 	Date 	   time.Time `json:"date" binding:"required"`
+	FixedTime  bool    `json:"fixed_time"`
 	Note       string  `json:"note"`
+	LeadID     string  `json:"lead_id" binding:"omitempty,mongodb"`
+}
+
+type UpdateMeetRequest struct {
+	ClientName     string   `json:"client_name" binding:"omitempty,min=2,max=100"`
+	PhoneNum       string   `json:"phone_num" binding:"omitempty,phone"`
+	Address        string   `json:"address"`
+	Latitude       *float64 `json:"latitude"`
+	Longitude      *float64 `json:"longitude"`
+	ProspectStatus string   `json:"prospect_status" binding:"omitempty,oneof=potential active inactive"`
+	Note           string   `json:"note"`
+	FixedTime      *bool    `json:"fixed_time"`
+}
+
+type CompleteMeetRequest struct {
+	MeetResult string `json:"meet_result" binding:"required"`
+	Note       string `json:"note"`
+}
+
+type CancelMeetRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type RescheduleMeetRequest struct {
+	Date      time.Time `json:"date" binding:"required"`
+	FixedTime *bool     `json:"fixed_time"`
+	Reason    string    `json:"reason"`
+}
+
+type NearbyMeet struct {
+	models.Meet `bson:",inline"`
+	Distance    float64 `bson:"distance" json:"distance"`
+}
+
+type VisitRequest struct {
+	Latitude  float64 `json:"latitude" binding:"required"`
+	Longitude float64 `json:"longitude" binding:"required"`
+	Accuracy  float64 `json:"accuracy" binding:"min=0"`
+}
+
+const (
+	checkInRadiusEnvKey  = "MEET_CHECKIN_RADIUS_METERS"
+	defaultCheckInRadius = 200.0
+)
+
+func checkInRadius() float64 {
+	if value := os.Getenv(checkInRadiusEnvKey); value != "" {
+		if radius, err := strconv.ParseFloat(value, 64); err == nil && radius > 0 {
+			return radius
+		}
+	}
+	return defaultCheckInRadius
 }
 
 func parsePagination(c *gin.Context) (int, int) {
@@ -79,27 +148,43 @@ func (mc *MeetController) AddMeet(c *gin.Context, req AddMeetRequest) (*models.M
 
 	meet := models.Meet{
 		ClientName:     req.ClientName,
-		PhoneNum:       req.PhoneNum,
+		PhoneNum:       phone.Format(req.PhoneNum),
 		Latitude:       req.Latitude,
 		Longitude:      req.Longitude,
 		Note:           req.Note,
 		Address:        req.Address,
 		Date: 			req.Date,
+		FixedTime:      req.FixedTime,
 		CreatedAt:      time.Now(),
 		ProspectStatus: "potential",
+		Status:         models.MeetScheduled,
+		Location:       geo.NewPoint(req.Latitude, req.Longitude),
+		Version:        1,
+		ModifiedAt:     time.Now(),
+	}
+	if userID, exists := c.Get("user_id"); exists {
+		if ownerID, err := primitive.ObjectIDFromHex(userID.(string)); err == nil {
+			meet.UserID = ownerID
+		}
+	}
+	if leadID, err := primitive.ObjectIDFromHex(req.LeadID); err == nil {
+		meet.LeadID = &leadID
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := database.QueryContext(c.Request.Context())
 	defer cancel()
 
 	result, err := mc.collection.InsertOne(ctx, meet)
 	if err != nil {
-		handleError(c, http.StatusInternalServerError, "Failed to create meet", err)
-		return nil, fmt.Errorf("failed to create meet: %v", err)
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to create meet", err)
+		return nil, fmt.Errorf("failed to create meet: %w", err)
 	}
 
 	meet.ID = result.InsertedID.(primitive.ObjectID)
+	events.Publish(events.EntityMeet, events.Created, meet.ID, meet.UserID, meet)
+	audit.Record(c, audit.EntityMeet, audit.Created, meet.ID, nil, meet)
 
+	etag.Set(c, meet.Version)
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Meet created successfully",
 		"data":    meet,
@@ -109,10 +194,8 @@ func (mc *MeetController) AddMeet(c *gin.Context, req AddMeetRequest) (*models.M
 }
 
 
-func (mc *MeetController) ViewMeets(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
+// meetFilter builds the filter shared by ViewMeets and ExportMeets.
+func meetFilter(c *gin.Context) bson.M {
 	status := c.Query("status")
 	clientName := c.Query("client_name")
 
@@ -123,6 +206,70 @@ func (mc *MeetController) ViewMeets(c *gin.Context) {
 	if clientName != "" {
 		filter["client_name"] = bson.M{"$regex": clientName, "$options": "i"}
 	}
+	if c.Query("flagged") == "true" {
+		filter["visit_flagged"] = true
+	}
+	return filter
+}
+
+var meetExportColumns = []spreadsheet.Column{
+	{Key: "id", Title: "ID"},
+	{Key: "client_name", Title: "Client Name"},
+	{Key: "phone_num", Title: "Phone Number"},
+	{Key: "address", Title: "Address"},
+	{Key: "prospect_status", Title: "Prospect Status"},
+	{Key: "status", Title: "Status"},
+	{Key: "meet_result", Title: "Meet Result"},
+	{Key: "note", Title: "Note"},
+	{Key: "date", Title: "Date"},
+	{Key: "completed_at", Title: "Completed At"},
+	{Key: "visit_duration_seconds", Title: "Visit Duration (s)"},
+	{Key: "visit_flagged", Title: "Visit Flagged"},
+	{Key: "latitude", Title: "Latitude"},
+	{Key: "longitude", Title: "Longitude"},
+	{Key: "created_at", Title: "Created At"},
+}
+
+// ExportMeets streams every meet matching the ViewMeets filters as CSV, XLSX
+// or NDJSON.
+func (mc *MeetController) ExportMeets(c *gin.Context) {
+	filter := meetFilter(c)
+	spreadsheet.Download(c, "meets", meetExportColumns, func(write func([]interface{}) error) error {
+		// An export can take longer than QueryTimeout, so it is bounded
+		// by the request instead.
+		ctx := c.Request.Context()
+		cursor, err := mc.collection.Find(ctx, filter, options.Find().
+			SetSort(bson.M{"created_at": -1}).
+			SetBatchSize(500))
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+
+		for cursor.Next(ctx) {
+			var meet models.Meet
+			if err := cursor.Decode(&meet); err != nil {
+				return err
+			}
+			err := write([]interface{}{
+				meet.ID.Hex(), meet.ClientName, meet.PhoneNum, meet.Address,
+				meet.ProspectStatus, meet.Status, meet.MeetResult, meet.Note,
+				meet.Date, meet.CompletedAt, meet.VisitDuration, meet.VisitFlagged,
+				meet.Latitude, meet.Longitude, meet.CreatedAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return cursor.Err()
+	})
+}
+
+func (mc *MeetController) ViewMeets(c *gin.Context) {
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	filter := meetFilter(c)
 
 	page, limit := parsePagination(c)
 	skip := (page - 1) * limit
@@ -134,20 +281,20 @@ func (mc *MeetController) ViewMeets(c *gin.Context) {
 
 	cursor, err := mc.collection.Find(ctx, filter, findOptions)
 	if err != nil {
-		handleError(c, http.StatusInternalServerError, "Failed to retrieve meets", err)
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to retrieve meets", err)
 		return
 	}
 	defer cursor.Close(ctx)
 
 	var meets []models.Meet
 	if err = cursor.All(ctx, &meets); err != nil {
-		handleError(c, http.StatusInternalServerError, "Failed to parse meets", err)
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to parse meets", err)
 		return
 	}
 
 	total, err := mc.collection.CountDocuments(ctx, filter)
 	if err != nil {
-		handleError(c, http.StatusInternalServerError, "Failed to count meets", err)
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to count meets", err)
 		return
 	}
 
@@ -169,34 +316,102 @@ func (mc *MeetController) UpdateMeet(c *gin.Context) {
 		return
 	}
 
-	var updatedMeet models.Meet
-	if err := c.ShouldBindJSON(&updatedMeet); err != nil {
+	var req UpdateMeetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		handleError(c, http.StatusBadRequest, "Invalid request payload", err)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	fields := bson.M{}
+	if req.ClientName != "" {
+		fields["client_name"] = strings.TrimSpace(req.ClientName)
+	}
+	if req.PhoneNum != "" {
+		fields["phone_num"] = phone.Format(req.PhoneNum)
+	}
+	if req.Address != "" {
+		fields["address"] = strings.TrimSpace(req.Address)
+	}
+	if req.Latitude != nil {
+		if *req.Latitude < -90 || *req.Latitude > 90 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid latitude, must be between -90 and 90"})
+			return
+		}
+		fields["latitude"] = *req.Latitude
+	}
+	if req.Longitude != nil {
+		if *req.Longitude < -180 || *req.Longitude > 180 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid longitude, must be between -180 and 180"})
+			return
+		}
+		fields["longitude"] = *req.Longitude
+	}
+	if req.ProspectStatus != "" {
+		fields["prospect_status"] = req.ProspectStatus
+	}
+	if req.Note != "" {
+		fields["note"] = req.Note
+	}
+	if req.FixedTime != nil {
+		fields["fixed_time"] = *req.FixedTime
+	}
+
+	if len(fields) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
 	defer cancel()
 
 	filter := bson.M{"_id": objectID}
-	update := bson.M{"$set": updatedMeet}
 
-	result, err := mc.collection.UpdateOne(ctx, filter, update)
-	if err != nil {
-		handleError(c, http.StatusInternalServerError, "Failed to update meet", err)
+	var before models.Meet
+	if err := mc.collection.FindOne(ctx, filter).Decode(&before); err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Meet not found"})
+		return
+	} else if err != nil {
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to retrieve meet", err)
+		return
+	}
+	if !etag.Check(c, before.Version) {
 		return
 	}
 
-	if result.ModifiedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Meet not found"})
+	// The update only applies to the version read above, so the location can
+	// be built from its coordinates. The user's text is set as plain values:
+	// in a pipeline update a string starting with "$" would be read as a field.
+	if req.Latitude != nil || req.Longitude != nil {
+		lat, lng := before.Latitude, before.Longitude
+		if req.Latitude != nil {
+			lat = *req.Latitude
+		}
+		if req.Longitude != nil {
+			lng = *req.Longitude
+		}
+		fields["location"] = geo.NewPoint(lat, lng)
+	}
+	update := bson.M{"$set": fields}
+
+	var meet models.Meet
+	err = mc.collection.FindOneAndUpdate(ctx, etag.Match(filter, before.Version), etag.Bump(update),
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&meet)
+	if err == mongo.ErrNoDocuments {
+		etag.Conflict(c)
+		return
+	} else if err != nil {
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to update meet", err)
 		return
 	}
+	events.Publish(events.EntityMeet, events.Updated, meet.ID, meet.UserID, meet)
+	audit.Record(c, audit.EntityMeet, audit.Updated, meet.ID, before, meet)
 
+	etag.Set(c, meet.Version)
 	c.JSON(http.StatusOK, gin.H{"message": "Meet updated successfully"})
 }
 
 func (mc *MeetController) DeleteMeet(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := database.QueryContext(c.Request.Context())
 	defer cancel()
 
 	meetID := c.Param("id")
@@ -208,22 +423,47 @@ func (mc *MeetController) DeleteMeet(c *gin.Context) {
 
 	filter := bson.M{"_id": objectID}
 
-	result, err := mc.collection.DeleteOne(ctx, filter)
-	if err != nil {
-		handleError(c, http.StatusInternalServerError, "Failed to delete meet", err)
-		return
+	// With If-Match the meet is only deleted while it is still the version
+	// the client saw.
+	conditional := etag.Conditional(c)
+	if conditional {
+		var current models.Meet
+		err = mc.collection.FindOne(ctx, filter).Decode(&current)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Meet not found"})
+			return
+		} else if err != nil {
+			handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to retrieve meet", err)
+			return
+		}
+		if !etag.Check(c, current.Version) {
+			return
+		}
+		filter = etag.Match(filter, current.Version)
 	}
 
-	if result.DeletedCount == 0 {
+	var meet models.Meet
+	err = mc.collection.FindOneAndDelete(ctx, filter).Decode(&meet)
+	if err == mongo.ErrNoDocuments {
+		if conditional {
+			etag.Conflict(c)
+			return
+		}
 		c.JSON(http.StatusNotFound, gin.H{"error": "Meet not found"})
 		return
+	} else if err != nil {
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to delete meet", err)
+		return
 	}
+	events.Publish(events.EntityMeet, events.Deleted, meet.ID, meet.UserID, nil)
+	audit.Record(c, audit.EntityMeet, audit.Deleted, meet.ID, meet, nil)
+	tombstone.Record(events.EntityMeet, meet.ID, meet.UserID, tombstone.Deleted)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Meet deleted successfully"})
 }
 
 func (mc *MeetController) GetMeetByID(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := database.QueryContext(c.Request.Context())
 	defer cancel()
 
 	meetID := c.Param("id")
@@ -242,9 +482,564 @@ func (mc *MeetController) GetMeetByID(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Meet not found"})
 			return
 		}
-		handleError(c, http.StatusInternalServerError, "Failed to retrieve meet", err)
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to retrieve meet", err)
 		return
 	}
 
+	etag.Set(c, meet.Version)
 	c.JSON(http.StatusOK, meet)
-}
\ No newline at end of file
+}
+
+func (mc *MeetController) CompleteMeet(c *gin.Context) {
+	var req CompleteMeetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid request payload", err)
+		return
+	}
+
+	fields := bson.M{
+		"status":       models.MeetCompleted,
+		"meet_result":  strings.TrimSpace(req.MeetResult),
+		"completed_at": time.Now(),
+	}
+	if req.Note != "" {
+		fields["note"] = req.Note
+	}
+
+	if meet, ok := mc.transition(c, models.MeetCompleted, bson.M{"$set": fields}); ok {
+		metrics.MeetsCompleted.Inc()
+		c.JSON(http.StatusOK, gin.H{"message": "Meet completed", "data": meet})
+	}
+}
+
+func (mc *MeetController) CancelMeet(c *gin.Context) {
+	var req CancelMeetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid request payload", err)
+		return
+	}
+
+	update := bson.M{"$set": bson.M{
+		"status":        models.MeetCancelled,
+		"cancel_reason": strings.TrimSpace(req.Reason),
+	}}
+
+	if meet, ok := mc.transition(c, models.MeetCancelled, update); ok {
+		c.JSON(http.StatusOK, gin.H{"message": "Meet cancelled", "data": meet})
+	}
+}
+
+func (mc *MeetController) MarkNoShow(c *gin.Context) {
+	update := bson.M{"$set": bson.M{"status": models.MeetNoShow}}
+
+	if meet, ok := mc.transition(c, models.MeetNoShow, update); ok {
+		c.JSON(http.StatusOK, gin.H{"message": "Meet marked as no-show", "data": meet})
+	}
+}
+
+func (mc *MeetController) RescheduleMeet(c *gin.Context) {
+	var req RescheduleMeetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid request payload", err)
+		return
+	}
+
+	// A pipeline update appends the current date to the history and replaces
+	// it in one atomic step, so concurrent reschedules cannot lose an entry.
+	// The reason is wrapped in $literal so that text starting with "$" is not
+	// read as a field path.
+	fields := bson.M{
+		"history": bson.M{"$concatArrays": bson.A{
+			bson.M{"$ifNull": bson.A{"$history", bson.A{}}},
+			bson.A{bson.M{
+				"previous_date":  "$date",
+				"rescheduled_at": time.Now(),
+				"reason":         bson.M{"$literal": strings.TrimSpace(req.Reason)},
+			}},
+		}},
+		"date":   req.Date,
+		"status": models.MeetScheduled,
+	}
+	if req.FixedTime != nil {
+		fields["fixed_time"] = *req.FixedTime
+	}
+	update := mongo.Pipeline{{{Key: "$set", Value: fields}}}
+
+	if meet, ok := mc.transition(c, models.MeetScheduled, update); ok {
+		c.JSON(http.StatusOK, gin.H{"message": "Meet rescheduled", "data": meet})
+	}
+}
+
+// transition applies update to the meet named in the URL, provided the meet
+// is currently in a status that may move to the target status. It writes the
+// error response itself and reports whether the caller should continue.
+func (mc *MeetController) transition(c *gin.Context, target string, update interface{}) (*models.Meet, bool) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid meet ID", err)
+		return nil, false
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	var current models.Meet
+	if err := mc.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&current); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Meet not found"})
+			return nil, false
+		}
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to retrieve meet", err)
+		return nil, false
+	}
+	if !etag.Check(c, current.Version) {
+		return nil, false
+	}
+	if !current.CanTransitionTo(target) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": fmt.Sprintf("Cannot move a %s meet to %s", statusOf(&current), target),
+		})
+		return nil, false
+	}
+
+	// Filter on the version and the allowed source statuses again so that a
+	// concurrent change between the read above and this write is detected.
+	// Meets created before statuses existed count as scheduled.
+	from := bson.A{}
+	for _, status := range models.MeetStatusesBefore(target) {
+		from = append(from, status)
+		if status == models.MeetScheduled {
+			from = append(from, "", nil)
+		}
+	}
+	filter := etag.Match(bson.M{"_id": objectID, "status": bson.M{"$in": from}}, current.Version)
+
+	var meet models.Meet
+	err = mc.collection.FindOneAndUpdate(ctx, filter, etag.Bump(update),
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&meet)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			etag.Conflict(c)
+			return nil, false
+		}
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to update meet", err)
+		return nil, false
+	}
+	events.Publish(events.EntityMeet, events.Updated, meet.ID, meet.UserID, meet)
+	audit.Record(c, audit.EntityMeet, audit.Updated, meet.ID, current, meet)
+
+	etag.Set(c, meet.Version)
+	return &meet, true
+}
+
+func statusOf(meet *models.Meet) string {
+	if meet.Status == "" {
+		return models.MeetScheduled
+	}
+	return meet.Status
+}
+
+// MeetStats reports how many meets ended in each status over an optional
+// date range, along with the share of finished meets that were completed.
+func (mc *MeetController) MeetStats(c *gin.Context) {
+	filter := bson.M{}
+	dateRange := bson.M{}
+	if from := c.Query("from"); from != "" {
+		parsed, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			handleError(c, http.StatusBadRequest, "Invalid from date, expected YYYY-MM-DD", err)
+			return
+		}
+		dateRange["$gte"] = parsed
+	}
+	if to := c.Query("to"); to != "" {
+		parsed, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			handleError(c, http.StatusBadRequest, "Invalid to date, expected YYYY-MM-DD", err)
+			return
+		}
+		dateRange["$lt"] = parsed.AddDate(0, 0, 1)
+	}
+	if len(dateRange) > 0 {
+		filter["date"] = dateRange
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"$ifNull": bson.A{"$status", models.MeetScheduled}},
+			"count": bson.M{"$sum": 1},
+		}}},
+	}
+	cursor, err := mc.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to compute meet stats", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		Status string `bson:"_id"`
+		Count  int64  `bson:"count"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to parse meet stats", err)
+		return
+	}
+
+	counts := map[string]int64{
+		models.MeetScheduled: 0,
+		models.MeetCompleted: 0,
+		models.MeetCancelled: 0,
+		models.MeetNoShow:    0,
+	}
+	var total int64
+	for _, group := range groups {
+		counts[group.Status] += group.Count
+		total += group.Count
+	}
+
+	finished := counts[models.MeetCompleted] + counts[models.MeetCancelled] + counts[models.MeetNoShow]
+	completionRate := 0.0
+	if finished > 0 {
+		completionRate = float64(counts[models.MeetCompleted]) / float64(finished)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":           total,
+		"by_status":       counts,
+		"completion_rate": completionRate,
+	})
+}
+
+// visit builds a check-in or check-out record for the meet. A position counts
+// as out of range when even the most favourable reading within the reported
+// accuracy lies outside the allowed radius. The accuracy comes from the
+// device, so a reading less precise than the radius itself cannot place the
+// user at the meet and is flagged too; the raw accuracy is kept on the record.
+func visit(c *gin.Context, meet *models.Meet, req VisitRequest) models.MeetVisit {
+	distance := geo.Distance(meet.Latitude, meet.Longitude, req.Latitude, req.Longitude)
+	radius := checkInRadius()
+	userID, _ := c.Get("user_id")
+	id, _ := userID.(string)
+
+	return models.MeetVisit{
+		UserID:     id,
+		Latitude:   req.Latitude,
+		Longitude:  req.Longitude,
+		Accuracy:   req.Accuracy,
+		Distance:   math.Round(distance),
+		OutOfRange: req.Accuracy > radius || distance-req.Accuracy > radius,
+		At:         time.Now(),
+	}
+}
+
+// bindVisit loads the meet a check-in or check-out is for. Only the meet's
+// owner may visit it, and only while it is still scheduled.
+func (mc *MeetController) bindVisit(c *gin.Context) (primitive.ObjectID, *models.Meet, VisitRequest, bool) {
+	var req VisitRequest
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid meet ID", err)
+		return objectID, nil, req, false
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid request payload", err)
+		return objectID, nil, req, false
+	}
+	if !geo.ValidCoordinates(req.Latitude, req.Longitude) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid coordinates"})
+		return objectID, nil, req, false
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	var meet models.Meet
+	if err := mc.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&meet); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Meet not found"})
+			return objectID, nil, req, false
+		}
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to retrieve meet", err)
+		return objectID, nil, req, false
+	}
+	userID, _ := c.Get("user_id")
+	if id, _ := userID.(string); id != meet.UserID.Hex() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the meet's owner can check in or out"})
+		return objectID, nil, req, false
+	}
+	if statusOf(&meet) != models.MeetScheduled {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Cannot visit a %s meet", statusOf(&meet))})
+		return objectID, nil, req, false
+	}
+	if !etag.Check(c, meet.Version) {
+		return objectID, nil, req, false
+	}
+	return objectID, &meet, req, true
+}
+
+func (mc *MeetController) CheckIn(c *gin.Context) {
+	objectID, meet, req, ok := mc.bindVisit(c)
+	if !ok {
+		return
+	}
+	if meet.CheckIn != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Already checked in to this meet"})
+		return
+	}
+
+	checkIn := visit(c, meet, req)
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"check_in": checkIn}}
+	if checkIn.OutOfRange {
+		update["$set"].(bson.M)["visit_flagged"] = true
+	}
+
+	var updated models.Meet
+	err := mc.collection.FindOneAndUpdate(ctx,
+		etag.Match(bson.M{"_id": objectID, "check_in": bson.M{"$exists": false}}, meet.Version),
+		etag.Bump(update),
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			etag.Conflict(c)
+			return
+		}
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to check in", err)
+		return
+	}
+	events.Publish(events.EntityMeet, events.Updated, updated.ID, updated.UserID, updated)
+	audit.Record(c, audit.EntityMeet, audit.Updated, updated.ID, meet, updated)
+
+	etag.Set(c, updated.Version)
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Checked in",
+		"out_of_range":  checkIn.OutOfRange,
+		"radius_meters": checkInRadius(),
+		"data":          updated,
+	})
+}
+
+func (mc *MeetController) CheckOut(c *gin.Context) {
+	objectID, meet, req, ok := mc.bindVisit(c)
+	if !ok {
+		return
+	}
+	if meet.CheckIn == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Check in before checking out"})
+		return
+	}
+	if meet.CheckOut != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Already checked out of this meet"})
+		return
+	}
+
+	checkOut := visit(c, meet, req)
+	duration := int64(checkOut.At.Sub(meet.CheckIn.At).Seconds())
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	fields := bson.M{"check_out": checkOut, "visit_duration_seconds": duration}
+	if checkOut.OutOfRange {
+		fields["visit_flagged"] = true
+	}
+
+	var updated models.Meet
+	err := mc.collection.FindOneAndUpdate(ctx,
+		etag.Match(bson.M{"_id": objectID, "check_in": bson.M{"$exists": true}, "check_out": bson.M{"$exists": false}}, meet.Version),
+		etag.Bump(bson.M{"$set": fields}),
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			etag.Conflict(c)
+			return
+		}
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to check out", err)
+		return
+	}
+	events.Publish(events.EntityMeet, events.Updated, updated.ID, updated.UserID, updated)
+	audit.Record(c, audit.EntityMeet, audit.Updated, updated.ID, meet, updated)
+
+	etag.Set(c, updated.Version)
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Checked out",
+		"out_of_range":  checkOut.OutOfRange,
+		"radius_meters": checkInRadius(),
+		"data":          updated,
+	})
+}
+
+// NearbyMeets returns the caller's meets within radius meters of lat/lng,
+// nearest first. Pass status to narrow down, e.g. status=scheduled.
+func (mc *MeetController) NearbyMeets(c *gin.Context) {
+	lat, lng, radius, err := geo.ParseNear(c.Query("lat"), c.Query("lng"), c.Query("radius"))
+	if err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid nearby query", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	ownerID, err := primitive.ObjectIDFromHex(fmt.Sprint(userID))
+	if err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	query := bson.M{"user_id": ownerID}
+	if status := c.Query("status"); status != "" {
+		query["status"] = status
+	}
+
+	_, limit := parsePagination(c)
+	if limit > 200 {
+		limit = 200
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	pipeline := []interface{}{
+		geo.NearStage(lat, lng, radius, query),
+		bson.M{"$limit": limit},
+	}
+	cursor, err := mc.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to search nearby meets", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	meets := []NearbyMeet{}
+	if err := cursor.All(ctx, &meets); err != nil {
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to parse meets", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"meets":  meets,
+		"radius": radius,
+	})
+}
+
+type RouteStop struct {
+	Order       int         `json:"order"`
+	Fixed       bool        `json:"fixed"`
+	LegDistance float64     `json:"leg_distance"`
+	ETA         time.Time   `json:"eta"`
+	Late        bool        `json:"late"`
+	Meet        models.Meet `json:"meet"`
+}
+
+const (
+	// routeTimeZone is where a planned day starts and ends.
+	routeTimeZone = "Asia/Jakarta"
+	// routeDayStart is when the route leaves by default.
+	routeDayStart = 8 * time.Hour
+	// routeSpeed is the average travel speed in meters per second applied
+	// to straight-line distances, about 20 km/h across town.
+	routeSpeed = 20000.0 / 3600
+	// routeVisitDuration is the time spent at every stop.
+	routeVisitDuration = 30 * time.Minute
+)
+
+// PlanRoute orders the caller's scheduled meets for a Jakarta day, starting
+// from start_lat/start_lng. Meets marked fixed_time are appointments and are
+// visited in chronological order. Every stop gets an estimated arrival time
+// when leaving at depart_at (default 08:00 that day, or now if later), and a
+// fixed stop that cannot be reached in time is reported as late. Distances
+// are straight-line estimates in meters.
+func (mc *MeetController) PlanRoute(c *gin.Context) {
+	day, err := time.ParseInLocation("2006-01-02", c.Query("date"), mc.location)
+	if err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD", err)
+		return
+	}
+	startLat, startLng, _, err := geo.ParseNear(c.Query("start_lat"), c.Query("start_lng"), "")
+	if err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid start position", err)
+		return
+	}
+	depart := day.Add(routeDayStart)
+	if now := time.Now(); now.After(depart) && now.Before(day.AddDate(0, 0, 1)) {
+		depart = now
+	}
+	if raw := c.Query("depart_at"); raw != "" {
+		if depart, err = time.Parse(time.RFC3339, raw); err != nil {
+			handleError(c, http.StatusBadRequest, "Invalid depart_at, expected RFC 3339", err)
+			return
+		}
+	}
+
+	userID, _ := c.Get("user_id")
+	ownerID, err := primitive.ObjectIDFromHex(fmt.Sprint(userID))
+	if err != nil {
+		handleError(c, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	filter := bson.M{
+		"user_id": ownerID,
+		"date":    bson.M{"$gte": day, "$lt": day.AddDate(0, 0, 1)},
+		"status":  bson.M{"$in": bson.A{models.MeetScheduled, "", nil}},
+	}
+	cursor, err := mc.collection.Find(ctx, filter, options.Find().SetSort(bson.M{"date": 1}))
+	if err != nil {
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to retrieve meets", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var meets []models.Meet
+	if err := cursor.All(ctx, &meets); err != nil {
+		handleError(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to parse meets", err)
+		return
+	}
+
+	stops := make([]geo.Stop, len(meets))
+	for i, meet := range meets {
+		stops[i] = geo.Stop{
+			Lat:   meet.Latitude,
+			Lng:   meet.Longitude,
+			Fixed: meet.FixedTime,
+			At:    meet.Date,
+		}
+	}
+
+	order := geo.PlanRoute(startLat, startLng, stops)
+	legs := geo.Legs(startLat, startLng, stops, order)
+	arrivals := geo.Arrivals(depart, startLat, startLng, stops, order, routeSpeed, routeVisitDuration)
+
+	route := make([]RouteStop, len(order))
+	total := 0.0
+	for position, i := range order {
+		route[position] = RouteStop{
+			Order:       position + 1,
+			Fixed:       stops[i].Fixed,
+			LegDistance: math.Round(legs[position]),
+			ETA:         arrivals[position].At,
+			Late:        arrivals[position].Late,
+			Meet:        meets[i],
+		}
+		total += legs[position]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"date":           day.Format("2006-01-02"),
+		"depart_at":      depart,
+		"stops":          route,
+		"total_distance": math.Round(total),
+	})
+}
@@ -0,0 +1,188 @@
+package NotificationControllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Arkariza/API_MyActivity/auth/middleware"
+	database "github.com/Arkariza/API_MyActivity/models"
+	"github.com/Arkariza/API_MyActivity/models/Notification"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type NotificationController struct {
+	collection *mongo.Collection
+	users      *mongo.Collection
+}
+
+func NewNotificationController(collection, users *mongo.Collection) *NotificationController {
+	return &NotificationController{
+		collection: collection,
+		users:      users,
+	}
+}
+
+type RegisterDeviceRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+func (nc *NotificationController) GetNotifications(c *gin.Context) {
+	userID, _, ok := AuthMiddleware.CurrentUser(c)
+	if !ok {
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	filter := bson.M{"user_id": userID}
+	if c.Query("unread") == "true" {
+		filter["read"] = false
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	cursor, err := nc.collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64((page-1)*limit)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to fetch notifications"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	notifications := []models.Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to decode notifications"})
+		return
+	}
+
+	total, err := nc.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to count notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications,
+		"page":          page,
+		"limit":         limit,
+		"total":         total,
+	})
+}
+
+func (nc *NotificationController) UnreadCount(c *gin.Context) {
+	userID, _, ok := AuthMiddleware.CurrentUser(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	count, err := nc.collection.CountDocuments(ctx, bson.M{"user_id": userID, "read": false})
+	if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to count notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"unread": count})
+}
+
+func (nc *NotificationController) MarkRead(c *gin.Context) {
+	userID, _, ok := AuthMiddleware.CurrentUser(c)
+	if !ok {
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid notification ID"})
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	result, err := nc.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "user_id": userID},
+		bson.M{"$set": bson.M{"read": true, "read_at": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to update notification"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "notification not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
+
+func (nc *NotificationController) MarkAllRead(c *gin.Context) {
+	userID, _, ok := AuthMiddleware.CurrentUser(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	result, err := nc.collection.UpdateMany(ctx,
+		bson.M{"user_id": userID, "read": false},
+		bson.M{"$set": bson.M{"read": true, "read_at": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to update notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "All notifications marked as read",
+		"updated": result.ModifiedCount,
+	})
+}
+
+// RegisterDevice stores a push token for the caller's device so that new
+// notifications are also delivered as push messages.
+func (nc *NotificationController) RegisterDevice(c *gin.Context) {
+	userID, _, ok := AuthMiddleware.CurrentUser(c)
+	if !ok {
+		return
+	}
+
+	var req RegisterDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	_, err := nc.users.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$addToSet": bson.M{"device_tokens": strings.TrimSpace(req.Token)}},
+	)
+	if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "failed to register device"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device registered"})
+}
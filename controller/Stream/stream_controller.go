@@ -0,0 +1,114 @@
+package StreamControllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Arkariza/API_MyActivity/events"
+	"github.com/Arkariza/API_MyActivity/models/User"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const heartbeatInterval = 15 * time.Second
+
+type StreamController struct {
+	bus *events.Bus
+}
+
+func NewStreamController(bus *events.Bus) *StreamController {
+	return &StreamController{bus: bus}
+}
+
+// visible reports whether the user may see the event: staff see everything,
+// other users only events about their own records or records without owner.
+func visible(event events.Event, userID primitive.ObjectID, role int) bool {
+	if role == models.RoleStaff {
+		return true
+	}
+	return event.OwnerID.IsZero() || event.OwnerID == userID
+}
+
+func writeEvent(w io.Writer, event events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, payload)
+	return err
+}
+
+// Stream pushes create/update/delete events as Server-Sent Events. Clients
+// resume by sending the Last-Event-ID header (or last_event_id query); when
+// the requested events are no longer available a "reset" event tells the
+// client to reload its lists before continuing.
+func (sc *StreamController) Stream(c *gin.Context) {
+	userID := c.MustGet("userID").(primitive.ObjectID)
+	role := c.MustGet("userRole").(int)
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var lastID uint64
+	if lastEventID != "" {
+		parsed, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Last-Event-ID"})
+			return
+		}
+		lastID = parsed
+	}
+
+	replay, complete, ch, unsubscribe := sc.bus.Subscribe(lastID)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, event := range replay {
+		if visible(event, userID, role) {
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		}
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if !visible(event, userID, role) {
+				continue
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			w.Flush()
+		}
+	}
+}
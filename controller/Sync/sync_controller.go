@@ -0,0 +1,548 @@
+package SyncControllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Arkariza/API_MyActivity/audit"
+	"github.com/Arkariza/API_MyActivity/etag"
+	"github.com/Arkariza/API_MyActivity/events"
+	"github.com/Arkariza/API_MyActivity/idempotency"
+	database "github.com/Arkariza/API_MyActivity/models"
+	activityModels "github.com/Arkariza/API_MyActivity/models/CallAndMeet"
+	leadModels "github.com/Arkariza/API_MyActivity/models/ManageLead"
+	syncModels "github.com/Arkariza/API_MyActivity/models/Sync"
+	userModels "github.com/Arkariza/API_MyActivity/models/User"
+	"github.com/Arkariza/API_MyActivity/tombstone"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+
+	StatusApplied  = "applied"
+	StatusConflict = "conflict"
+	StatusNotFound = "not_found"
+	StatusRejected = "rejected"
+
+	defaultLimit = 500
+	maxLimit     = 1000
+	maxChanges   = 100
+
+	// removals is the token key of the tombstone stream.
+	removals = "removed"
+)
+
+type SyncController struct {
+	leads      *mongo.Collection
+	calls      *mongo.Collection
+	meets      *mongo.Collection
+	comments   *mongo.Collection
+	tombstones *mongo.Collection
+	// handler serves the changes sent to ApplyChanges through the regular
+	// endpoints, so that they are validated, authorized and recorded the
+	// same way as changes made online. It should carry only the API routes
+	// and not the server-wide middleware, which has already seen the sync
+	// request.
+	handler http.Handler
+}
+
+func NewSyncController(leads, calls, meets, comments, tombstones *mongo.Collection, handler http.Handler) *SyncController {
+	return &SyncController{leads: leads, calls: calls, meets: meets, comments: comments, tombstones: tombstones, handler: handler}
+}
+
+// stream is one kind of record a device keeps a copy of.
+type stream struct {
+	entity     string
+	key        string
+	collection *mongo.Collection
+	created    string
+	record     func() interface{}
+}
+
+func (sc *SyncController) streams() []stream {
+	return []stream{
+		{events.EntityLead, "leads", sc.leads, "created_at", func() interface{} { return &leadModels.Lead{} }},
+		{events.EntityCall, "calls", sc.calls, "created_at", func() interface{} { return &activityModels.Call{} }},
+		{events.EntityMeet, "meets", sc.meets, "created_at", func() interface{} { return &activityModels.Meet{} }},
+		{events.EntityComment, "comments", sc.comments, "date", func() interface{} { return &activityModels.Comment{} }},
+	}
+}
+
+func (sc *SyncController) stream(entity string) (stream, bool) {
+	for _, s := range sc.streams() {
+		if s.entity == entity {
+			return s, true
+		}
+	}
+	return stream{}, false
+}
+
+// position is how far a device has read one stream: up to the record with
+// the given modification time (in milliseconds) and ID.
+type position struct {
+	Time int64  `json:"t"`
+	ID   string `json:"id,omitempty"`
+}
+
+func (p position) at() time.Time {
+	return time.UnixMilli(p.Time)
+}
+
+// after matches the records past the position in (time, _id) order.
+func (p position) after(field string) bson.M {
+	id, _ := primitive.ObjectIDFromHex(p.ID)
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{"$gt": p.at()}},
+		bson.M{field: p.at(), "_id": bson.M{"$gt": id}},
+	}}
+}
+
+// token holds the position of every stream. Clients treat it as opaque.
+type token map[string]position
+
+func (t token) String() string {
+	raw, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func parseToken(value string) (token, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var t token
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return nil, err
+	}
+	if _, ok := t[removals]; !ok {
+		return nil, fmt.Errorf("token has no %s position", removals)
+	}
+	return t, nil
+}
+
+// Removal is a record a device should drop. A record that was reassigned
+// away and later back is removed before it changed again, so a device only
+// drops its copy when RemovedAt is after the copy's modification time.
+type Removal struct {
+	ID        string    `json:"id"`
+	Reason    string    `json:"reason"`
+	RemovedAt time.Time `json:"removed_at"`
+}
+
+// scopes returns, per stream, the records the user can see: staff see
+// everything, everyone else their own leads, calls and meets and the
+// comments on them, the same records the event stream shows them.
+func (sc *SyncController) scopes(ctx context.Context, userID primitive.ObjectID, role int) (map[string]bson.M, error) {
+	// Calls with deleted_at are left out, as in the call list.
+	live := bson.M{"deleted_at": bson.M{"$exists": false}}
+	if role == userModels.RoleStaff {
+		return map[string]bson.M{
+			events.EntityLead:    {},
+			events.EntityCall:    live,
+			events.EntityMeet:    {},
+			events.EntityComment: {},
+			removals:             {"reason": tombstone.Deleted},
+		}, nil
+	}
+
+	own := bson.M{"user_id": userID}
+	on := bson.A{}
+	for entityType, collection := range map[string]*mongo.Collection{
+		activityModels.CommentOnLead: sc.leads,
+		activityModels.CommentOnCall: sc.calls,
+		activityModels.CommentOnMeet: sc.meets,
+	} {
+		ids, err := collection.Distinct(ctx, "_id", own)
+		if err != nil {
+			return nil, err
+		}
+		on = append(on, bson.M{"entity_type": entityType, "entity_id": bson.M{"$in": ids}})
+	}
+	return map[string]bson.M{
+		events.EntityLead:    own,
+		events.EntityCall:    {"user_id": userID, "deleted_at": live["deleted_at"]},
+		events.EntityMeet:    own,
+		events.EntityComment: {"$or": on},
+		removals:             {"owner_id": userID},
+	}, nil
+}
+
+// read returns up to limit records of the collection past the position, in
+// (field, _id) order, and the position of the last one. more reports whether
+// there are records left after them.
+func read(ctx context.Context, collection *mongo.Collection, scope bson.M, field string, from position, limit int) ([]bson.Raw, position, bool, error) {
+	filter := from.after(field)
+	if len(scope) > 0 {
+		filter = bson.M{"$and": bson.A{scope, filter}}
+	}
+	cursor, err := collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: field, Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(limit+1)))
+	if err != nil {
+		return nil, from, false, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []bson.Raw
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, from, false, err
+	}
+	more := len(docs) > limit
+	if more {
+		docs = docs[:limit]
+	}
+	to := from
+	if len(docs) > 0 {
+		last := docs[len(docs)-1]
+		at, _ := last.Lookup(field).TimeOK()
+		id, _ := last.Lookup("_id").ObjectIDOK()
+		to = position{Time: at.UnixMilli(), ID: id.Hex()}
+	}
+	return docs, to, more, nil
+}
+
+// GetChanges returns the leads, calls, meets and comments the user can see
+// that were created, updated or removed since the sync token in since, and
+// the token to send next time. Without since, everything visible is returned
+// as created. At most limit records of each kind are returned; has_more asks
+// the client to call again with the new token straight away.
+func (sc *SyncController) GetChanges(c *gin.Context) {
+	userID := c.MustGet("userID").(primitive.ObjectID)
+	role := c.MustGet("userRole").(int)
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	if limit < 1 || limit > maxLimit {
+		limit = defaultLimit
+	}
+
+	now := time.Now()
+	since := token{}
+	full := c.Query("since") == ""
+	if !full {
+		parsed, err := parseToken(c.Query("since"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sync token, sync again without since", "details": err.Error()})
+			return
+		}
+		if parsed[removals].at().Before(now.Add(-syncModels.TombstoneRetention)) {
+			c.JSON(http.StatusGone, gin.H{"error": "Sync token has expired, sync again without since"})
+			return
+		}
+		since = parsed
+	}
+
+	// Changes are stamped just before they are written, so one stamped
+	// shortly before now may not be visible yet. Streams read to the end
+	// resume from the longest a write can take before now, and that window
+	// is sent again; clients keep the copy with the highest version.
+	settled := position{Time: now.Add(-database.QueryTimeout).UnixMilli()}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	scopes, err := sc.scopes(ctx, userID, role)
+	if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to resolve visible records", "details": err.Error()})
+		return
+	}
+
+	next := token{}
+	hasMore := false
+	response := gin.H{}
+	changes := map[string]gin.H{}
+	for _, s := range sc.streams() {
+		from := since[s.entity]
+		docs, to, more, err := read(ctx, s.collection, scopes[s.entity], etag.ModifiedField, from, limit)
+		if err != nil {
+			c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to fetch " + s.key, "details": err.Error()})
+			return
+		}
+		created, updated := []interface{}{}, []interface{}{}
+		for _, raw := range docs {
+			record := s.record()
+			if err := bson.Unmarshal(raw, record); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode " + s.key, "details": err.Error()})
+				return
+			}
+			if at, ok := raw.Lookup(s.created).TimeOK(); ok && at.After(from.at()) {
+				created = append(created, record)
+			} else {
+				updated = append(updated, record)
+			}
+		}
+		if !more {
+			to = settled
+		}
+		next[s.entity] = to
+		hasMore = hasMore || more
+		changes[s.entity] = gin.H{"created": created, "updated": updated, "deleted": []Removal{}}
+		response[s.key] = changes[s.entity]
+	}
+
+	// A full sync has nothing to remove.
+	next[removals] = settled
+	if !full {
+		docs, to, more, err := read(ctx, sc.tombstones, scopes[removals], "removed_at", since[removals], limit)
+		if err != nil {
+			c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to fetch removals", "details": err.Error()})
+			return
+		}
+		for _, raw := range docs {
+			var removed syncModels.Tombstone
+			if err := bson.Unmarshal(raw, &removed); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode removals", "details": err.Error()})
+				return
+			}
+			if entity, ok := changes[removed.Entity]; ok {
+				entity["deleted"] = append(entity["deleted"].([]Removal), Removal{
+					ID:        removed.EntityID.Hex(),
+					Reason:    removed.Reason,
+					RemovedAt: removed.RemovedAt,
+				})
+			}
+		}
+		if more {
+			next[removals] = to
+		}
+		hasMore = hasMore || more
+	}
+
+	response["token"] = next.String()
+	response["has_more"] = hasMore
+	c.JSON(http.StatusOK, response)
+}
+
+// endpoint is the regular route a change is applied through; %s stands for
+// the record ID. created names the response field holding a new record.
+type endpoint struct {
+	method  string
+	path    string
+	created string
+}
+
+// endpoints lists what can be changed offline. Leads are updated by changing
+// their status; calls and leads cannot be deleted through the API at all.
+var endpoints = map[string]map[string]endpoint{
+	events.EntityLead: {
+		ActionCreate: {http.MethodPost, "/api/leads/add", "data"},
+		ActionUpdate: {http.MethodPut, "/api/leads/%s/status", ""},
+	},
+	events.EntityCall: {
+		ActionCreate: {http.MethodPost, "/api/calls/add", "data"},
+		ActionUpdate: {http.MethodPut, "/api/calls/%s", ""},
+	},
+	events.EntityMeet: {
+		ActionCreate: {http.MethodPost, "/api/meets/add", "data"},
+		ActionUpdate: {http.MethodPut, "/api/meets/%s", ""},
+		ActionDelete: {http.MethodDelete, "/api/meets/%s", ""},
+	},
+	events.EntityComment: {
+		ActionCreate: {http.MethodPost, "/api/comments/add", "comment"},
+		ActionUpdate: {http.MethodPut, "/api/comments/%s", ""},
+		ActionDelete: {http.MethodDelete, "/api/comments/%s", ""},
+	},
+}
+
+// Change is one change made offline. Updates and deletes carry the version
+// the device last saw; creates may carry a client_id, which makes resending
+// the same create safe.
+type Change struct {
+	Entity   string          `json:"entity" binding:"required"`
+	Action   string          `json:"action" binding:"required,oneof=create update delete"`
+	ID       string          `json:"id"`
+	ClientID string          `json:"client_id"`
+	Version  int64           `json:"version"`
+	Data     json.RawMessage `json:"data"`
+}
+
+type ApplyChangesRequest struct {
+	Changes []Change `json:"changes" binding:"required,min=1,dive"`
+}
+
+// ChangeResult is the outcome of one change. Data is the server's copy of the
+// record after an applied change or, on a conflict, the copy the change was
+// rejected against. Response is the endpoint's answer to a rejected change.
+type ChangeResult struct {
+	Index    int             `json:"index"`
+	Entity   string          `json:"entity"`
+	Action   string          `json:"action"`
+	ClientID string          `json:"client_id,omitempty"`
+	ID       string          `json:"id,omitempty"`
+	Status   string          `json:"status"`
+	Version  int64           `json:"version,omitempty"`
+	Data     interface{}     `json:"data,omitempty"`
+	Code     int             `json:"code,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// ApplyChanges applies a batch of offline changes in order and reports each
+// one's outcome. A change made to an older version than the server's is not
+// applied and comes back as a conflict with the server's copy; one change
+// failing does not stop the others.
+func (sc *SyncController) ApplyChanges(c *gin.Context) {
+	var req ApplyChangesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	if len(req.Changes) > maxChanges {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At most " + strconv.Itoa(maxChanges) + " changes can be sent at once"})
+		return
+	}
+
+	results := make([]ChangeResult, len(req.Changes))
+	for i, change := range req.Changes {
+		results[i] = sc.apply(c, change)
+		results[i].Index = i
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+func (sc *SyncController) apply(c *gin.Context, change Change) ChangeResult {
+	result := ChangeResult{Entity: change.Entity, Action: change.Action, ClientID: change.ClientID, ID: change.ID}
+	reject := func(code int, message string) ChangeResult {
+		result.Status, result.Code, result.Error = StatusRejected, code, message
+		return result
+	}
+
+	s, ok := sc.stream(change.Entity)
+	if !ok {
+		return reject(http.StatusBadRequest, "Unknown entity "+change.Entity)
+	}
+	target, ok := endpoints[change.Entity][change.Action]
+	if !ok {
+		return reject(http.StatusBadRequest, fmt.Sprintf("A %s cannot be %sd through sync", change.Entity, change.Action))
+	}
+
+	var id primitive.ObjectID
+	if change.Action != ActionCreate {
+		var err error
+		if id, err = primitive.ObjectIDFromHex(change.ID); err != nil {
+			return reject(http.StatusBadRequest, "Invalid "+change.Entity+" ID")
+		}
+		if change.Version < 1 {
+			return reject(http.StatusBadRequest, "The version the change was made to is required")
+		}
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	path := target.path
+	if change.Action != ActionCreate {
+		path = fmt.Sprintf(target.path, change.ID)
+	}
+	body := []byte(change.Data)
+	if len(body) == 0 || change.Action == ActionDelete {
+		body = []byte("{}")
+	}
+	request, err := http.NewRequestWithContext(c.Request.Context(), target.method, path, bytes.NewReader(body))
+	if err != nil {
+		return reject(http.StatusInternalServerError, err.Error())
+	}
+	request.RemoteAddr = c.Request.RemoteAddr
+	request.Header.Set("Authorization", c.GetHeader("Authorization"))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(audit.RequestIDHeader, audit.RequestID(c))
+	if change.Action != ActionCreate {
+		request.Header.Set("If-Match", etag.Format(change.Version))
+	}
+	if change.Action == ActionCreate && change.ClientID != "" {
+		request.Header.Set(idempotency.Header, "sync:"+change.ClientID)
+	}
+
+	response := newResponse()
+	sc.handler.ServeHTTP(response, request)
+
+	switch {
+	case response.status >= 200 && response.status < 300:
+		result.Status = StatusApplied
+	case response.status == http.StatusPreconditionFailed:
+		result.Status = StatusConflict
+	case response.status == http.StatusNotFound:
+		result.Status = StatusNotFound
+		return result
+	default:
+		result = reject(response.status, "")
+		var answer struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(response.body.Bytes(), &answer) == nil {
+			result.Error = answer.Error
+			result.Response = json.RawMessage(response.body.Bytes())
+		}
+		return result
+	}
+
+	if change.Action == ActionDelete && result.Status == StatusApplied {
+		return result
+	}
+	if change.Action == ActionCreate {
+		var answer map[string]struct {
+			ID string `json:"id"`
+		}
+		_ = json.Unmarshal(response.body.Bytes(), &answer)
+		result.ID = answer[target.created].ID
+		if id, err = primitive.ObjectIDFromHex(result.ID); err != nil {
+			return result
+		}
+	}
+	if record, version, err := sc.current(ctx, s, id); err == nil {
+		result.Version, result.Data = version, record
+	}
+	return result
+}
+
+// current returns the server's copy of a record and its version.
+func (sc *SyncController) current(ctx context.Context, s stream, id primitive.ObjectID) (interface{}, int64, error) {
+	raw, err := s.collection.FindOne(ctx, bson.M{"_id": id}).Raw()
+	if err != nil {
+		return nil, 0, err
+	}
+	record := s.record()
+	if err := bson.Unmarshal(raw, record); err != nil {
+		return nil, 0, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, 0, err
+	}
+	return record, etag.Of(doc), nil
+}
+
+// response collects what an endpoint wrote for a change.
+type response struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponse() *response {
+	return &response{header: http.Header{}, status: http.StatusOK}
+}
+
+func (r *response) Header() http.Header {
+	return r.header
+}
+
+func (r *response) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+func (r *response) WriteHeader(status int) {
+	r.status = status
+}
@@ -0,0 +1,604 @@
+package TargetControllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Arkariza/API_MyActivity/audit"
+	"github.com/Arkariza/API_MyActivity/auth/middleware"
+	database "github.com/Arkariza/API_MyActivity/models"
+	"github.com/Arkariza/API_MyActivity/models/Target"
+	userModels "github.com/Arkariza/API_MyActivity/models/User"
+	"github.com/Arkariza/API_MyActivity/respond"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// targetTimeZone is where target periods start and end.
+const targetTimeZone = "Asia/Jakarta"
+
+type TargetController struct {
+	collection *mongo.Collection
+	snapshots  *mongo.Collection
+	users      *mongo.Collection
+	sources    map[string]*mongo.Collection
+	location   *time.Location
+}
+
+func NewTargetController(collection, snapshots, users, leads, calls, meets *mongo.Collection) *TargetController {
+	location, err := time.LoadLocation(targetTimeZone)
+	if err != nil {
+		location = time.UTC
+	}
+	return &TargetController{
+		collection: collection,
+		snapshots:  snapshots,
+		users:      users,
+		sources: map[string]*mongo.Collection{
+			models.MetricCalls: calls,
+			models.MetricMeets: meets,
+			models.MetricLeads: leads,
+			models.MetricWins:  leads,
+		},
+		location: location,
+	}
+}
+
+type CreateTargetRequest struct {
+	UserID string `json:"user_id" binding:"omitempty,mongodb"`
+	Role   int    `json:"role" binding:"omitempty,oneof=1 2"`
+	Metric string `json:"metric" binding:"required,oneof=calls meets leads wins"`
+	Period string `json:"period" binding:"required,oneof=day week month"`
+	Goal   int64  `json:"goal" binding:"required,min=1"`
+}
+
+type UpdateTargetRequest struct {
+	Goal int64 `json:"goal" binding:"required,min=1"`
+}
+
+// TargetProgress is a target together with the user's actual count so far in
+// the current period.
+type TargetProgress struct {
+	Target      models.Target `json:"target"`
+	PeriodStart time.Time     `json:"period_start"`
+	PeriodEnd   time.Time     `json:"period_end"`
+	Actual      int64         `json:"actual"`
+	Remaining   int64         `json:"remaining"`
+	Percent     float64       `json:"percent"`
+	Achieved    bool          `json:"achieved"`
+}
+
+// subject is the user a progress or history request is about: the caller,
+// or for staff the user in the user_id query value.
+func (tc *TargetController) subject(ctx context.Context, c *gin.Context) (primitive.ObjectID, int, bool) {
+	userID, role, ok := AuthMiddleware.CurrentUser(c)
+	if !ok {
+		return userID, role, false
+	}
+	raw := c.Query("user_id")
+	if raw == "" || raw == userID.Hex() {
+		return userID, role, true
+	}
+	if role != userModels.RoleStaff {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only staff can view other users' targets"})
+		return userID, role, false
+	}
+	otherID, err := primitive.ObjectIDFromHex(raw)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid user ID", err)
+		return userID, role, false
+	}
+	var user userModels.User
+	if err := tc.users.FindOne(ctx, bson.M{"_id": otherID}).Decode(&user); err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return userID, role, false
+	} else if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to load user", err)
+		return userID, role, false
+	}
+	return user.ID, user.Role, true
+}
+
+// CreateTarget sets a goal for one user or for every user with a role.
+// Staff only; there can be one target per user or role, metric and period.
+func (tc *TargetController) CreateTarget(c *gin.Context) {
+	userID, role, ok := AuthMiddleware.CurrentUser(c)
+	if !ok {
+		return
+	}
+	if role != userModels.RoleStaff {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only staff can set targets"})
+		return
+	}
+
+	var req CreateTargetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid request payload", err)
+		return
+	}
+	if (req.UserID == "") == (req.Role == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set exactly one of user_id or role"})
+		return
+	}
+
+	now := time.Now()
+	target := models.Target{
+		ID:        primitive.NewObjectID(),
+		Role:      req.Role,
+		Metric:    req.Metric,
+		Period:    req.Period,
+		Goal:      req.Goal,
+		CreatedBy: userID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if req.UserID != "" {
+		ownerID, _ := primitive.ObjectIDFromHex(req.UserID)
+		target.UserID = &ownerID
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	if target.UserID != nil {
+		if err := tc.users.FindOne(ctx, bson.M{"_id": *target.UserID}).Err(); err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		} else if err != nil {
+			respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to load user", err)
+			return
+		}
+	}
+
+	if _, err := tc.collection.InsertOne(ctx, target); mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A target for this metric and period already exists"})
+		return
+	} else if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to create target", err)
+		return
+	}
+	audit.Record(c, audit.EntityTarget, audit.Created, target.ID, nil, target)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Target has been created",
+		"data":    target,
+	})
+}
+
+// GetTargets lists every target for staff, who may narrow it with user_id or
+// role; everyone else sees the targets that apply to them.
+func (tc *TargetController) GetTargets(c *gin.Context) {
+	userID, role, ok := AuthMiddleware.CurrentUser(c)
+	if !ok {
+		return
+	}
+
+	filter := bson.M{"$or": []bson.M{{"user_id": userID}, {"role": role}}}
+	if role == userModels.RoleStaff {
+		filter = bson.M{}
+		if raw := c.Query("user_id"); raw != "" {
+			ownerID, err := primitive.ObjectIDFromHex(raw)
+			if err != nil {
+				respond.Error(c, http.StatusBadRequest, "Invalid user ID", err)
+				return
+			}
+			filter["user_id"] = ownerID
+		}
+		if raw := c.Query("role"); raw != "" {
+			targetRole, err := strconv.Atoi(raw)
+			if err != nil {
+				respond.Error(c, http.StatusBadRequest, "Invalid role", err)
+				return
+			}
+			filter["role"] = targetRole
+		}
+	}
+	if metric := c.Query("metric"); metric != "" {
+		filter["metric"] = metric
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	cursor, err := tc.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "metric", Value: 1}, {Key: "period", Value: 1}}))
+	if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to fetch targets", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	targets := []models.Target{}
+	if err := cursor.All(ctx, &targets); err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to parse targets", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": targets})
+}
+
+// UpdateTarget changes a target's goal. Staff only. The metric and period
+// stay fixed so that snapshots of earlier periods keep meaning the same.
+func (tc *TargetController) UpdateTarget(c *gin.Context) {
+	if c.GetInt("userRole") != userModels.RoleStaff {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only staff can change targets"})
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid target ID", err)
+		return
+	}
+	var req UpdateTargetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid request payload", err)
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	now := time.Now()
+	var before models.Target
+	err = tc.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"goal": req.Goal, "updated_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Target not found"})
+		return
+	} else if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to update target", err)
+		return
+	}
+	target := before
+	target.Goal = req.Goal
+	target.UpdatedAt = now
+	audit.Record(c, audit.EntityTarget, audit.Updated, target.ID, before, target)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Target has been updated",
+		"data":    target,
+	})
+}
+
+// DeleteTarget removes a target. Staff only; its snapshots are kept.
+func (tc *TargetController) DeleteTarget(c *gin.Context) {
+	if c.GetInt("userRole") != userModels.RoleStaff {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only staff can delete targets"})
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "Invalid target ID", err)
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	var deleted models.Target
+	err = tc.collection.FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&deleted)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Target not found"})
+		return
+	} else if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to delete target", err)
+		return
+	}
+	audit.Record(c, audit.EntityTarget, audit.Deleted, id, deleted, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Target has been deleted",
+		"id":      id.Hex(),
+	})
+}
+
+// applicable returns the targets in effect for a user: their own, plus their
+// role's for any metric and period they have no own target for.
+func (tc *TargetController) applicable(ctx context.Context, userID primitive.ObjectID, role int) ([]models.Target, error) {
+	cursor, err := tc.collection.Find(ctx, bson.M{"$or": []bson.M{{"user_id": userID}, {"role": role}}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var all []models.Target
+	if err := cursor.All(ctx, &all); err != nil {
+		return nil, err
+	}
+	own := map[string]bool{}
+	for _, target := range all {
+		if target.UserID != nil {
+			own[target.Metric+"/"+target.Period] = true
+		}
+	}
+	targets := []models.Target{}
+	for _, target := range all {
+		if target.UserID != nil || !own[target.Metric+"/"+target.Period] {
+			targets = append(targets, target)
+		}
+	}
+	return targets, nil
+}
+
+// actual counts a user's activity towards a metric between start and end.
+func (tc *TargetController) actual(ctx context.Context, metric string, userID primitive.ObjectID, start, end time.Time) (int64, error) {
+	filter := models.MetricFilter(metric, start, end)
+	filter["user_id"] = userID
+	return tc.sources[metric].CountDocuments(ctx, filter)
+}
+
+func progress(target models.Target, start, end time.Time, actual int64) TargetProgress {
+	p := TargetProgress{
+		Target:      target,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Actual:      actual,
+		Achieved:    actual >= target.Goal,
+	}
+	if !p.Achieved {
+		p.Remaining = target.Goal - actual
+	}
+	if target.Goal > 0 {
+		p.Percent = float64(actual) / float64(target.Goal) * 100
+	}
+	return p
+}
+
+// GetProgress compares the current period's actuals with every target in
+// effect for the caller, or for staff, for the user in user_id. A date
+// query value picks the period containing that day instead.
+func (tc *TargetController) GetProgress(c *gin.Context) {
+	at := time.Now()
+	if raw := c.Query("date"); raw != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", raw, tc.location)
+		if err != nil {
+			respond.Error(c, http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD", err)
+			return
+		}
+		at = parsed
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	userID, role, ok := tc.subject(ctx, c)
+	if !ok {
+		return
+	}
+	targets, err := tc.applicable(ctx, userID, role)
+	if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to fetch targets", err)
+		return
+	}
+
+	results := make([]TargetProgress, 0, len(targets))
+	for _, target := range targets {
+		start, end := models.PeriodBounds(target.Period, at, tc.location)
+		actual, err := tc.actual(ctx, target.Metric, userID, start, end)
+		if err != nil {
+			respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to count activity", err)
+			return
+		}
+		results = append(results, progress(target, start, end, actual))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": userID,
+		"data":    results,
+	})
+}
+
+// GetHistory lists the snapshots of ended periods, newest first.
+func (tc *TargetController) GetHistory(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	userID, _, ok := tc.subject(ctx, c)
+	if !ok {
+		return
+	}
+	filter := bson.M{"user_id": userID}
+	if metric := c.Query("metric"); metric != "" {
+		filter["metric"] = metric
+	}
+	if period := c.Query("period"); period != "" {
+		filter["period"] = period
+	}
+
+	total, err := tc.snapshots.CountDocuments(ctx, filter)
+	if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to count snapshots", err)
+		return
+	}
+	cursor, err := tc.snapshots.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "period_start", Value: -1}, {Key: "metric", Value: 1}}).
+		SetSkip(int64((page-1)*limit)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to fetch snapshots", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	snapshots := []models.Snapshot{}
+	if err := cursor.All(ctx, &snapshots); err != nil {
+		respond.Error(c, database.ErrorStatus(err, http.StatusInternalServerError), "Failed to parse snapshots", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  snapshots,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// StartSnapshots records, every interval, each target's result for the
+// period that ended last. Snapshots are keyed by target, user and period
+// start, so running again or on several instances adds nothing twice.
+func (tc *TargetController) StartSnapshots(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runCtx, cancel := context.WithTimeout(ctx, interval)
+				if err := tc.SnapshotEndedPeriods(runCtx, time.Now()); err != nil {
+					log.Printf("Error snapshotting targets: %v", err)
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// maxSnapshotPeriods bounds how many ended periods one run snapshots per
+// target and user, so that catching up on an old target is spread over runs.
+const maxSnapshotPeriods = 60
+
+// SnapshotEndedPeriods stores the results of every ended period of every
+// target, for each user it applied to. It picks up after the last period
+// snapshotted for the user, or from when the target was created, so periods
+// missed while the server was down are filled in. Missed periods are scored
+// against the current goal.
+func (tc *TargetController) SnapshotEndedPeriods(ctx context.Context, now time.Time) error {
+	cursor, err := tc.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	var targets []models.Target
+	if err := cursor.All(ctx, &targets); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, target := range targets {
+		current, _ := models.PeriodBounds(target.Period, now, tc.location)
+		if !target.CreatedAt.Before(current) {
+			continue
+		}
+		users, err := tc.targetUsers(ctx, target, targets)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, userID := range users {
+			from, err := tc.nextSnapshot(ctx, target, userID)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for n := 0; from.Before(current) && n < maxSnapshotPeriods; n++ {
+				start, end := models.PeriodBounds(target.Period, from, tc.location)
+				if err := tc.snapshot(ctx, target, userID, start, end, now); err != nil {
+					errs = append(errs, err)
+					break
+				}
+				from = end
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// nextSnapshot returns the start of the first period of the target not yet
+// snapshotted for the user.
+func (tc *TargetController) nextSnapshot(ctx context.Context, target models.Target, userID primitive.ObjectID) (time.Time, error) {
+	var last models.Snapshot
+	err := tc.snapshots.FindOne(ctx,
+		bson.M{"target_id": target.ID, "user_id": userID},
+		options.FindOne().SetSort(bson.M{"period_start": -1}).SetProjection(bson.M{"period_end": 1}),
+	).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		start, _ := models.PeriodBounds(target.Period, target.CreatedAt, tc.location)
+		return start, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	return last.PeriodEnd, nil
+}
+
+// targetUsers lists who a target applies to: its user, or everyone with its
+// role except users who have their own target for the metric and period.
+func (tc *TargetController) targetUsers(ctx context.Context, target models.Target, targets []models.Target) ([]primitive.ObjectID, error) {
+	if target.UserID != nil {
+		return []primitive.ObjectID{*target.UserID}, nil
+	}
+	var excluded []primitive.ObjectID
+	for _, other := range targets {
+		if other.UserID != nil && other.Metric == target.Metric && other.Period == target.Period {
+			excluded = append(excluded, *other.UserID)
+		}
+	}
+	filter := bson.M{"role": target.Role}
+	if len(excluded) > 0 {
+		filter["_id"] = bson.M{"$nin": excluded}
+	}
+	cursor, err := tc.users.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []primitive.ObjectID
+	for cursor.Next(ctx) {
+		var user struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&user); err != nil {
+			return nil, err
+		}
+		users = append(users, user.ID)
+	}
+	return users, cursor.Err()
+}
+
+func (tc *TargetController) snapshot(ctx context.Context, target models.Target, userID primitive.ObjectID, start, end, now time.Time) error {
+	key := bson.M{"target_id": target.ID, "user_id": userID, "period_start": start}
+	if err := tc.snapshots.FindOne(ctx, key).Err(); err == nil {
+		return nil
+	} else if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	actual, err := tc.actual(ctx, target.Metric, userID, start, end)
+	if err != nil {
+		return err
+	}
+	snapshot := models.Snapshot{
+		TargetID:    target.ID,
+		UserID:      userID,
+		Metric:      target.Metric,
+		Period:      target.Period,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Goal:        target.Goal,
+		Actual:      actual,
+		Achieved:    actual >= target.Goal,
+		CreatedAt:   now,
+	}
+	_, err = tc.snapshots.UpdateOne(ctx, key, bson.M{"$setOnInsert": snapshot}, options.Update().SetUpsert(true))
+	return err
+}
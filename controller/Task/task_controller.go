@@ -0,0 +1,275 @@
+package TaskControllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Arkariza/API_MyActivity/audit"
+	"github.com/Arkariza/API_MyActivity/auth/middleware"
+	database "github.com/Arkariza/API_MyActivity/models"
+	"github.com/Arkariza/API_MyActivity/models/Task"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// taskTimeZone is where the days of the today and upcoming views start and
+// end.
+const taskTimeZone = "Asia/Jakarta"
+
+type TaskController struct {
+	collection *mongo.Collection
+	calls      *mongo.Collection
+	meets      *mongo.Collection
+	location   *time.Location
+}
+
+func NewTaskController(collection, calls, meets *mongo.Collection) *TaskController {
+	location, err := time.LoadLocation(taskTimeZone)
+	if err != nil {
+		location = time.UTC
+	}
+	return &TaskController{
+		collection: collection,
+		calls:      calls,
+		meets:      meets,
+		location:   location,
+	}
+}
+
+type AddTaskRequest struct {
+	Type    string    `json:"type" binding:"required,oneof=call meet"`
+	Title   string    `json:"title" binding:"required"`
+	Note    string    `json:"note"`
+	DueDate time.Time `json:"due_date" binding:"required"`
+	LeadID  string    `json:"lead_id"`
+	CallID  string    `json:"call_id"`
+}
+
+type CompleteTaskRequest struct {
+	CallID string `json:"call_id"`
+	MeetID string `json:"meet_id"`
+}
+
+const (
+	ViewOverdue  = "overdue"
+	ViewToday    = "today"
+	ViewUpcoming = "upcoming"
+	ViewDone     = "done"
+)
+
+func optionalID(value string) (*primitive.ObjectID, error) {
+	if value == "" {
+		return nil, nil
+	}
+	id, err := primitive.ObjectIDFromHex(value)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+func (tc *TaskController) AddTask(c *gin.Context) {
+	userID, _, ok := AuthMiddleware.CurrentUser(c)
+	if !ok {
+		return
+	}
+
+	var req AddTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	leadID, err := optionalID(req.LeadID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid lead ID"})
+		return
+	}
+	callID, err := optionalID(req.CallID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid call ID"})
+		return
+	}
+
+	task := models.Task{
+		UserID:  userID,
+		Type:    req.Type,
+		Title:   req.Title,
+		Note:    req.Note,
+		DueDate: req.DueDate,
+		LeadID:  leadID,
+		CallID:  callID,
+	}
+	if err := task.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	task.BeforeCreate()
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	if _, err := tc.collection.InsertOne(ctx, task); err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{
+			"error":   "Failed to create task",
+			"details": err.Error(),
+		})
+		return
+	}
+	audit.Record(c, audit.EntityTask, audit.Created, task.ID, nil, task)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Task created successfully",
+		"data":    task,
+	})
+}
+
+// GetTasks lists the caller's tasks. The view query selects open tasks that
+// are overdue, due today or due later; view=done lists completed tasks.
+// Without a view every open task is returned, soonest first.
+func (tc *TaskController) GetTasks(c *gin.Context) {
+	userID, _, ok := AuthMiddleware.CurrentUser(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now().In(tc.location)
+	year, month, day := now.Date()
+	endOfToday := time.Date(year, month, day, 0, 0, 0, 0, tc.location).AddDate(0, 0, 1)
+
+	filter := bson.M{"user_id": userID, "status": models.TaskOpen}
+	sort := bson.D{{Key: "due_date", Value: 1}}
+
+	switch view := c.Query("view"); view {
+	case "":
+	case ViewOverdue:
+		filter["due_date"] = bson.M{"$lt": now}
+	case ViewToday:
+		filter["due_date"] = bson.M{"$gte": now, "$lt": endOfToday}
+	case ViewUpcoming:
+		filter["due_date"] = bson.M{"$gte": endOfToday}
+	case ViewDone:
+		filter["status"] = models.TaskDone
+		sort = bson.D{{Key: "completed_at", Value: -1}}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "view must be one of: overdue, today, upcoming, done"})
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	cursor, err := tc.collection.Find(ctx, filter, options.Find().SetSort(sort).SetLimit(200))
+	if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to fetch tasks"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	tasks := []models.Task{}
+	if err := cursor.All(ctx, &tasks); err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to decode tasks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tasks": tasks,
+		"total": len(tasks),
+	})
+}
+
+// CompleteTask closes an open task, linking the call or meet that resolved
+// it. The linked activity must exist.
+func (tc *TaskController) CompleteTask(c *gin.Context) {
+	userID, _, ok := AuthMiddleware.CurrentUser(c)
+	if !ok {
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	var req CompleteTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+	callID, err := optionalID(req.CallID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid call ID"})
+		return
+	}
+	meetID, err := optionalID(req.MeetID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid meet ID"})
+		return
+	}
+	if callID == nil && meetID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "call_id or meet_id is required"})
+		return
+	}
+
+	ctx, cancel := database.QueryContext(c.Request.Context())
+	defer cancel()
+
+	fields := bson.M{"status": models.TaskDone, "completed_at": time.Now()}
+	for _, link := range []struct {
+		id         *primitive.ObjectID
+		collection *mongo.Collection
+		field      string
+		name       string
+	}{
+		{callID, tc.calls, "result_call_id", "Call"},
+		{meetID, tc.meets, "result_meet_id", "Meet"},
+	} {
+		if link.id == nil {
+			continue
+		}
+		count, err := link.collection.CountDocuments(ctx, bson.M{"_id": *link.id})
+		if err != nil {
+			c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to verify " + link.field})
+			return
+		}
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": link.name + " not found"})
+			return
+		}
+		fields[link.field] = *link.id
+	}
+
+	filter := bson.M{"_id": id, "user_id": userID, "status": models.TaskOpen}
+	var before models.Task
+	if err := tc.collection.FindOne(ctx, filter).Decode(&before); err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Open task not found"})
+		return
+	} else if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to complete task"})
+		return
+	}
+
+	var task models.Task
+	err = tc.collection.FindOneAndUpdate(ctx,
+		filter,
+		bson.M{"$set": fields},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&task)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Open task not found"})
+		return
+	} else if err != nil {
+		c.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to complete task"})
+		return
+	}
+	audit.Record(c, audit.EntityTask, audit.Updated, task.ID, before, task)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Task completed",
+		"data":    task,
+	})
+}
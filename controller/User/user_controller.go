@@ -1,12 +1,17 @@
 package UserControllers
 
 import (
-	"context"
 	"net/http"
+	"strings"
 
+	"github.com/Arkariza/API_MyActivity/audit"
 	"github.com/Arkariza/API_MyActivity/auth"
+	database "github.com/Arkariza/API_MyActivity/models"
 	"github.com/Arkariza/API_MyActivity/models/User"
+	"github.com/Arkariza/API_MyActivity/phone"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"gorm.io/gorm"
 )
 
@@ -29,10 +34,14 @@ type RegisterRequest struct {
     Username string `json:"username" binding:"required,min=3,max=50"`
     Email    string `json:"email" binding:"required,email"`
     Password string `json:"password" binding:"required,min=6"`
-    PhoneNum string `json:"phone_num" binding:"required"`
+    PhoneNum string `json:"phone_num" binding:"required,phone"`
     Role     int    `json:"role" binding:"required,oneof=1 2"`
 }
 
+type AssignTeamRequest struct {
+    Team string `json:"team" binding:"max=100"`
+}
+
 func (c *UserController) Register(ctx *gin.Context) {
     var request RegisterRequest
     if err := ctx.ShouldBindJSON(&request); err != nil {
@@ -48,19 +57,21 @@ func (c *UserController) Register(ctx *gin.Context) {
         Username: request.Username,
         Email:    request.Email,
         Password: request.Password,
-        PhoneNum: request.PhoneNum,
+        PhoneNum: phone.Format(request.PhoneNum),
         Role:     request.Role,
     }
-    ctxRequest := context.Background()
+    ctxRequest, cancel := database.QueryContext(ctx.Request.Context())
+    defer cancel()
     user, err := c.authCommand.Register(ctxRequest, cmdRequest)
     if err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{
+        ctx.JSON(database.ErrorStatus(err, http.StatusBadRequest), gin.H{
             "status":  false,
             "message": "Registration failed",
             "error":   err.Error(),
         })
         return
     }
+    audit.Record(ctx, audit.EntityUser, audit.Created, user.ID, nil, user)
 
     ctx.JSON(http.StatusCreated, gin.H{
         "status":  true,
@@ -69,6 +80,65 @@ func (c *UserController) Register(ctx *gin.Context) {
     })
 }
 
+// AssignTeam puts the user in a team, or takes them out of theirs when team
+// is empty. Teams decide whose activity a user is ranked and reported with, so
+// only staff may set them.
+func (c *UserController) AssignTeam(ctx *gin.Context) {
+    role, _ := ctx.Get("userRole")
+    if role != models.RoleStaff {
+        ctx.JSON(http.StatusForbidden, gin.H{
+            "status":  false,
+            "message": "Only staff can assign teams",
+        })
+        return
+    }
+
+    userID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+    if err != nil {
+        ctx.JSON(http.StatusBadRequest, gin.H{
+            "status":  false,
+            "message": "Invalid user ID",
+            "error":   err.Error(),
+        })
+        return
+    }
+
+    var request AssignTeamRequest
+    if err := ctx.ShouldBindJSON(&request); err != nil {
+        ctx.JSON(http.StatusBadRequest, gin.H{
+            "status":  false,
+            "message": "Invalid request data",
+            "error":   err.Error(),
+        })
+        return
+    }
+
+    ctxRequest, cancel := database.QueryContext(ctx.Request.Context())
+    defer cancel()
+    before, user, err := c.authCommand.AssignTeam(ctxRequest, userID, strings.TrimSpace(request.Team))
+    if err == mongo.ErrNoDocuments {
+        ctx.JSON(http.StatusNotFound, gin.H{
+            "status":  false,
+            "message": "User not found",
+        })
+        return
+    } else if err != nil {
+        ctx.JSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{
+            "status":  false,
+            "message": "Failed to assign team",
+            "error":   err.Error(),
+        })
+        return
+    }
+    audit.Record(ctx, audit.EntityUser, audit.Updated, user.ID, before, user)
+
+    ctx.JSON(http.StatusOK, gin.H{
+        "status":  true,
+        "message": "Team assigned",
+        "data":    user,
+    })
+}
+
 func (c *UserController) Login(ctx *gin.Context) {
     var request LoginRequest
     if err := ctx.ShouldBindJSON(&request); err != nil {
@@ -84,10 +154,11 @@ func (c *UserController) Login(ctx *gin.Context) {
         Username: request.Username,
         Password: request.Password,
     }
-    ctxRequest := context.Background()
+    ctxRequest, cancel := database.QueryContext(ctx.Request.Context())
+    defer cancel()
     tokenResponse, err := c.authCommand.Login(ctxRequest, cmdRequest)
     if err != nil {
-        ctx.JSON(http.StatusUnauthorized, gin.H{
+        ctx.JSON(database.ErrorStatus(err, http.StatusUnauthorized), gin.H{
             "status":  false,
             "message": "Login failed",
             "error":   err.Error(),
@@ -122,7 +193,7 @@ func (c *UserController) GetProfile(ctx *gin.Context) {
 func (c *UserController) UpdateProfile(ctx *gin.Context) {
     var request struct {
         Email    string `json:"email" binding:"omitempty,email"`
-        PhoneNum string `json:"phone_num"`
+        PhoneNum string `json:"phone_num" binding:"omitempty,phone"`
         Image    string `json:"image"`
     }
 
@@ -150,7 +221,7 @@ func (c *UserController) UpdateProfile(ctx *gin.Context) {
         user.Email = request.Email
     }
     if request.PhoneNum != "" {
-        user.PhoneNum = request.PhoneNum
+        user.PhoneNum = phone.Format(request.PhoneNum)
     }
     if request.Image != "" {
         user.Image = request.Image
@@ -0,0 +1,403 @@
+package docs
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Schema map[string]interface{}
+
+type Param struct {
+	Name        string
+	Description string
+	Type        string
+	Required    bool
+}
+
+type Operation struct {
+	Method      string
+	Path        string
+	Tag         string
+	Summary     string
+	Public      bool
+	Query       []Param
+	Headers     []Param
+	Request     interface{}
+	Status      int
+	Response    interface{}
+	ContentType string
+	// RequestContentType defaults to application/json.
+	RequestContentType string
+}
+
+var pathParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+func openAPIPath(ginPath string) string {
+	path := strings.TrimSuffix(ginPath, "/")
+	if path == "" {
+		path = "/"
+	}
+	return pathParam.ReplaceAllString(path, "{$1}")
+}
+
+func routeKey(method, ginPath string) string {
+	return method + " " + openAPIPath(ginPath)
+}
+
+type builder struct {
+	components map[string]Schema
+	names      map[reflect.Type]string
+}
+
+func (b *builder) schemaOf(t reflect.Type) Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return Schema{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(primitive.ObjectID{}):
+		return Schema{"type": "string", "pattern": "^[0-9a-f]{24}$"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": b.schemaOf(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": b.schemaOf(t.Elem())}
+	case reflect.Struct:
+		return b.ref(t)
+	}
+	return Schema{}
+}
+
+func (b *builder) ref(t reflect.Type) Schema {
+	if name, ok := b.names[t]; ok {
+		return Schema{"$ref": "#/components/schemas/" + name}
+	}
+
+	name := t.Name()
+	if name == "" {
+		return b.object(t)
+	}
+	if _, taken := b.components[name]; taken {
+		pkg := t.PkgPath()
+		name = pkg[strings.LastIndex(pkg, "/")+1:] + name
+	}
+	b.names[t] = name
+	b.components[name] = Schema{}
+	b.components[name] = b.object(t)
+	return Schema{"$ref": "#/components/schemas/" + name}
+}
+
+func (b *builder) object(t reflect.Type) Schema {
+	properties := Schema{}
+	var required []string
+	b.fields(t, properties, &required)
+
+	schema := Schema{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// fields collects the json properties of t, flattening embedded structs the
+// same way encoding/json does.
+func (b *builder) fields(t reflect.Type, properties Schema, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			b.fields(field.Type, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		name, omit := jsonName(field)
+		if name == "-" {
+			continue
+		}
+		properties[name] = b.schemaOf(field.Type)
+		if hasRule(field.Tag.Get("binding"), "phone") {
+			properties[name] = Schema{"type": "string", "example": "+6281234567890",
+				"description": "Phone number; local Indonesian forms such as 0812-3456-7890 are accepted and stored as E.164"}
+		}
+
+		if !omit && strings.Contains(field.Tag.Get("binding"), "required") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func hasRule(binding, rule string) bool {
+	for _, r := range strings.Split(binding, ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "" {
+		return field.Name, false
+	}
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	omit := false
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omit = true
+		}
+	}
+	return name, omit
+}
+
+func (b *builder) payload(v interface{}) Schema {
+	switch value := v.(type) {
+	case nil:
+		return Schema{"type": "object"}
+	case Schema:
+		out := Schema{}
+		for k, inner := range value {
+			out[k] = inner
+		}
+		props, ok := value["properties"].(map[string]interface{})
+		if !ok {
+			props, ok = value["properties"].(Schema)
+		}
+		if ok {
+			resolved := Schema{}
+			for k, inner := range props {
+				resolved[k] = b.payload(inner)
+			}
+			out["properties"] = resolved
+		}
+		return out
+	default:
+		return b.schemaOf(reflect.TypeOf(v))
+	}
+}
+
+// Envelope describes the gin.H wrappers the controllers respond with, e.g.
+// {"message": "...", "data": {...}}. Values may be Go values, whose schema is
+// derived from their struct tags, or hand written Schemas.
+func Envelope(fields map[string]interface{}) Schema {
+	return Schema{"type": "object", "properties": fields}
+}
+
+func parameters(op Operation) []Schema {
+	var params []Schema
+	for _, match := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+		params = append(params, Schema{
+			"name": match[1], "in": "path", "required": true,
+			"schema": Schema{"type": "string"},
+		})
+	}
+	add := func(in string, list []Param) {
+		for _, p := range list {
+			typ := p.Type
+			if typ == "" {
+				typ = "string"
+			}
+			params = append(params, Schema{
+				"name": p.Name, "in": in, "required": p.Required,
+				"description": p.Description, "schema": Schema{"type": typ},
+			})
+		}
+	}
+	add("query", op.Query)
+	add("header", op.Headers)
+	return params
+}
+
+func Build(operations []Operation) Schema {
+	b := &builder{components: map[string]Schema{}, names: map[reflect.Type]string{}}
+	paths := Schema{}
+
+	for _, op := range operations {
+		key := openAPIPath(op.Path)
+		item, ok := paths[key].(Schema)
+		if !ok {
+			item = Schema{}
+			paths[key] = item
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		contentType := op.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+
+		operation := Schema{
+			"tags":        []string{op.Tag},
+			"summary":     op.Summary,
+			"operationId": operationID(op),
+			"responses": Schema{
+				strconv.Itoa(status): Schema{
+					"description": http.StatusText(status),
+					"content":     Schema{contentType: Schema{"schema": b.payload(op.Response)}},
+				},
+				"default": Schema{
+					"description": "Error",
+					"content":     Schema{"application/json": Schema{"schema": Schema{"$ref": "#/components/schemas/Error"}}},
+				},
+			},
+		}
+		if params := parameters(op); len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if op.Request != nil {
+			requestType := op.RequestContentType
+			if requestType == "" {
+				requestType = "application/json"
+			}
+			operation["requestBody"] = Schema{
+				"required": true,
+				"content":  Schema{requestType: Schema{"schema": b.payload(op.Request)}},
+			}
+		}
+		if !op.Public {
+			operation["security"] = []Schema{{"bearerAuth": []string{}}}
+		}
+
+		item[strings.ToLower(op.Method)] = operation
+	}
+
+	b.components["Error"] = Schema{
+		"type": "object",
+		"properties": Schema{
+			"error":   Schema{"type": "string"},
+			"details": Schema{"type": "string"},
+		},
+	}
+
+	return Schema{
+		"openapi": "3.0.3",
+		"info": Schema{
+			"title":   "MyActivity API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": Schema{
+			"schemas": b.components,
+			"securitySchemes": Schema{
+				"bearerAuth": Schema{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+}
+
+func operationID(op Operation) string {
+	words := strings.FieldsFunc(op.Path, func(r rune) bool {
+		return r == '/' || r == ':' || r == '_' || r == '-'
+	})
+	id := strings.ToLower(op.Method)
+	for _, w := range words {
+		if w == "api" {
+			continue
+		}
+		id += strings.ToUpper(w[:1]) + w[1:]
+	}
+	return id
+}
+
+// Verify returns an error naming every registered /api route that has no
+// matching operation, and every operation that no route matches, so a route
+// cannot ship without documentation and the documentation cannot outlive a
+// route.
+func Verify(routes gin.RoutesInfo, operations []Operation) error {
+	documented := map[string]bool{}
+	for _, op := range operations {
+		documented[routeKey(op.Method, op.Path)] = true
+	}
+
+	registered := map[string]bool{}
+	var undocumented []string
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, "/api") {
+			continue
+		}
+		key := routeKey(route.Method, route.Path)
+		registered[key] = true
+		if !documented[key] {
+			undocumented = append(undocumented, route.Method+" "+route.Path)
+		}
+	}
+
+	var stale []string
+	for _, op := range operations {
+		if !registered[routeKey(op.Method, op.Path)] {
+			stale = append(stale, op.Method+" "+op.Path)
+		}
+	}
+
+	var problems []string
+	if len(undocumented) > 0 {
+		sort.Strings(undocumented)
+		problems = append(problems, "undocumented routes: "+strings.Join(undocumented, ", "))
+	}
+	if len(stale) > 0 {
+		sort.Strings(stale)
+		problems = append(problems, "documented routes that are not registered: "+strings.Join(stale, ", "))
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+const uiPage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>MyActivity API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    SwaggerUIBundle({ url: "/api/openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>`
+
+func SpecHandler(spec Schema) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, spec)
+	}
+}
+
+func UIHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(uiPage))
+	}
+}
@@ -0,0 +1,74 @@
+package docs
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestVerify(t *testing.T) {
+	routes := gin.RoutesInfo{
+		{Method: http.MethodGet, Path: "/api/leads/:id"},
+		{Method: http.MethodPost, Path: "/api/leads/add"},
+		{Method: http.MethodGet, Path: "/metrics"},
+	}
+
+	tests := []struct {
+		name       string
+		operations []Operation
+		want       []string
+	}{
+		{
+			name: "all documented",
+			operations: []Operation{
+				{Method: http.MethodGet, Path: "/api/leads/:id"},
+				{Method: http.MethodPost, Path: "/api/leads/add"},
+			},
+		},
+		{
+			name: "undocumented route",
+			operations: []Operation{
+				{Method: http.MethodGet, Path: "/api/leads/:id"},
+			},
+			want: []string{"undocumented routes: POST /api/leads/add"},
+		},
+		{
+			name: "stale operation",
+			operations: []Operation{
+				{Method: http.MethodGet, Path: "/api/leads/:id"},
+				{Method: http.MethodPost, Path: "/api/leads/add"},
+				{Method: http.MethodDelete, Path: "/api/leads/:id"},
+			},
+			want: []string{"not registered: DELETE /api/leads/:id"},
+		},
+		{
+			name: "both",
+			operations: []Operation{
+				{Method: http.MethodPost, Path: "/api/leads/add"},
+				{Method: http.MethodPut, Path: "/api/leads/:id"},
+			},
+			want: []string{"undocumented routes: GET /api/leads/:id", "not registered: PUT /api/leads/:id"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(routes, tt.operations)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Verify() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Verify() = nil, want error containing %q", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Verify() = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,795 @@
+package docs
+
+import (
+	"net/http"
+
+	"github.com/Arkariza/API_MyActivity/auth"
+	"github.com/Arkariza/API_MyActivity/controller/Analytics"
+	"github.com/Arkariza/API_MyActivity/controller/Call"
+	"github.com/Arkariza/API_MyActivity/controller/Comment"
+	"github.com/Arkariza/API_MyActivity/controller/Commission"
+	"github.com/Arkariza/API_MyActivity/controller/Lead"
+	"github.com/Arkariza/API_MyActivity/controller/Meet"
+	"github.com/Arkariza/API_MyActivity/controller/Notification"
+	"github.com/Arkariza/API_MyActivity/controller/Sync"
+	"github.com/Arkariza/API_MyActivity/controller/Target"
+	"github.com/Arkariza/API_MyActivity/controller/Task"
+	"github.com/Arkariza/API_MyActivity/controller/User"
+	"github.com/Arkariza/API_MyActivity/events"
+	attachment "github.com/Arkariza/API_MyActivity/models/Attachment"
+	auditlog "github.com/Arkariza/API_MyActivity/models/Audit"
+	activity "github.com/Arkariza/API_MyActivity/models/CallAndMeet"
+	commission "github.com/Arkariza/API_MyActivity/models/Commission"
+	lead "github.com/Arkariza/API_MyActivity/models/ManageLead"
+	notification "github.com/Arkariza/API_MyActivity/models/Notification"
+	target "github.com/Arkariza/API_MyActivity/models/Target"
+	task "github.com/Arkariza/API_MyActivity/models/Task"
+	user "github.com/Arkariza/API_MyActivity/models/User"
+)
+
+var pagination = []Param{
+	{Name: "page", Type: "integer", Description: "Page number, starting at 1"},
+	{Name: "limit", Type: "integer", Description: "Items per page"},
+}
+
+var nearby = []Param{
+	{Name: "lat", Type: "number", Required: true, Description: "Latitude of the search center"},
+	{Name: "lng", Type: "number", Required: true, Description: "Longitude of the search center"},
+	{Name: "radius", Type: "number", Description: "Search radius in meters, default 3000, max 50000"},
+	{Name: "limit", Type: "integer", Description: "Maximum number of results"},
+}
+
+// ifMatch is required by updates to versioned records.
+var ifMatch = []Param{
+	{Name: "If-Match", Required: true, Description: "ETag from the last read of the record; 428 when missing, 412 when the record has changed since"},
+}
+
+// optionalIfMatch is accepted by deletes, which only check the version when it
+// is sent.
+var optionalIfMatch = []Param{
+	{Name: "If-Match", Description: "ETag from the last read of the record; 412 when the record has changed since"},
+}
+
+// idempotencyKey is accepted by the create endpoints.
+var idempotencyKey = []Param{
+	{Name: "Idempotency-Key", Description: "Unique key for this request; a retry with the same key and body replays " +
+		"the original response with Idempotent-Replayed: true, 422 when the key was used for a different request, " +
+		"409 while the first request is still being handled"},
+}
+
+// syncChanges describes one kind of record in a sync response.
+func syncChanges(records interface{}) Schema {
+	return Envelope(map[string]interface{}{
+		"created": records,
+		"updated": records,
+		"deleted": []SyncControllers.Removal{},
+	})
+}
+
+func paginated(extra ...Param) []Param {
+	return append(append([]Param{}, pagination...), extra...)
+}
+
+// reportParams are the filters shared by the analytics reports, followed by
+// the report's own.
+func reportParams(extra ...Param) []Param {
+	return append([]Param{
+		{Name: "from", Description: "Start date, YYYY-MM-DD"},
+		{Name: "to", Description: "End date (inclusive), YYYY-MM-DD"},
+		{Name: "bfa", Description: "Only this user's activity (staff only)"},
+		{Name: "team", Description: "Only activity of this team's members (staff only)"},
+	}, extra...)
+}
+
+// exportParams are the query parameters of the export routes, followed by
+// the route's own filters.
+func exportParams(filters ...Param) []Param {
+	return append([]Param{
+		{Name: "format", Description: "csv (default), xlsx or ndjson"},
+		{Name: "tz", Description: "IANA time zone for date columns, default Asia/Jakarta"},
+		{Name: "date_format", Description: "iso (default), id (dd/mm/yyyy) or us (mm/dd/yyyy)"},
+	}, filters...)
+}
+
+func message(fields map[string]interface{}) Schema {
+	fields["message"] = Schema{"type": "string"}
+	return Envelope(fields)
+}
+
+func status(fields map[string]interface{}) Schema {
+	fields["status"] = Schema{"type": "boolean"}
+	return message(fields)
+}
+
+// upload is the multipart/form-data body of the attachment upload routes.
+var upload = Envelope(map[string]interface{}{
+	"file": Schema{"type": "string", "format": "binary"},
+})
+
+// Operations lists every route registered in main.go. Request and response
+// bodies point at the same structs the controllers bind and return, so the
+// schemas follow their json and binding tags.
+var Operations = []Operation{
+	{
+		Method: http.MethodPost, Path: "/api/register", Tag: "auth", Public: true,
+		Summary: "Register a new user",
+		Request: UserControllers.RegisterRequest{}, Status: http.StatusCreated,
+		Response: status(map[string]interface{}{"data": user.User{}}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/login", Tag: "auth", Public: true,
+		Summary:  "Log in and receive a bearer token",
+		Request:  UserControllers.LoginRequest{},
+		Response: status(map[string]interface{}{"data": auth.TokenResponse{}}),
+	},
+	{
+		Method: http.MethodPut, Path: "/api/users/:id/team", Tag: "auth",
+		Summary:  "Put a user in a team, or take them out of theirs with an empty team (staff only)",
+		Request:  UserControllers.AssignTeamRequest{},
+		Response: status(map[string]interface{}{"data": user.User{}}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/openapi.json", Tag: "docs", Public: true,
+		Summary:  "This OpenAPI document",
+		Response: Schema{"type": "object"},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/docs", Tag: "docs", Public: true,
+		Summary:     "Interactive API documentation",
+		Response:    Schema{"type": "string"},
+		ContentType: "text/html",
+	},
+	{
+		Method: http.MethodGet, Path: "/api/stream", Tag: "stream",
+		Summary: "Server-Sent Events feed of lead, call, meet and comment changes visible to the caller",
+		Headers: []Param{
+			{Name: "Last-Event-ID", Type: "integer", Description: "Resume after this event"},
+		},
+		Query: []Param{
+			{Name: "last_event_id", Type: "integer", Description: "Same as the Last-Event-ID header"},
+		},
+		Response:    events.Event{},
+		ContentType: "text/event-stream",
+	},
+
+	{
+		Method: http.MethodPost, Path: "/api/leads/add", Tag: "leads",
+		Headers: idempotencyKey,
+		Summary: "Create a lead owned by the caller; 409 with the matching leads and their owners " +
+			"when the phone number or client name is already registered (staff may pass force=true)",
+		Request: LeadController.AddLeadRequest{}, Status: http.StatusCreated,
+		Response: message(map[string]interface{}{"data": lead.Lead{}}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/leads/", Tag: "leads",
+		Summary: "List leads",
+		Response: Envelope(map[string]interface{}{
+			"leads": []lead.Lead{},
+			"total": Schema{"type": "integer"},
+		}),
+	},
+
+	{
+		Method: http.MethodGet, Path: "/api/leads/export", Tag: "leads",
+		Summary:     "Export all leads as CSV, XLSX or NDJSON, streamed",
+		Query:       exportParams(),
+		Response:    Schema{"type": "string", "format": "binary"},
+		ContentType: "text/csv",
+	},
+	{
+		Method: http.MethodGet, Path: "/api/leads/duplicates", Tag: "leads",
+		Summary: "Groups of leads sharing a phone number or client name (staff only)",
+		Response: Envelope(map[string]interface{}{
+			"groups": []LeadController.DuplicateGroup{},
+			"total":  Schema{"type": "integer"},
+		}),
+	},
+
+	{
+		Method: http.MethodGet, Path: "/api/leads/nearby", Tag: "leads",
+		Summary: "The caller's leads near a point, nearest first",
+		Query:   nearby,
+		Response: Envelope(map[string]interface{}{
+			"leads":  []LeadController.NearbyLead{},
+			"radius": Schema{"type": "number"},
+		}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/leads/import", Tag: "leads",
+		Headers: idempotencyKey,
+		Summary: "Import leads from a CSV or XLSX file (staff only); dry_run=true only validates, " +
+			"otherwise a background job is started. Rows may not be Win or Lose; leads are closed through the status endpoint. " +
+			"Reff rows name the BFA user who referred them in a referrerId column",
+		Request: Envelope(map[string]interface{}{
+			"file":    Schema{"type": "string", "format": "binary"},
+			"mapping": Schema{"type": "string", "description": `JSON object of lead field to column header, e.g. {"numPhone": "Phone No"}`},
+			"dry_run": Schema{"type": "boolean"},
+		}),
+		RequestContentType: "multipart/form-data",
+		Status:             http.StatusAccepted,
+		Response:           message(map[string]interface{}{"data": lead.ImportJob{}}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/leads/import/:id", Tag: "leads",
+		Summary:  "Get the progress of a lead import",
+		Response: Envelope(map[string]interface{}{"data": lead.ImportJob{}}),
+	},
+
+	{
+		Method: http.MethodGet, Path: "/api/leads/:id", Tag: "leads",
+		Summary:  "Get a lead; the ETag header carries its version",
+		Response: Envelope(map[string]interface{}{"data": lead.Lead{}}),
+	},
+	{
+		Method: http.MethodPut, Path: "/api/leads/:id/assign", Tag: "leads",
+		Headers:  ifMatch,
+		Summary:  "Reassign a lead to another user and notify them (staff only)",
+		Request:  LeadController.AssignLeadRequest{},
+		Response: message(map[string]interface{}{"data": lead.Lead{}}),
+	},
+	{
+		Method: http.MethodPut, Path: "/api/leads/:id/status", Tag: "leads",
+		Headers: ifMatch,
+		Summary: "Change a lead's status (staff or owner); winning a referral lead accrues the " +
+			"referrer's commission, and reopening or losing it cancels one not yet approved",
+		Request: LeadController.UpdateLeadStatusRequest{},
+		Response: message(map[string]interface{}{
+			"data":       lead.Lead{},
+			"commission": commission.Commission{},
+		}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/leads/:id/merge", Tag: "leads",
+		Headers: ifMatch,
+		Summary: "Merge a duplicate into this lead, moving its calls, meets, tasks, comments, attachments and commission (staff only)",
+		Request: LeadController.MergeLeadRequest{},
+		Response: message(map[string]interface{}{
+			"data":  lead.Lead{},
+			"moved": Schema{"type": "object", "additionalProperties": Schema{"type": "integer"}},
+		}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/leads/:id/comments", Tag: "leads",
+		Summary: "List the comments on a lead as threads",
+		Response: Envelope(map[string]interface{}{
+			"comments": []CommentController.CommentThread{},
+			"total":    Schema{"type": "integer"},
+		}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/leads/:id/attachments", Tag: "leads",
+		Headers:            idempotencyKey,
+		Summary:            "Upload a photo or document to a lead (multipart field \"file\")",
+		Request:            upload,
+		RequestContentType: "multipart/form-data",
+		Status:             http.StatusCreated,
+		Response:           message(map[string]interface{}{"data": attachment.Attachment{}}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/leads/:id/attachments", Tag: "leads",
+		Summary:  "List the attachments on a lead, newest first",
+		Response: Envelope(map[string]interface{}{"data": []attachment.Attachment{}}),
+	},
+
+	{
+		Method: http.MethodPost, Path: "/api/meets/add", Tag: "meets",
+		Headers: idempotencyKey,
+		Summary: "Schedule a meet",
+		Request: MeetControllers.AddMeetRequest{}, Status: http.StatusCreated,
+		Response: message(map[string]interface{}{"data": activity.Meet{}}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/meets/", Tag: "meets",
+		Summary: "List meets",
+		Query: paginated(
+			Param{Name: "status", Description: "Filter by prospect status"},
+			Param{Name: "client_name", Description: "Case-insensitive client name search"},
+			Param{Name: "flagged", Type: "boolean", Description: "Only meets with an out-of-range check-in or check-out"},
+		),
+		Response: Envelope(map[string]interface{}{
+			"meets": []activity.Meet{},
+			"pagination": Envelope(map[string]interface{}{
+				"total":     Schema{"type": "integer"},
+				"page":      Schema{"type": "integer"},
+				"page_size": Schema{"type": "integer"},
+			}),
+		}),
+	},
+
+	{
+		Method: http.MethodGet, Path: "/api/meets/export", Tag: "meets",
+		Summary: "Export meets matching the list filters as CSV, XLSX or NDJSON, streamed",
+		Query: exportParams(
+			Param{Name: "status", Description: "Filter by prospect status"},
+			Param{Name: "client_name", Description: "Case-insensitive client name search"},
+			Param{Name: "flagged", Type: "boolean", Description: "Only meets with an out-of-range check-in or check-out"},
+		),
+		Response:    Schema{"type": "string", "format": "binary"},
+		ContentType: "text/csv",
+	},
+	{
+		Method: http.MethodGet, Path: "/api/meets/:id", Tag: "meets",
+		Summary:  "Get a meet",
+		Response: activity.Meet{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/meets/stats", Tag: "meets",
+		Summary: "Meet counts per status and completion rate",
+		Query: []Param{
+			{Name: "from", Description: "Start date, YYYY-MM-DD"},
+			{Name: "to", Description: "End date (inclusive), YYYY-MM-DD"},
+		},
+		Response: Envelope(map[string]interface{}{
+			"total":           Schema{"type": "integer"},
+			"by_status":       map[string]int64{},
+			"completion_rate": Schema{"type": "number"},
+		}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/meets/nearby", Tag: "meets",
+		Summary: "The caller's meets near a point, nearest first",
+		Query:   append(nearby, Param{Name: "status", Description: "Filter by meet status"}),
+		Response: Envelope(map[string]interface{}{
+			"meets":  []MeetControllers.NearbyMeet{},
+			"radius": Schema{"type": "number"},
+		}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/meets/route", Tag: "meets",
+		Summary: "Suggested visiting order and arrival estimates for the caller's scheduled meets on a day; " +
+			"fixed_time meets keep their appointment order and are flagged late when they cannot be reached in time",
+		Query: []Param{
+			{Name: "date", Required: true, Description: "Day to plan, YYYY-MM-DD"},
+			{Name: "start_lat", Type: "number", Required: true, Description: "Latitude of the starting point"},
+			{Name: "start_lng", Type: "number", Required: true, Description: "Longitude of the starting point"},
+			{Name: "depart_at", Description: "RFC 3339 departure time used for arrival estimates, default 08:00 Jakarta time or now if later"},
+		},
+		Response: Envelope(map[string]interface{}{
+			"date":           Schema{"type": "string", "format": "date"},
+			"depart_at":      Schema{"type": "string", "format": "date-time"},
+			"stops":          []MeetControllers.RouteStop{},
+			"total_distance": Schema{"type": "number"},
+		}),
+	},
+	{
+		Method: http.MethodPut, Path: "/api/meets/:id", Tag: "meets",
+		Headers:  ifMatch,
+		Summary:  "Update meet details",
+		Request:  MeetControllers.UpdateMeetRequest{},
+		Response: message(map[string]interface{}{}),
+	},
+	{
+		Method: http.MethodDelete, Path: "/api/meets/:id", Tag: "meets",
+		Headers:  optionalIfMatch,
+		Summary:  "Delete a meet",
+		Response: message(map[string]interface{}{}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/meets/:id/complete", Tag: "meets",
+		Headers:  ifMatch,
+		Summary:  "Mark a scheduled meet as completed",
+		Request:  MeetControllers.CompleteMeetRequest{},
+		Response: message(map[string]interface{}{"data": activity.Meet{}}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/meets/:id/cancel", Tag: "meets",
+		Headers:  ifMatch,
+		Summary:  "Cancel a scheduled meet",
+		Request:  MeetControllers.CancelMeetRequest{},
+		Response: message(map[string]interface{}{"data": activity.Meet{}}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/meets/:id/no-show", Tag: "meets",
+		Headers:  ifMatch,
+		Summary:  "Mark a scheduled meet as no-show",
+		Response: message(map[string]interface{}{"data": activity.Meet{}}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/meets/:id/reschedule", Tag: "meets",
+		Headers:  ifMatch,
+		Summary:  "Move a meet to a new date, keeping the old date in its history",
+		Request:  MeetControllers.RescheduleMeetRequest{},
+		Response: message(map[string]interface{}{"data": activity.Meet{}}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/meets/:id/checkin", Tag: "meets",
+		Headers: ifMatch,
+		Summary: "Check in at the meet location",
+		Request: MeetControllers.VisitRequest{},
+		Response: message(map[string]interface{}{
+			"out_of_range":  Schema{"type": "boolean"},
+			"radius_meters": Schema{"type": "number"},
+			"data":          activity.Meet{},
+		}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/meets/:id/checkout", Tag: "meets",
+		Headers: ifMatch,
+		Summary: "Check out of the meet location and record the visit duration",
+		Request: MeetControllers.VisitRequest{},
+		Response: message(map[string]interface{}{
+			"out_of_range":  Schema{"type": "boolean"},
+			"radius_meters": Schema{"type": "number"},
+			"data":          activity.Meet{},
+		}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/meets/:id/comments", Tag: "meets",
+		Summary: "List the comments on a meet as threads",
+		Response: Envelope(map[string]interface{}{
+			"comments": []CommentController.CommentThread{},
+			"total":    Schema{"type": "integer"},
+		}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/meets/:id/attachments", Tag: "meets",
+		Headers:            idempotencyKey,
+		Summary:            "Upload a photo or document to a meet (multipart field \"file\")",
+		Request:            upload,
+		RequestContentType: "multipart/form-data",
+		Status:             http.StatusCreated,
+		Response:           message(map[string]interface{}{"data": attachment.Attachment{}}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/meets/:id/attachments", Tag: "meets",
+		Summary:  "List the attachments on a meet, newest first",
+		Response: Envelope(map[string]interface{}{"data": []attachment.Attachment{}}),
+	},
+
+	{
+		Method: http.MethodPost, Path: "/api/calls/add", Tag: "calls",
+		Headers: idempotencyKey,
+		Summary: "Log a call",
+		Request: CallControllers.AddCallRequest{}, Status: http.StatusCreated,
+		Response: message(map[string]interface{}{"data": activity.Call{}}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/calls/", Tag: "calls",
+		Summary: "List calls",
+		Query: paginated(
+			Param{Name: "search", Description: "Search client name or phone number"},
+			Param{Name: "status", Description: "Filter by prospect status"},
+		),
+		Response: Envelope(map[string]interface{}{
+			"data": []activity.Call{},
+			"meta": Envelope(map[string]interface{}{
+				"current_page": Schema{"type": "integer"},
+				"per_page":     Schema{"type": "integer"},
+				"total_items":  Schema{"type": "integer"},
+				"total_pages":  Schema{"type": "integer"},
+			}),
+		}),
+	},
+
+	{
+		Method: http.MethodGet, Path: "/api/calls/export", Tag: "calls",
+		Summary: "Export calls matching the list filters as CSV, XLSX or NDJSON, streamed",
+		Query: exportParams(
+			Param{Name: "search", Description: "Search client name or phone number"},
+			Param{Name: "status", Description: "Filter by prospect status"},
+		),
+		Response:    Schema{"type": "string", "format": "binary"},
+		ContentType: "text/csv",
+	},
+	{
+		Method: http.MethodGet, Path: "/api/calls/:id", Tag: "calls",
+		Summary:  "Get a call",
+		Response: activity.Call{},
+	},
+
+	{
+		Method: http.MethodPut, Path: "/api/calls/:id", Tag: "calls",
+		Headers:  ifMatch,
+		Summary:  "Update a call; setting prospect_status to follow_up opens a follow-up task",
+		Request:  CallControllers.UpdateCallRequest{},
+		Response: message(map[string]interface{}{}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/calls/:id/comments", Tag: "calls",
+		Summary: "List the comments on a call as threads",
+		Response: Envelope(map[string]interface{}{
+			"comments": []CommentController.CommentThread{},
+			"total":    Schema{"type": "integer"},
+		}),
+	},
+
+	{
+		Method: http.MethodPost, Path: "/api/tasks/add", Tag: "tasks",
+		Headers: idempotencyKey,
+		Summary: "Create a task for the caller",
+		Request: TaskControllers.AddTaskRequest{}, Status: http.StatusCreated,
+		Response: message(map[string]interface{}{"data": task.Task{}}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/tasks/", Tag: "tasks",
+		Summary: "List the caller's tasks",
+		Query: []Param{
+			{Name: "view", Description: "overdue, today, upcoming or done; all open tasks when omitted"},
+		},
+		Response: Envelope(map[string]interface{}{
+			"tasks": []task.Task{},
+			"total": Schema{"type": "integer"},
+		}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/tasks/:id/complete", Tag: "tasks",
+		Summary:  "Complete a task, linking the call or meet that resolved it",
+		Request:  TaskControllers.CompleteTaskRequest{},
+		Response: message(map[string]interface{}{"data": task.Task{}}),
+	},
+
+	{
+		Method: http.MethodGet, Path: "/api/notifications/", Tag: "notifications",
+		Summary: "The caller's notification inbox, newest first",
+		Query:   paginated(Param{Name: "unread", Type: "boolean", Description: "Only unread notifications"}),
+		Response: Envelope(map[string]interface{}{
+			"notifications": []notification.Notification{},
+			"page":          Schema{"type": "integer"},
+			"limit":         Schema{"type": "integer"},
+			"total":         Schema{"type": "integer"},
+		}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/notifications/unread-count", Tag: "notifications",
+		Summary:  "Number of unread notifications",
+		Response: Envelope(map[string]interface{}{"unread": Schema{"type": "integer"}}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/notifications/:id/read", Tag: "notifications",
+		Summary:  "Mark a notification as read",
+		Response: message(map[string]interface{}{}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/notifications/read-all", Tag: "notifications",
+		Summary:  "Mark every notification as read",
+		Response: message(map[string]interface{}{"updated": Schema{"type": "integer"}}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/notifications/devices", Tag: "notifications",
+		Summary:  "Register a device token for push delivery",
+		Request:  NotificationControllers.RegisterDeviceRequest{},
+		Response: message(map[string]interface{}{}),
+	},
+
+	{
+		Method: http.MethodGet, Path: "/api/attachments/:id/download", Tag: "attachments",
+		Summary:     "Download an attachment (staff, the uploader or the owner of the lead or meet)",
+		Headers:     []Param{{Name: "If-None-Match", Description: "SHA-256 ETag from a previous download"}},
+		Response:    Schema{"type": "string", "format": "binary"},
+		ContentType: "application/octet-stream",
+	},
+	{
+		Method: http.MethodDelete, Path: "/api/attachments/:id", Tag: "attachments",
+		Summary:  "Delete an attachment (staff or the uploader)",
+		Response: message(map[string]interface{}{}),
+	},
+
+	{
+		Method: http.MethodPost, Path: "/api/comments/add", Tag: "comments",
+		Headers: idempotencyKey,
+		Summary: "Comment on a lead, call or meet, optionally as a reply",
+		Request: CommentController.CreateCommentRequest{}, Status: http.StatusCreated,
+		Response: message(map[string]interface{}{
+			"comment":    activity.Comment{},
+			"insertedID": Schema{"type": "string"},
+		}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/comments/", Tag: "comments",
+		Summary: "List comments",
+		Query:   pagination,
+		Response: Envelope(map[string]interface{}{
+			"comments": []activity.Comment{},
+			"page":     Schema{"type": "integer"},
+			"limit":    Schema{"type": "integer"},
+			"total":    Schema{"type": "integer"},
+		}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/comments/mentions", Tag: "comments",
+		Summary: "List comments that @mention the caller, newest first",
+		Query:   pagination,
+		Response: Envelope(map[string]interface{}{
+			"comments": []activity.Comment{},
+			"page":     Schema{"type": "integer"},
+			"limit":    Schema{"type": "integer"},
+			"total":    Schema{"type": "integer"},
+		}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/comments/:id", Tag: "comments",
+		Summary:  "Get a comment",
+		Response: activity.Comment{},
+	},
+	{
+		Method: http.MethodPut, Path: "/api/comments/:id", Tag: "comments",
+		Headers:  ifMatch,
+		Summary:  "Edit a comment (author or staff)",
+		Request:  CommentController.UpdateCommentRequest{},
+		Response: message(map[string]interface{}{"id": Schema{"type": "string"}}),
+	},
+	{
+		Method: http.MethodDelete, Path: "/api/comments/:id", Tag: "comments",
+		Headers:  optionalIfMatch,
+		Summary:  "Delete a comment (author or staff)",
+		Response: message(map[string]interface{}{"id": Schema{"type": "string"}}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/analytics/funnel", Tag: "analytics",
+		Summary: "Leads created per period and how many were called, met, won and lost, with the " +
+			"conversion between stages; BFA users only see their own leads",
+		Query: reportParams(
+			Param{Name: "period", Description: "day, week, month (default), quarter or year, in Jakarta time"},
+			Param{Name: "type_lead", Description: "Only Reff or Self leads"},
+		),
+		Response: AnalyticsControllers.FunnelReport{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/leaderboard", Tag: "analytics",
+		Summary: "Rank the caller's team by weighted calls, completed meets, new leads and wins in a period; " +
+			"ties are broken by wins, meets, calls, leads, then username, and results are cached per period",
+		Query: []Param{
+			{Name: "period", Description: "day, week (default) or month, in Jakarta time"},
+			{Name: "date", Description: "Use the period containing this day, YYYY-MM-DD"},
+			{Name: "weights", Description: "Points per unit, e.g. calls=1,meets=3,leads=2,wins=10 (the default unless LEADERBOARD_WEIGHTS is set)"},
+			{Name: "team", Description: "Another team's board (staff only)"},
+		},
+		Response: AnalyticsControllers.Leaderboard{},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/audit", Tag: "audit",
+		Summary: "Audit log of created, updated and deleted records, newest first, with the changed fields' " +
+			"values before and after (staff only); every response carries its X-Request-ID",
+		Query: paginated(
+			Param{Name: "entity", Description: "lead, call, meet, comment, attachment, lead_import, task, target, commission, commission_rule or user"},
+			Param{Name: "entity_id", Description: "Only this record's history"},
+			Param{Name: "actor_id", Description: "Only changes made by this user"},
+			Param{Name: "action", Description: "created, updated or deleted"},
+			Param{Name: "request_id", Description: "Only changes made by this request"},
+			Param{Name: "from", Description: "On or after, YYYY-MM-DD"},
+			Param{Name: "to", Description: "On or before, YYYY-MM-DD"},
+		),
+		Response: Envelope(map[string]interface{}{
+			"data":  []auditlog.Entry{},
+			"page":  Schema{"type": "integer"},
+			"limit": Schema{"type": "integer"},
+			"total": Schema{"type": "integer"},
+		}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/sync", Tag: "sync",
+		Summary: "Leads, calls, meets and comments the user can see that were created, updated or removed since " +
+			"a sync token (staff see everything, others their own records and the comments on them); without since " +
+			"everything is returned as created. Records changed just before the token may be sent again, keep the " +
+			"highest version. 410 when the token is too old, sync again without since",
+		Query: []Param{
+			{Name: "since", Description: "Token from the previous sync"},
+			{Name: "limit", Type: "integer", Description: "Most records of each kind, default 500, max 1000; has_more asks to sync again straight away"},
+		},
+		Response: Envelope(map[string]interface{}{
+			"token":    Schema{"type": "string"},
+			"has_more": Schema{"type": "boolean"},
+			"leads":    syncChanges([]lead.Lead{}),
+			"calls":    syncChanges([]activity.Call{}),
+			"meets":    syncChanges([]activity.Meet{}),
+			"comments": syncChanges([]activity.Comment{}),
+		}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/sync", Tag: "sync",
+		Headers: idempotencyKey,
+		Summary: "Apply changes made offline, in order, through the regular endpoints. Updates and deletes send the " +
+			"version they were made to and come back as conflict with the server's copy when it has changed since; " +
+			"creates with a client_id are safe to resend. Leads can be created and have their status changed, " +
+			"calls created and updated, meets and comments created, updated and deleted",
+		Request: SyncControllers.ApplyChangesRequest{},
+		Response: Envelope(map[string]interface{}{
+			"results": []SyncControllers.ChangeResult{},
+		}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/targets/add", Tag: "targets",
+		Headers: idempotencyKey,
+		Summary: "Set a per-period goal for one user or for a role (staff only); 409 when one exists " +
+			"for the same user or role, metric and period",
+		Request: TargetControllers.CreateTargetRequest{}, Status: http.StatusCreated,
+		Response: message(map[string]interface{}{"data": target.Target{}}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/targets/", Tag: "targets",
+		Summary: "List targets; staff see all of them, everyone else the ones that apply to them",
+		Query: []Param{
+			{Name: "user_id", Description: "Only this user's own targets (staff only)"},
+			{Name: "role", Type: "integer", Description: "Only this role's targets (staff only)"},
+			{Name: "metric", Description: "calls, meets, leads or wins"},
+		},
+		Response: Envelope(map[string]interface{}{"data": []target.Target{}}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/targets/progress", Tag: "targets",
+		Summary: "Actuals against every target in effect for the current period, in Jakarta time",
+		Query: []Param{
+			{Name: "user_id", Description: "Another user's progress (staff only)"},
+			{Name: "date", Description: "Use the periods containing this day, YYYY-MM-DD"},
+		},
+		Response: Envelope(map[string]interface{}{
+			"user_id": Schema{"type": "string"},
+			"data":    []TargetControllers.TargetProgress{},
+		}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/targets/history", Tag: "targets",
+		Summary: "Results of ended periods, newest first",
+		Query: paginated(
+			Param{Name: "user_id", Description: "Another user's history (staff only)"},
+			Param{Name: "metric", Description: "calls, meets, leads or wins"},
+			Param{Name: "period", Description: "day, week or month"},
+		),
+		Response: Envelope(map[string]interface{}{
+			"data":  []target.Snapshot{},
+			"page":  Schema{"type": "integer"},
+			"limit": Schema{"type": "integer"},
+			"total": Schema{"type": "integer"},
+		}),
+	},
+	{
+		Method: http.MethodPut, Path: "/api/targets/:id", Tag: "targets",
+		Summary:  "Change a target's goal (staff only)",
+		Request:  TargetControllers.UpdateTargetRequest{},
+		Response: message(map[string]interface{}{"data": target.Target{}}),
+	},
+	{
+		Method: http.MethodDelete, Path: "/api/targets/:id", Tag: "targets",
+		Summary:  "Delete a target, keeping its history (staff only)",
+		Response: message(map[string]interface{}{"id": Schema{"type": "string"}}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/commissions/", Tag: "commissions",
+		Summary: "Commission statement, newest first, with count and amount per status; " +
+			"staff see everyone's unless user_id is given",
+		Query: paginated(
+			Param{Name: "user_id", Description: "Only this referrer's commissions (staff only)"},
+			Param{Name: "status", Description: "accrued, approved, paid or cancelled"},
+			Param{Name: "from", Description: "Accrued on or after, YYYY-MM-DD"},
+			Param{Name: "to", Description: "Accrued on or before, YYYY-MM-DD"},
+		),
+		Response: Envelope(map[string]interface{}{
+			"data":   []commission.Commission{},
+			"totals": map[string]CommissionControllers.StatementTotal{},
+			"page":   Schema{"type": "integer"},
+			"limit":  Schema{"type": "integer"},
+			"total":  Schema{"type": "integer"},
+		}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/commissions/:id/approve", Tag: "commissions",
+		Summary:  "Approve an accrued commission (staff only); 409 when it is not accrued",
+		Response: message(map[string]interface{}{"data": commission.Commission{}}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/commissions/:id/pay", Tag: "commissions",
+		Summary:  "Record payment of an approved commission (staff only); 409 when it is not approved",
+		Request:  CommissionControllers.PayCommissionRequest{},
+		Response: message(map[string]interface{}{"data": commission.Commission{}}),
+	},
+	{
+		Method: http.MethodPost, Path: "/api/commissions/rules/add", Tag: "commissions",
+		Headers: idempotencyKey,
+		Summary: "Add a flat or percentage-of-premium commission rule (staff only); the active rule " +
+			"with the highest min_premium a won lead reaches applies",
+		Request: CommissionControllers.CreateRuleRequest{}, Status: http.StatusCreated,
+		Response: message(map[string]interface{}{"data": commission.Rule{}}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/commissions/rules", Tag: "commissions",
+		Summary:  "List active commission rules",
+		Query:    []Param{{Name: "all", Type: "boolean", Description: "Include inactive rules (staff only)"}},
+		Response: Envelope(map[string]interface{}{"data": []commission.Rule{}}),
+	},
+	{
+		Method: http.MethodPut, Path: "/api/commissions/rules/:id", Tag: "commissions",
+		Summary:  "Rename, re-price or deactivate a commission rule (staff only); accrued commissions keep their amount",
+		Request:  CommissionControllers.UpdateRuleRequest{},
+		Response: message(map[string]interface{}{"data": commission.Rule{}}),
+	},
+}
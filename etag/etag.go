@@ -0,0 +1,121 @@
+package etag
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Field holds the version of leads, calls, meets and comments. Every change
+// increments it; it is sent as the ETag, and an update must send it back in
+// If-Match. The update only applies while the stored version is still the one
+// the client saw, so two devices cannot overwrite each other unnoticed.
+const Field = "version"
+
+// ModifiedField holds when a versioned record last changed, which is what the
+// sync endpoint reads changes by.
+const ModifiedField = "modified_at"
+
+// Format returns the ETag of a version.
+func Format(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// Set sends the version as the response's ETag.
+func Set(c *gin.Context, version int64) {
+	c.Header("ETag", Format(version))
+}
+
+// Check compares If-Match with the current version of the record. When the
+// header is missing it answers 428, and when no tag in it matches it answers
+// 412 with the current ETag; in both cases it returns false. "*" matches any
+// version.
+func Check(c *gin.Context, current int64) bool {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header with the record's ETag is required"})
+		return false
+	}
+	if header == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == Format(current) {
+			return true
+		}
+	}
+	Set(c, current)
+	Conflict(c)
+	return false
+}
+
+// Conditional reports whether the request sent If-Match. Deletes only check
+// the version when it is sent.
+func Conditional(c *gin.Context) bool {
+	return strings.TrimSpace(c.GetHeader("If-Match")) != ""
+}
+
+// Conflict answers 412 because the record changed since the client read it.
+func Conflict(c *gin.Context) {
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": "The record was changed by someone else, reload it and try again"})
+}
+
+// Of reads the version of a record decoded into a document.
+func Of(doc bson.M) int64 {
+	switch v := doc[Field].(type) {
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+// Match narrows an update filter to the version the change was checked
+// against. Records saved before versions existed count as version 0.
+func Match(filter bson.M, version int64) bson.M {
+	if version == 0 {
+		filter[Field] = bson.M{"$in": bson.A{0, nil}}
+	} else {
+		filter[Field] = version
+	}
+	return filter
+}
+
+// Bump adds the version increment and the modification time to an update
+// document or pipeline. An update document that already sets the
+// modification time keeps it, so a handler can report the time it stored.
+func Bump(update interface{}) interface{} {
+	now := time.Now()
+	switch u := update.(type) {
+	case bson.M:
+		inc, _ := u["$inc"].(bson.M)
+		if inc == nil {
+			inc = bson.M{}
+		}
+		inc[Field] = 1
+		u["$inc"] = inc
+		if set, ok := u["$set"].(bson.M); ok {
+			if _, given := set[ModifiedField]; !given {
+				set[ModifiedField] = now
+			}
+		} else if u["$set"] == nil {
+			u["$set"] = bson.M{ModifiedField: now}
+		}
+		return u
+	case mongo.Pipeline:
+		return append(u, bson.D{{Key: "$set", Value: bson.M{
+			Field:         bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$" + Field, 0}}, 1}},
+			ModifiedField: now,
+		}}})
+	}
+	return update
+}
@@ -0,0 +1,129 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	Created = "created"
+	Updated = "updated"
+	Deleted = "deleted"
+
+	EntityLead       = "lead"
+	EntityCall       = "call"
+	EntityMeet       = "meet"
+	EntityComment    = "comment"
+	EntityAttachment = "attachment"
+	EntityLeadImport = "lead_import"
+)
+
+// Event describes a change to an entity. OwnerID is the user the entity
+// belongs to; events without an owner are visible to everyone.
+type Event struct {
+	ID       uint64             `json:"id"`
+	Type     string             `json:"type"`
+	Entity   string             `json:"entity"`
+	EntityID string             `json:"entity_id"`
+	OwnerID  primitive.ObjectID `json:"owner_id,omitempty"`
+	Data     interface{}        `json:"data,omitempty"`
+	Time     time.Time          `json:"time"`
+}
+
+const (
+	historySize      = 1000
+	subscriberBuffer = 64
+)
+
+// Bus fans events out to subscribers and keeps the most recent ones so that
+// a reconnecting client can resume from the last event it saw.
+type Bus struct {
+	mu          sync.Mutex
+	nextID      uint64
+	history     []Event
+	subscribers map[chan Event]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: map[chan Event]struct{}{}}
+}
+
+var Default = NewBus()
+
+// Publish records an event on the default bus.
+func Publish(entity, action string, entityID primitive.ObjectID, ownerID primitive.ObjectID, data interface{}) {
+	Default.Publish(Event{
+		Type:     entity + "." + action,
+		Entity:   entity,
+		EntityID: entityID.Hex(),
+		OwnerID:  ownerID,
+		Data:     data,
+	})
+}
+
+func (b *Bus) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	event.ID = b.nextID
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.history = append(b.history, event)
+	if len(b.history) > historySize {
+		b.history = b.history[len(b.history)-historySize:]
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// A subscriber that cannot keep up is dropped rather than
+			// blocking every publisher; it will reconnect and resume.
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns the events published after lastID that are still held,
+// a channel for new events and a function to stop the subscription. complete
+// is false when events after lastID have already been discarded, in which
+// case the client should reload instead of relying on the replay.
+func (b *Bus) Subscribe(lastID uint64) (replay []Event, complete bool, ch <-chan Event, unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	complete = true
+	if lastID > 0 {
+		if len(b.history) > 0 && b.history[0].ID > lastID+1 {
+			complete = false
+		}
+		if lastID > b.nextID {
+			// The bus restarted since the client connected.
+			complete = false
+			lastID = 0
+		}
+		for _, event := range b.history {
+			if event.ID > lastID {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	sub := make(chan Event, subscriberBuffer)
+	b.subscribers[sub] = struct{}{}
+
+	return replay, complete, sub, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[sub]; ok {
+			delete(b.subscribers, sub)
+			close(sub)
+		}
+	}
+}
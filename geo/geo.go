@@ -0,0 +1,93 @@
+package geo
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+const EarthRadiusMeters = 6371000.0
+
+func toRadians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// Distance returns the great-circle distance in meters between two
+// latitude/longitude points using the haversine formula.
+func Distance(lat1, lng1, lat2, lng2 float64) float64 {
+	dLat := toRadians(lat2 - lat1)
+	dLng := toRadians(lng2 - lng1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return 2 * EarthRadiusMeters * math.Asin(math.Sqrt(a))
+}
+
+func ValidCoordinates(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+// Point is a GeoJSON point as stored for 2dsphere indexes. GeoJSON orders
+// coordinates as longitude, latitude.
+type Point struct {
+	Type        string    `bson:"type" json:"type"`
+	Coordinates []float64 `bson:"coordinates" json:"coordinates"`
+}
+
+func NewPoint(lat, lng float64) *Point {
+	return &Point{Type: "Point", Coordinates: []float64{lng, lat}}
+}
+
+// PointExpr is the aggregation expression that builds a Point from the
+// latitude and longitude fields of the same document.
+func PointExpr(latField, lngField string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "Point",
+		"coordinates": []interface{}{"$" + lngField, "$" + latField},
+	}
+}
+
+const (
+	DefaultNearbyRadius = 3000.0
+	MaxNearbyRadius     = 50000.0
+)
+
+// ParseNear reads the lat, lng and radius query values of a nearby search.
+// The radius is in meters, defaults to DefaultNearbyRadius and is capped at
+// MaxNearbyRadius.
+func ParseNear(latValue, lngValue, radiusValue string) (lat, lng, radius float64, err error) {
+	lat, latErr := strconv.ParseFloat(latValue, 64)
+	lng, lngErr := strconv.ParseFloat(lngValue, 64)
+	if latErr != nil || lngErr != nil || !ValidCoordinates(lat, lng) {
+		return 0, 0, 0, errors.New("lat and lng must be valid coordinates")
+	}
+
+	radius = DefaultNearbyRadius
+	if radiusValue != "" {
+		radius, err = strconv.ParseFloat(radiusValue, 64)
+		if err != nil || !(radius > 0) {
+			return 0, 0, 0, errors.New("radius must be a positive number of meters")
+		}
+	}
+	if radius > MaxNearbyRadius {
+		radius = MaxNearbyRadius
+	}
+	return lat, lng, radius, nil
+}
+
+// NearStage is the $geoNear aggregation stage returning documents within
+// radius meters of the point, nearest first, with the distance in meters in
+// the "distance" field. It must be the first stage of a pipeline.
+func NearStage(lat, lng, radius float64, query interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"$geoNear": map[string]interface{}{
+			"near":          NewPoint(lat, lng),
+			"distanceField": "distance",
+			"maxDistance":   radius,
+			"spherical":     true,
+			"query":         query,
+			"key":           "location",
+		},
+	}
+}
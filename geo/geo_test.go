@@ -0,0 +1,38 @@
+package geo
+
+import "testing"
+
+func TestParseNear(t *testing.T) {
+	tests := []struct {
+		name       string
+		radius     string
+		wantRadius float64
+		wantErr    bool
+	}{
+		{name: "default radius", radius: "", wantRadius: DefaultNearbyRadius},
+		{name: "given radius", radius: "500", wantRadius: 500},
+		{name: "capped radius", radius: "90000", wantRadius: MaxNearbyRadius},
+		{name: "infinite radius is capped", radius: "Inf", wantRadius: MaxNearbyRadius},
+		{name: "zero radius", radius: "0", wantErr: true},
+		{name: "negative radius", radius: "-5", wantErr: true},
+		{name: "NaN radius", radius: "NaN", wantErr: true},
+		{name: "text radius", radius: "far", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, radius, err := ParseNear("-6.2", "106.8", tt.radius)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseNear(radius=%q) = %v, want an error", tt.radius, radius)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseNear(radius=%q) error = %v", tt.radius, err)
+			}
+			if radius != tt.wantRadius {
+				t.Fatalf("ParseNear(radius=%q) = %v, want %v", tt.radius, radius, tt.wantRadius)
+			}
+		})
+	}
+}
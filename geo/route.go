@@ -0,0 +1,171 @@
+package geo
+
+import "time"
+
+// Stop is a place to visit. Fixed stops are appointments at a set time: the
+// planner may place flexible stops around them but never reorders them.
+// At is only meaningful for fixed stops.
+type Stop struct {
+	Lat   float64
+	Lng   float64
+	Fixed bool
+	At    time.Time
+}
+
+// PlanRoute orders stops for an open path starting at the given point. It
+// builds a nearest-neighbour tour and then improves it with 2-opt, rejecting
+// any move that would visit fixed stops out of chronological order. The
+// result holds indexes into stops.
+func PlanRoute(startLat, startLng float64, stops []Stop) []int {
+	points := make([]Stop, 0, len(stops)+1)
+	points = append(points, Stop{Lat: startLat, Lng: startLng})
+	points = append(points, stops...)
+
+	dist := make([][]float64, len(points))
+	for i := range points {
+		dist[i] = make([]float64, len(points))
+		for j := range points {
+			dist[i][j] = Distance(points[i].Lat, points[i].Lng, points[j].Lat, points[j].Lng)
+		}
+	}
+
+	tour := nearestNeighbour(points, dist)
+	tour = twoOpt(points, dist, tour)
+
+	order := make([]int, 0, len(stops))
+	for _, p := range tour[1:] {
+		order = append(order, p-1)
+	}
+	return order
+}
+
+// nextFixed returns the earliest unvisited fixed stop, or -1.
+func nextFixed(points []Stop, visited []bool) int {
+	next := -1
+	for i := 1; i < len(points); i++ {
+		if visited[i] || !points[i].Fixed {
+			continue
+		}
+		if next == -1 || points[i].At.Before(points[next].At) {
+			next = i
+		}
+	}
+	return next
+}
+
+func nearestNeighbour(points []Stop, dist [][]float64) []int {
+	visited := make([]bool, len(points))
+	visited[0] = true
+	tour := []int{0}
+
+	for len(tour) < len(points) {
+		current := tour[len(tour)-1]
+		fixed := nextFixed(points, visited)
+
+		best := -1
+		for i := 1; i < len(points); i++ {
+			if visited[i] || (points[i].Fixed && i != fixed) {
+				continue
+			}
+			if best == -1 || dist[current][i] < dist[current][best] {
+				best = i
+			}
+		}
+
+		visited[best] = true
+		tour = append(tour, best)
+	}
+	return tour
+}
+
+func chronological(points []Stop, tour []int) bool {
+	var last time.Time
+	for _, p := range tour {
+		if !points[p].Fixed {
+			continue
+		}
+		if points[p].At.Before(last) {
+			return false
+		}
+		last = points[p].At
+	}
+	return true
+}
+
+func twoOpt(points []Stop, dist [][]float64, tour []int) []int {
+	const epsilon = 1e-9
+
+	for improved := true; improved; {
+		improved = false
+		for i := 1; i < len(tour)-1; i++ {
+			for j := i + 1; j < len(tour); j++ {
+				// Reversing tour[i..j] swaps edges (i-1,i) and (j,j+1) for
+				// (i-1,j) and (i,j+1). The path is open, so there may be no
+				// edge after j.
+				before := dist[tour[i-1]][tour[i]]
+				after := dist[tour[i-1]][tour[j]]
+				if j+1 < len(tour) {
+					before += dist[tour[j]][tour[j+1]]
+					after += dist[tour[i]][tour[j+1]]
+				}
+				if after+epsilon >= before {
+					continue
+				}
+
+				candidate := append([]int{}, tour...)
+				for a, b := i, j; a < b; a, b = a+1, b-1 {
+					candidate[a], candidate[b] = candidate[b], candidate[a]
+				}
+				if !chronological(points, candidate) {
+					continue
+				}
+
+				tour = candidate
+				improved = true
+			}
+		}
+	}
+	return tour
+}
+
+// Legs returns the distance in meters of every leg when visiting stops in
+// the given order from the start point.
+func Legs(startLat, startLng float64, stops []Stop, order []int) []float64 {
+	legs := make([]float64, 0, len(order))
+	lat, lng := startLat, startLng
+	for _, i := range order {
+		legs = append(legs, Distance(lat, lng, stops[i].Lat, stops[i].Lng))
+		lat, lng = stops[i].Lat, stops[i].Lng
+	}
+	return legs
+}
+
+// Arrival is the estimated time of reaching a stop. Late is set for a fixed
+// stop that cannot be reached by its appointment time.
+type Arrival struct {
+	At   time.Time
+	Late bool
+}
+
+// Arrivals estimates when each stop is reached when leaving the start point
+// at depart and visiting stops in the given order, travelling at speed
+// meters per second and spending dwell at every stop. Arriving early at a
+// fixed stop means waiting for the appointment before moving on.
+func Arrivals(depart time.Time, startLat, startLng float64, stops []Stop, order []int, speed float64, dwell time.Duration) []Arrival {
+	legs := Legs(startLat, startLng, stops, order)
+	arrivals := make([]Arrival, len(order))
+	clock := depart
+	for position, i := range order {
+		clock = clock.Add(time.Duration(legs[position] / speed * float64(time.Second)))
+		arrivals[position] = Arrival{At: clock}
+		if stops[i].Fixed {
+			if clock.After(stops[i].At) {
+				arrivals[position].Late = true
+			} else {
+				clock = stops[i].At
+			}
+		}
+		clock = clock.Add(dwell)
+	}
+	return arrivals
+}
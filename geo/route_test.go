@@ -0,0 +1,121 @@
+package geo
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPlanRoute(t *testing.T) {
+	nine := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	east := func(km float64) (float64, float64) { return 0, km / 111.195 }
+	stop := func(km float64) Stop {
+		lat, lng := east(km)
+		return Stop{Lat: lat, Lng: lng}
+	}
+	fixed := func(km float64, at time.Time) Stop {
+		s := stop(km)
+		s.Fixed, s.At = true, at
+		return s
+	}
+
+	tests := []struct {
+		name  string
+		stops []Stop
+		want  []int
+	}{
+		{name: "no stops", stops: nil, want: []int{}},
+		{name: "one stop", stops: []Stop{stop(3)}, want: []int{0}},
+		{
+			name:  "flexible stops in order of distance",
+			stops: []Stop{stop(3), stop(1), stop(2)},
+			want:  []int{1, 2, 0},
+		},
+		{
+			name:  "one side before the other",
+			stops: []Stop{stop(1), stop(-1.5), stop(2), stop(-2.5)},
+			want:  []int{0, 2, 1, 3},
+		},
+		{
+			name:  "fixed stops keep their appointment order",
+			stops: []Stop{fixed(1, nine.Add(2*time.Hour)), fixed(3, nine), stop(2)},
+			want:  []int{2, 1, 0},
+		},
+		{
+			name:  "fixed stops ignore the clock of flexible ones",
+			stops: []Stop{{Lat: 0, Lng: 0.02, At: nine.Add(time.Hour)}, fixed(1, nine)},
+			want:  []int{1, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PlanRoute(0, 0, tt.stops)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("PlanRoute() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanRouteVisitsEveryStopOnce(t *testing.T) {
+	base := time.Date(2026, 1, 5, 8, 0, 0, 0, time.UTC)
+	var stops []Stop
+	for i := 0; i < 12; i++ {
+		s := Stop{Lat: -6.2 + float64(i%4)*0.01, Lng: 106.8 + float64(i*7%5)*0.01}
+		if i%3 == 0 {
+			s.Fixed, s.At = true, base.Add(time.Duration(12-i)*time.Hour)
+		}
+		stops = append(stops, s)
+	}
+
+	order := PlanRoute(-6.2, 106.8, stops)
+	seen := append([]int{}, order...)
+	sort.Ints(seen)
+	for i, v := range seen {
+		if v != i {
+			t.Fatalf("PlanRoute() = %v, want every stop exactly once", order)
+		}
+	}
+
+	var last time.Time
+	for _, i := range order {
+		if !stops[i].Fixed {
+			continue
+		}
+		if stops[i].At.Before(last) {
+			t.Fatalf("PlanRoute() = %v visits fixed stops out of order", order)
+		}
+		last = stops[i].At
+	}
+}
+
+func TestArrivals(t *testing.T) {
+	depart := time.Date(2026, 1, 5, 8, 0, 0, 0, time.UTC)
+	km := 1 / 111.195
+	// At 1000 m per minute every kilometre takes a minute.
+	speed := 1000.0 / 60
+	dwell := 10 * time.Minute
+	stops := []Stop{
+		{Lat: 0, Lng: 10 * km},
+		{Lat: 0, Lng: 20 * km, Fixed: true, At: depart.Add(time.Hour)},
+		{Lat: 0, Lng: 30 * km, Fixed: true, At: depart.Add(70 * time.Minute)},
+	}
+
+	got := Arrivals(depart, 0, 0, stops, []int{0, 1, 2}, speed, dwell)
+	want := []Arrival{
+		{At: depart.Add(10 * time.Minute)},
+		// Reached at 08:30, waits for the 09:00 appointment.
+		{At: depart.Add(30 * time.Minute)},
+		// Leaves at 09:10 and needs another 10 minutes.
+		{At: depart.Add(80 * time.Minute), Late: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Arrivals() returned %d arrivals, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Late != want[i].Late || got[i].At.Sub(want[i].At).Abs() > time.Second {
+			t.Errorf("arrival %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
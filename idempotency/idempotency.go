@@ -0,0 +1,269 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Arkariza/API_MyActivity/audit"
+	database "github.com/Arkariza/API_MyActivity/models"
+	models "github.com/Arkariza/API_MyActivity/models/Idempotency"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+
+	ttlEnvKey  = "IDEMPOTENCY_TTL"
+	defaultTTL = 24 * time.Hour
+
+	// lockTimeout is how long a request holds its key while it is handled. A
+	// key left in processing by a server that went down is freed after it.
+	lockTimeout = 2 * time.Minute
+
+	maxKeyLength = 255
+	// maxBodyBytes is above the lead import and default attachment limits,
+	// which the handlers still enforce themselves.
+	maxBodyBytes = 32 << 20
+)
+
+// replayedHeaders are the response headers kept with the response body.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+var errInProgress = errors.New("request with this idempotency key is in progress")
+
+// Store keeps the requests made with an Idempotency-Key and their responses
+// for IDEMPOTENCY_TTL (default 24h). Expired records are removed by a TTL
+// index.
+type Store struct {
+	collection *mongo.Collection
+	ttl        time.Duration
+}
+
+func NewStore(collection *mongo.Collection) *Store {
+	return &Store{collection: collection, ttl: loadTTL()}
+}
+
+func loadTTL() time.Duration {
+	value := os.Getenv(ttlEnvKey)
+	if value == "" {
+		return defaultTTL
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		log.Printf("Invalid %s %q, using %s", ttlEnvKey, value, defaultTTL)
+		return defaultTTL
+	}
+	return ttl
+}
+
+// Middleware makes a create endpoint safe to retry. The first request with a
+// key is handled and its response saved; a retry with the same key and the
+// same request gets that response again without being handled, and a request
+// reusing the key for anything else is rejected with 422. Keys are per user,
+// so the middleware must run after authentication. Requests without the
+// header are handled as usual.
+func (s *Store) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(Header))
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": Header + " must be at most " + strconv.Itoa(maxKeyLength) + " characters"})
+			return
+		}
+		userID, _ := audit.Actor(c)
+		if userID == nil {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBodyBytes+1))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body", "details": err.Error()})
+			return
+		}
+		if len(body) > maxBodyBytes {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request is too large to be sent with an " + Header})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		record := models.Record{
+			ID:          recordID(*userID, key),
+			UserID:      *userID,
+			Key:         key,
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			RequestHash: requestHash(c.Request, body),
+			RequestSize: int64(len(body)),
+		}
+		existing, err := s.reserve(c.Request.Context(), &record)
+		if err != nil && !errors.Is(err, errInProgress) {
+			c.AbortWithStatusJSON(database.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": "Failed to check " + Header, "details": err.Error()})
+			return
+		}
+		if err != nil || existing != nil {
+			replay(c, &record, existing)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		defer s.finish(&record, recorder)
+		c.Next()
+	}
+}
+
+// reserve saves the record as processing. When the key is already taken it
+// returns the record holding it instead, or errInProgress if the key keeps
+// changing hands.
+func (s *Store) reserve(parent context.Context, record *models.Record) (*models.Record, error) {
+	ctx, cancel := database.QueryContext(parent)
+	defer cancel()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		now := time.Now()
+		record.Status = models.StatusProcessing
+		record.CreatedAt = now
+		record.LockedUntil = now.Add(lockTimeout)
+		record.ExpiresAt = now.Add(s.ttl)
+		_, err := s.collection.InsertOne(ctx, record)
+		if err == nil {
+			return nil, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+
+		var existing models.Record
+		err = s.collection.FindOne(ctx, bson.M{"_id": record.ID}).Decode(&existing)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		expired := !existing.ExpiresAt.After(now)
+		abandoned := existing.Status == models.StatusProcessing && !existing.LockedUntil.After(now)
+		if !expired && !abandoned {
+			return &existing, nil
+		}
+		// The TTL index removes expired records only periodically, so they
+		// are removed here too. The filter leaves a record another request
+		// has just replaced alone.
+		_, err = s.collection.DeleteOne(ctx, bson.M{
+			"_id":          existing.ID,
+			"status":       existing.Status,
+			"locked_until": existing.LockedUntil,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, errInProgress
+}
+
+// replay answers a request whose key is already taken. existing is nil when
+// the key is contended.
+func replay(c *gin.Context, record, existing *models.Record) {
+	if existing != nil && existing.RequestHash != record.RequestHash {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": Header + " was already used for a different request"})
+		return
+	}
+	if existing == nil || existing.Status != models.StatusCompleted {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this " + Header + " is still being processed, retry later"})
+		return
+	}
+	for name, value := range existing.Headers {
+		c.Header(name, value)
+	}
+	c.Header(ReplayedHeader, "true")
+	c.Data(existing.StatusCode, existing.Headers["Content-Type"], existing.Body)
+	c.Abort()
+}
+
+// finish saves the response for replay. Server errors, cancelled requests and
+// requests that panicked are not saved: the key is freed so that a retry is
+// handled again.
+func (s *Store) finish(record *models.Record, recorder *responseRecorder) {
+	// The change is already made, so the response is saved even if the
+	// client has gone away.
+	ctx, cancel := database.QueryContext(context.Background())
+	defer cancel()
+
+	status := recorder.Status()
+	if !recorder.Written() || status >= http.StatusInternalServerError || status == database.StatusClientClosedRequest {
+		if _, err := s.collection.DeleteOne(ctx, bson.M{"_id": record.ID, "locked_until": record.LockedUntil}); err != nil {
+			log.Printf("Error freeing idempotency key for %s %s: %v", record.Method, record.Path, err)
+		}
+		return
+	}
+
+	headers := map[string]string{}
+	for _, name := range replayedHeaders {
+		if value := recorder.Header().Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": record.ID, "locked_until": record.LockedUntil}, bson.M{"$set": bson.M{
+		"status":      models.StatusCompleted,
+		"status_code": status,
+		"headers":     headers,
+		"body":        recorder.body.Bytes(),
+		"expires_at":  time.Now().Add(s.ttl),
+	}})
+	if err != nil {
+		log.Printf("Error saving response for idempotency key on %s %s: %v", record.Method, record.Path, err)
+	}
+}
+
+func recordID(userID primitive.ObjectID, key string) string {
+	sum := sha256.Sum256([]byte(userID.Hex() + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// requestHash identifies a request by its method, URL and body. Multipart
+// boundaries are left out because clients pick a new one on every attempt.
+func requestHash(r *http.Request, body []byte) string {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err == nil && strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+		body = bytes.ReplaceAll(body, []byte(params["boundary"]), nil)
+	}
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.RequestURI()+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the response body as it is written.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
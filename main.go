@@ -1,145 +1,317 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"time"
 
+	"github.com/Arkariza/API_MyActivity/audit"
 	"github.com/Arkariza/API_MyActivity/auth"
+	"github.com/Arkariza/API_MyActivity/auth/middleware"
+	"github.com/Arkariza/API_MyActivity/commission"
+	"github.com/Arkariza/API_MyActivity/controller/Analytics"
+	"github.com/Arkariza/API_MyActivity/controller/Attachment"
+	"github.com/Arkariza/API_MyActivity/controller/Audit"
 	"github.com/Arkariza/API_MyActivity/controller/Call"
 	"github.com/Arkariza/API_MyActivity/controller/Comment"
+	"github.com/Arkariza/API_MyActivity/controller/Commission"
 	"github.com/Arkariza/API_MyActivity/controller/Lead"
 	"github.com/Arkariza/API_MyActivity/controller/Meet"
+	"github.com/Arkariza/API_MyActivity/controller/Notification"
+	"github.com/Arkariza/API_MyActivity/controller/Stream"
+	"github.com/Arkariza/API_MyActivity/controller/Sync"
+	"github.com/Arkariza/API_MyActivity/controller/Target"
+	"github.com/Arkariza/API_MyActivity/controller/Task"
 	"github.com/Arkariza/API_MyActivity/controller/User"
+	"github.com/Arkariza/API_MyActivity/docs"
+	"github.com/Arkariza/API_MyActivity/events"
+	"github.com/Arkariza/API_MyActivity/idempotency"
+	"github.com/Arkariza/API_MyActivity/metrics"
 	"github.com/Arkariza/API_MyActivity/middleware/Call"
 	"github.com/Arkariza/API_MyActivity/middleware/Comment"
 	"github.com/Arkariza/API_MyActivity/middleware/Lead"
 	"github.com/Arkariza/API_MyActivity/middleware/Meet"
+	"github.com/Arkariza/API_MyActivity/migrations"
 	"github.com/Arkariza/API_MyActivity/models"
+	AttachmentModels "github.com/Arkariza/API_MyActivity/models/Attachment"
+	CallAndMeetModels "github.com/Arkariza/API_MyActivity/models/CallAndMeet"
+	"github.com/Arkariza/API_MyActivity/notify"
+	"github.com/Arkariza/API_MyActivity/phone"
+	"github.com/Arkariza/API_MyActivity/storage"
+	"github.com/Arkariza/API_MyActivity/tombstone"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
 )
 
 func main() {
 	models.ConnectDatabase()
 	defer models.DisconnectDatabase()
 
+	if err := migrations.Run(models.DB); err != nil {
+		log.Fatal("Error running migrations: ", err)
+	}
+
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterValidation("phone", phone.ValidateField)
+	}
+
+	attachmentStore, err := storage.FromEnv()
+	if err != nil {
+		log.Fatal("Failed to set up attachment storage: ", err)
+	}
+
+	r := setupRouter(context.Background(), attachmentStore)
+	if err := r.Run(":8080"); err != nil {
+		log.Fatal("Error starting server:", err)
+	}
+}
+
+// setupRouter builds the API on models.DB. The background jobs it starts run
+// until ctx is done.
+func setupRouter(ctx context.Context, attachmentStore storage.Storage) *gin.Engine {
 	r := gin.Default()
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:50574"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "If-Match", idempotency.Header, audit.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", "ETag", idempotency.ReplayedHeader, audit.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
+	r.Use(metrics.Middleware())
+	r.Use(audit.RequestIDMiddleware())
+	r.GET("/metrics", metrics.Handler())
+
+	audit.Default = audit.NewLog(models.GetCollection("audit_log"))
+	tombstone.Default = tombstone.NewStore(models.GetCollection("tombstones"))
 
 	authCommand := auth.NewAuthCommand(models.GetCollection("users"))
 	userController := UserControllers.NewUserController(authCommand)
-	leadController := LeadController.NewLeadController(models.GetCollection("leads"))
+	notifier := notify.NewNotifier(models.GetCollection("notifications"), models.GetCollection("users"), notify.ProviderFromEnv())
+	notifier.StartReminders(ctx, models.GetCollection("tasks"), time.Minute)
+
+	ledger := commission.NewLedger(models.GetCollection("commission_rules"), models.GetCollection("commissions"))
+	leadController := LeadController.NewLeadController(models.GetCollection("leads"), models.GetCollection("users"), models.GetCollection("lead_imports"), LeadController.LinkedCollections{
+		Calls:       models.GetCollection("call"),
+		Meets:       models.GetCollection("meet"),
+		Tasks:       models.GetCollection("tasks"),
+		Comments:    models.GetCollection("comments"),
+		Attachments: models.GetCollection("attachments"),
+	}, notifier, ledger)
 	meetController := MeetControllers.NewMeetController(models.GetCollection("meet"))
-	callController := CallControllers.NewCallController(models.GetCollection("call"))
-	commentController := CommentController.NewCommentController(models.GetCollection("comments"))
+	callController := CallControllers.NewCallController(models.GetCollection("call"), models.GetCollection("tasks"))
+	commentController := CommentController.NewCommentController(models.GetCollection("comments"), models.GetCollection("users"), models.GetCollection("leads"), models.GetCollection("call"), models.GetCollection("meet"), notifier)
+	taskController := TaskControllers.NewTaskController(models.GetCollection("tasks"), models.GetCollection("call"), models.GetCollection("meet"))
+	notificationController := NotificationControllers.NewNotificationController(models.GetCollection("notifications"), models.GetCollection("users"))
+	streamController := StreamControllers.NewStreamController(events.Default)
+	analyticsController := AnalyticsControllers.NewAnalyticsController(models.GetCollection("leads"), models.GetCollection("call"), models.GetCollection("meet"), models.GetCollection("users"))
+	targetController := TargetControllers.NewTargetController(models.GetCollection("targets"), models.GetCollection("target_snapshots"), models.GetCollection("users"), models.GetCollection("leads"), models.GetCollection("call"), models.GetCollection("meet"))
+	targetController.StartSnapshots(ctx, 15*time.Minute)
+	commissionController := CommissionControllers.NewCommissionController(models.GetCollection("commission_rules"), models.GetCollection("commissions"))
+	auditController := AuditControllers.NewAuditController(models.GetCollection("audit_log"))
+	idempotent := idempotency.NewStore(models.GetCollection("idempotency_keys")).Middleware()
+	// Changes sent through sync are replayed on an engine of their own with
+	// the same API routes, so that the global middleware counts, logs and
+	// checks CORS only once, for the sync request itself.
+	internal := gin.New()
+	internal.Use(gin.Recovery(), audit.RequestIDMiddleware())
+	syncController := SyncControllers.NewSyncController(models.GetCollection("leads"), models.GetCollection("call"), models.GetCollection("meet"), models.GetCollection("comments"), models.GetCollection("tombstones"), internal)
+
+	attachmentController := AttachmentControllers.NewAttachmentController(models.GetCollection("attachments"), models.GetCollection("leads"), models.GetCollection("meet"), attachmentStore)
 
 	leadMiddleware := middleware.NewLeadMiddleware(authCommand.GetSecretKey())
 	meetMiddleware := MeetMiddleware.NewMeetMiddleware(authCommand.GetSecretKey())
 	callMiddleware := CallMiddleware.NewCallMiddleware(authCommand.GetSecretKey())
 	commentMiddleware := CommentMiddleware.NewCommentMiddleware(authCommand.GetSecretKey())
 
-	api := r.Group("/api")
-	{
-		api.POST("/register", userController.Register)
-		api.POST("/login", userController.Login)
-
-		leads := api.Group("/leads")
-		leads.Use(leadMiddleware.AuthenticateLead())
+	for _, engine := range []*gin.Engine{r, internal} {
+		api := engine.Group("/api")
 		{
-			leads.POST("/add", leadMiddleware.AuthenticateLead(), func(c *gin.Context) {
-				var req LeadController.AddLeadRequest
+			api.POST("/register", userController.Register)
+			api.POST("/login", userController.Login)
+			api.PUT("/users/:id/team", AuthMiddleware.AuthMiddleware(authCommand), userController.AssignTeam)
+			api.GET("/openapi.json", docs.SpecHandler(docs.Build(docs.Operations)))
+			api.GET("/docs", docs.UIHandler())
+			api.GET("/stream", AuthMiddleware.AuthMiddleware(authCommand), streamController.Stream)
+
+			leads := api.Group("/leads")
+			leads.Use(leadMiddleware.AuthenticateLead())
+			{
+				leads.POST("/add", leadMiddleware.AuthenticateLead(), idempotent, func(c *gin.Context) {
+					var req LeadController.AddLeadRequest
 			
-				lead, err := leadController.AddLead(c, req)
-				if err != nil {
-					return 
-				}
+					lead, err := leadController.AddLead(c, req)
+					if err != nil {
+						return 
+					}
 			
-				c.JSON(http.StatusCreated, gin.H{
-					"message": "Lead has been created",
-					"data":    lead,
+					c.JSON(http.StatusCreated, gin.H{
+						"message": "Lead has been created",
+						"data":    lead,
+					})
 				})
-			})
-			leads.GET("/", leadController.GetAllLead)
-		}
+				leads.GET("/", leadController.GetAllLead)
+				leads.GET("/nearby", leadController.NearbyLeads)
+				leads.GET("/export", leadController.ExportLeads)
+				leads.GET("/duplicates", leadController.GetDuplicates)
+				leads.POST("/import", idempotent, leadController.ImportLeads)
+				leads.GET("/import/:id", leadController.GetImport)
+				leads.GET("/:id", leadController.GetLeadByID)
+				leads.PUT("/:id/assign", leadController.AssignLead)
+				leads.PUT("/:id/status", leadController.UpdateLeadStatus)
+				leads.POST("/:id/merge", leadController.MergeLead)
+				leads.GET("/:id/comments", commentController.ListForEntity(CallAndMeetModels.CommentOnLead))
+				leads.POST("/:id/attachments", AuthMiddleware.AuthMiddleware(authCommand), idempotent, attachmentController.Upload(AttachmentModels.AttachOnLead))
+				leads.GET("/:id/attachments", AuthMiddleware.AuthMiddleware(authCommand), attachmentController.List(AttachmentModels.AttachOnLead))
+			}
 
-		meets := api.Group("/meets")
-		meets.Use(meetMiddleware.AuthenticateMeet())
-		{
-			meets.POST("/add", func(c *gin.Context) {
-				var req MeetControllers.AddMeetRequest
-				if err := c.ShouldBindJSON(&req); err != nil {
-					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-					return
-				}
-
-				meet, err := meetController.AddMeet(c, req)
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-					return
-				}
-
-				c.JSON(http.StatusCreated, gin.H{
-					"message": "Meet created successfully",
-					"data":    meet,
+			meets := api.Group("/meets")
+			meets.Use(meetMiddleware.AuthenticateMeet())
+			{
+				meets.POST("/add", idempotent, func(c *gin.Context) {
+					var req MeetControllers.AddMeetRequest
+					if err := c.ShouldBindJSON(&req); err != nil {
+						c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+						return
+					}
+
+					meet, err := meetController.AddMeet(c, req)
+					if err != nil {
+						c.JSON(models.ErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+						return
+					}
+
+					c.JSON(http.StatusCreated, gin.H{
+						"message": "Meet created successfully",
+						"data":    meet,
+					})
 				})
-			})
-			meets.GET("/", meetController.ViewMeets)
-			meets.GET("/:id", meetController.GetMeetByID)
-			meets.DELETE("/:id", meetController.DeleteMeet)
-		}
+				meets.GET("/", meetController.ViewMeets)
+				meets.GET("/stats", meetController.MeetStats)
+				meets.GET("/nearby", meetController.NearbyMeets)
+				meets.GET("/route", meetController.PlanRoute)
+				meets.GET("/export", meetController.ExportMeets)
+				meets.GET("/:id", meetController.GetMeetByID)
+				meets.PUT("/:id", meetController.UpdateMeet)
+				meets.DELETE("/:id", meetController.DeleteMeet)
+				meets.POST("/:id/complete", meetController.CompleteMeet)
+				meets.POST("/:id/cancel", meetController.CancelMeet)
+				meets.POST("/:id/no-show", meetController.MarkNoShow)
+				meets.POST("/:id/reschedule", meetController.RescheduleMeet)
+				meets.POST("/:id/checkin", meetController.CheckIn)
+				meets.POST("/:id/checkout", meetController.CheckOut)
+				meets.GET("/:id/comments", commentController.ListForEntity(CallAndMeetModels.CommentOnMeet))
+				meets.POST("/:id/attachments", AuthMiddleware.AuthMiddleware(authCommand), idempotent, attachmentController.Upload(AttachmentModels.AttachOnMeet))
+				meets.GET("/:id/attachments", AuthMiddleware.AuthMiddleware(authCommand), attachmentController.List(AttachmentModels.AttachOnMeet))
+			}
 		
-		calls := api.Group("/calls")
-		calls.Use(callMiddleware.AuthenticateCall())
-		{
-			calls.POST("/add", func(c *gin.Context) {
-				var req CallControllers.AddCallRequest
-				if err := c.ShouldBindJSON(&req); err != nil {
-					c.JSON(http.StatusBadRequest, gin.H{
-						"error":   "Invalid request",
-						"details": err.Error(),
-					})
-					return
-				}
-
-				call, err := callController.AddCall(c, req)
-				if err != nil {
-					log.Printf("Error adding call: %v", err)
-					c.JSON(http.StatusInternalServerError, gin.H{
-						"error":   "Failed to create call",
-						"details": err.Error(),
-					})
-					return
-				}
+			calls := api.Group("/calls")
+			calls.Use(callMiddleware.AuthenticateCall())
+			{
+				calls.POST("/add", idempotent, func(c *gin.Context) {
+					var req CallControllers.AddCallRequest
+					if err := c.ShouldBindJSON(&req); err != nil {
+						c.JSON(http.StatusBadRequest, gin.H{
+							"error":   "Invalid request",
+							"details": err.Error(),
+						})
+						return
+					}
+
+					call, err := callController.AddCall(c, req)
+					if err != nil {
+						log.Printf("Error adding call: %v", err)
+						c.JSON(models.ErrorStatus(err, http.StatusInternalServerError), gin.H{
+							"error":   "Failed to create call",
+							"details": err.Error(),
+						})
+						return
+					}
 
-				c.JSON(http.StatusCreated, gin.H{
-					"message": "Call has been created",
-					"data":    call,
+					c.JSON(http.StatusCreated, gin.H{
+						"message": "Call has been created",
+						"data":    call,
+					})
 				})
-			})
-			calls.GET("/", callController.GetCalls)
-			calls.GET("/:id", callController.GetCallByID)
-		}
+				calls.GET("/", callController.GetCalls)
+				calls.GET("/export", callController.ExportCalls)
+				calls.GET("/:id", callController.GetCallByID)
+				calls.PUT("/:id", callController.UpdateCall)
+				calls.GET("/:id/comments", commentController.ListForEntity(CallAndMeetModels.CommentOnCall))
+			}
 
-		comments := api.Group("/comments")
-		comments.Use(commentMiddleware.AuthenticateComment())
-		{
-			comments.POST("/add", commentController.CreateComment)
-			comments.GET("/", commentController.GetAllComments)
-			comments.GET("/:id", commentController.GetCommentByID)
-			comments.PUT("/:id", commentController.UpdateComment)
-			comments.DELETE("/:id", commentController.DeleteComment)
+			tasks := api.Group("/tasks")
+			tasks.Use(AuthMiddleware.AuthMiddleware(authCommand))
+			{
+				tasks.POST("/add", idempotent, taskController.AddTask)
+				tasks.GET("/", taskController.GetTasks)
+				tasks.POST("/:id/complete", taskController.CompleteTask)
+			}
+
+			notifications := api.Group("/notifications")
+			notifications.Use(AuthMiddleware.AuthMiddleware(authCommand))
+			{
+				notifications.GET("/", notificationController.GetNotifications)
+				notifications.GET("/unread-count", notificationController.UnreadCount)
+				notifications.POST("/read-all", notificationController.MarkAllRead)
+				notifications.POST("/devices", notificationController.RegisterDevice)
+				notifications.POST("/:id/read", notificationController.MarkRead)
+			}
+
+			attachments := api.Group("/attachments")
+			attachments.Use(AuthMiddleware.AuthMiddleware(authCommand))
+			{
+				attachments.GET("/:id/download", attachmentController.Download)
+				attachments.DELETE("/:id", attachmentController.Delete)
+			}
+
+			comments := api.Group("/comments")
+			comments.Use(commentMiddleware.AuthenticateComment())
+			{
+				comments.POST("/add", idempotent, commentController.CreateComment)
+				comments.GET("/", commentController.GetAllComments)
+				comments.GET("/mentions", commentController.GetMentions)
+				comments.GET("/:id", commentController.GetCommentByID)
+				comments.PUT("/:id", commentController.UpdateComment)
+				comments.DELETE("/:id", commentController.DeleteComment)
+			}
+
+			analytics := api.Group("/analytics")
+			analytics.Use(AuthMiddleware.AuthMiddleware(authCommand))
+			{
+				analytics.GET("/funnel", analyticsController.Funnel)
+			}
+			api.GET("/leaderboard", AuthMiddleware.AuthMiddleware(authCommand), analyticsController.GetLeaderboard)
+			api.GET("/audit", AuthMiddleware.AuthMiddleware(authCommand), auditController.GetEntries)
+			api.GET("/sync", AuthMiddleware.AuthMiddleware(authCommand), syncController.GetChanges)
+			api.POST("/sync", AuthMiddleware.AuthMiddleware(authCommand), idempotent, syncController.ApplyChanges)
+
+			commissions := api.Group("/commissions")
+			commissions.Use(AuthMiddleware.AuthMiddleware(authCommand))
+			{
+				commissions.GET("/", commissionController.GetStatement)
+				commissions.POST("/:id/approve", commissionController.ApproveCommission)
+				commissions.POST("/:id/pay", commissionController.PayCommission)
+				commissions.POST("/rules/add", idempotent, commissionController.CreateRule)
+				commissions.GET("/rules", commissionController.GetRules)
+				commissions.PUT("/rules/:id", commissionController.UpdateRule)
+			}
+
+			targets := api.Group("/targets")
+			targets.Use(AuthMiddleware.AuthMiddleware(authCommand))
+			{
+				targets.POST("/add", idempotent, targetController.CreateTarget)
+				targets.GET("/", targetController.GetTargets)
+				targets.GET("/progress", targetController.GetProgress)
+				targets.GET("/history", targetController.GetHistory)
+				targets.PUT("/:id", targetController.UpdateTarget)
+				targets.DELETE("/:id", targetController.DeleteTarget)
+			}
 		}
 	}
 
-	if err := r.Run(":8080"); err != nil {
-		log.Fatal("Error starting server:", err)
-	}
+	return r
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Arkariza/API_MyActivity/docs"
+	"github.com/Arkariza/API_MyActivity/models"
+	"github.com/Arkariza/API_MyActivity/storage"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TestRoutesDocumented builds the real router and checks that every route is
+// in the OpenAPI document and every documented route exists. Building the
+// router does not reach the database, so no server is needed.
+func TestRoutesDocumented(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(context.Background())
+	models.DB = client.Database(models.DbName)
+
+	store, err := storage.NewLocalDisk(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := setupRouter(ctx, store)
+
+	if err := docs.Verify(r.Routes(), docs.Operations); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -82,8 +82,11 @@ func (m *CommentMiddleware) AuthenticateComment() gin.HandlerFunc {
 			return
 		}
 
+		username, _ := claims["username"].(string)
+
 		c.Set("user_id", userID)
 		c.Set("role", int(role))
+		c.Set("username", username)
 
  		fmt.Printf("Authenticated User ID: %s, Role: %d\n", userID, int(role))
 
@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// createAnalyticsIndexes backs the lookups from leads to their calls and
+// meets, and the per-owner date ranges the reports match on.
+func createAnalyticsIndexes(ctx context.Context, db *mongo.Database) error {
+	for _, collection := range []string{"call", "meet"} {
+		_, err := db.Collection(collection).Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "lead_id", Value: 1}},
+			Options: options.Index().SetName("lead_id"),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	_, err := db.Collection("leads").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}},
+		Options: options.Index().SetName("user_id_created_at"),
+	})
+	return err
+}
+
+func createTeamIndex(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "team", Value: 1}},
+		Options: options.Index().SetName("team"),
+	})
+	return err
+}
@@ -0,0 +1,17 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func createAttachmentIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("attachments").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "entity_type", Value: 1}, {Key: "entity_id", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetName("entity_created"),
+	})
+	return err
+}
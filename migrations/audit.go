@@ -0,0 +1,21 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// createAuditIndexes serves the audit log filters: an entity's history, an
+// actor's changes, everything done by one request, and the whole log by time.
+func createAuditIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("audit_log").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "entity", Value: 1}, {Key: "entity_id", Value: 1}, {Key: "time", Value: -1}}, Options: options.Index().SetName("entity_time")},
+		{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "time", Value: -1}}, Options: options.Index().SetName("actor_time")},
+		{Keys: bson.D{{Key: "request_id", Value: 1}}, Options: options.Index().SetName("request_id")},
+		{Keys: bson.D{{Key: "time", Value: -1}}, Options: options.Index().SetName("time")},
+	})
+	return err
+}
@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func createCommentIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("comments").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "entity_type", Value: 1}, {Key: "entity_id", Value: 1}, {Key: "date", Value: 1}},
+		Options: options.Index().SetName("entity_date"),
+	})
+	return err
+}
+
+func createMentionIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("comments").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "mentions", Value: 1}, {Key: "date", Value: -1}},
+		Options: options.Index().SetName("mentions_date"),
+	})
+	return err
+}
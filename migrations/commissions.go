@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"context"
+
+	leadModels "github.com/Arkariza/API_MyActivity/models/ManageLead"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// createCommissionIndexes allows one commission per lead and serves
+// statements per referrer and rule lookups by tier.
+func createCommissionIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("commissions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "lead_id", Value: 1}}, Options: options.Index().SetName("lead_id").SetUnique(true)},
+		{Keys: bson.D{{Key: "referrer_id", Value: 1}, {Key: "accrued_at", Value: -1}}, Options: options.Index().SetName("referrer_accrued_at")},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("commission_rules").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "active", Value: 1}, {Key: "min_premium", Value: -1}, {Key: "effective_from", Value: -1}},
+		Options: options.Index().SetName("active_tier"),
+	})
+	return err
+}
+
+// backfillLeadReferrers records the referrer of referral leads created
+// before it was stored. Those leads were created by their referrer, who
+// owns them unless they were reassigned since.
+func backfillLeadReferrers(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("leads").UpdateMany(ctx,
+		bson.M{"type_lead": leadModels.TypeReferral, "referrer_id": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"referrer_id": "$user_id"}}}},
+	)
+	return err
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// createIdempotencyIndexes lets MongoDB remove idempotency records once their
+// replay window is over.
+func createIdempotencyIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("idempotency_keys").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+	})
+	return err
+}
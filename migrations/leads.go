@@ -0,0 +1,68 @@
+package migrations
+
+import (
+	"context"
+
+	leadModels "github.com/Arkariza/API_MyActivity/models/ManageLead"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func createLeadImportIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("leads").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "numphone", Value: 1}},
+		Options: options.Index().SetName("numphone"),
+	})
+	return err
+}
+
+// backfillLeadKeys computes the duplicate detection keys for leads created
+// before they existed. The keys need Go string handling, so leads are
+// updated one by one in bulk batches.
+func backfillLeadKeys(ctx context.Context, db *mongo.Database) error {
+	leads := db.Collection("leads")
+	cursor, err := leads.Find(ctx, bson.M{"phone_key": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"numphone": 1, "clientname": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var writes []mongo.WriteModel
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		_, err := leads.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		writes = writes[:0]
+		return err
+	}
+	for cursor.Next(ctx) {
+		var lead leadModels.Lead
+		if err := cursor.Decode(&lead); err != nil {
+			return err
+		}
+		lead.SetKeys()
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": lead.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"phone_key": lead.PhoneKey, "name_key": lead.NameKey}}))
+		if len(writes) == 500 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+func createLeadKeyIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("leads").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "phone_key", Value: 1}}, Options: options.Index().SetName("phone_key")},
+		{Keys: bson.D{{Key: "name_key", Value: 1}}, Options: options.Index().SetName("name_key")},
+	})
+	return err
+}
@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/Arkariza/API_MyActivity/geo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// locatable matches documents whose latitude/longitude pair is a real
+// position. Leads created without coordinates are stored at 0,0 and are left
+// without a location rather than being placed in the Gulf of Guinea.
+var locatable = bson.M{
+	"location":  bson.M{"$exists": false},
+	"latitude":  bson.M{"$gte": -90, "$lte": 90},
+	"longitude": bson.M{"$gte": -180, "$lte": 180},
+	"$nor":      bson.A{bson.M{"latitude": 0, "longitude": 0}},
+}
+
+func backfillLocations(ctx context.Context, db *mongo.Database) error {
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"location": geo.PointExpr("latitude", "longitude"),
+	}}}}
+
+	for _, name := range []string{"leads", "meet"} {
+		if _, err := db.Collection(name).UpdateMany(ctx, locatable, update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createLocationIndexes(ctx context.Context, db *mongo.Database) error {
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "location", Value: "2dsphere"}},
+		Options: options.Index().SetName("location_2dsphere"),
+	}
+
+	for _, name := range []string{"leads", "meet"} {
+		if _, err := db.Collection(name).Indexes().CreateOne(ctx, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
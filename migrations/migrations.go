@@ -0,0 +1,83 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Migration struct {
+	ID  string
+	Run func(ctx context.Context, db *mongo.Database) error
+}
+
+type appliedMigration struct {
+	ID        string    `bson:"_id"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+const collectionName = "migrations"
+
+// all lists every migration in the order it must be applied. IDs are stored
+// once applied, so never rename or reorder existing entries.
+var all = []Migration{
+	{ID: "0001_location_backfill", Run: backfillLocations},
+	{ID: "0002_location_indexes", Run: createLocationIndexes},
+	{ID: "0003_task_indexes", Run: createTaskIndexes},
+	{ID: "0004_notification_indexes", Run: createNotificationIndexes},
+	{ID: "0005_comment_indexes", Run: createCommentIndexes},
+	{ID: "0006_mention_indexes", Run: createMentionIndexes},
+	{ID: "0007_attachment_indexes", Run: createAttachmentIndexes},
+	{ID: "0008_lead_phone_index", Run: createLeadImportIndexes},
+	{ID: "0009_lead_key_backfill", Run: backfillLeadKeys},
+	{ID: "0010_lead_key_indexes", Run: createLeadKeyIndexes},
+	{ID: "0011_phone_e164", Run: normalizePhones},
+	{ID: "0012_analytics_indexes", Run: createAnalyticsIndexes},
+	{ID: "0013_target_indexes", Run: createTargetIndexes},
+	{ID: "0014_lead_closed_at_backfill", Run: backfillLeadClosedAt},
+	{ID: "0015_team_index", Run: createTeamIndex},
+	{ID: "0016_commission_indexes", Run: createCommissionIndexes},
+	{ID: "0017_lead_referrer_backfill", Run: backfillLeadReferrers},
+	{ID: "0018_audit_indexes", Run: createAuditIndexes},
+	{ID: "0019_version_backfill", Run: backfillVersions},
+	{ID: "0020_idempotency_indexes", Run: createIdempotencyIndexes},
+	{ID: "0021_modified_at_backfill", Run: backfillModifiedAt},
+	{ID: "0022_sync_indexes", Run: createSyncIndexes},
+}
+
+// Run applies every migration that has not been recorded as applied yet.
+func Run(db *mongo.Database) error {
+	applied := db.Collection(collectionName)
+
+	for _, migration := range all {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		err := runOnce(ctx, db, applied, migration)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", migration.ID, err)
+		}
+	}
+	return nil
+}
+
+func runOnce(ctx context.Context, db *mongo.Database, applied *mongo.Collection, migration Migration) error {
+	err := applied.FindOne(ctx, bson.M{"_id": migration.ID}).Err()
+	if err == nil {
+		return nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	log.Printf("Applying migration %s", migration.ID)
+	if err := migration.Run(ctx, db); err != nil {
+		return err
+	}
+
+	_, err = applied.InsertOne(ctx, appliedMigration{ID: migration.ID, AppliedAt: time.Now()})
+	return err
+}
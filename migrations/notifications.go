@@ -0,0 +1,17 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func createNotificationIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("notifications").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "read", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetName("user_read_created"),
+	})
+	return err
+}
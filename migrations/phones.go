@@ -0,0 +1,89 @@
+package migrations
+
+import (
+	"context"
+	"log"
+
+	leadModels "github.com/Arkariza/API_MyActivity/models/ManageLead"
+	"github.com/Arkariza/API_MyActivity/phone"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// phoneFields names the phone number field of every collection that has one.
+var phoneFields = []struct {
+	collection string
+	field      string
+}{
+	{"leads", "numphone"},
+	{"call", "phonenum"},
+	{"meet", "phone_num"},
+	{"users", "phone_num"},
+}
+
+// normalizePhones rewrites stored phone numbers to E.164. Numbers that
+// cannot be normalized are left as typed and only counted, so that nobody
+// loses a number that was good enough to call.
+func normalizePhones(ctx context.Context, db *mongo.Database) error {
+	for _, target := range phoneFields {
+		if err := normalizePhoneField(ctx, db.Collection(target.collection), target.field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func normalizePhoneField(ctx context.Context, collection *mongo.Collection, field string) error {
+	cursor, err := collection.Find(ctx, bson.M{field: bson.M{"$type": "string", "$not": bson.M{"$regex": `^\+[1-9][0-9]+$`}}},
+		options.Find().SetProjection(bson.M{field: 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var writes []mongo.WriteModel
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		_, err := collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		writes = writes[:0]
+		return err
+	}
+	invalid := 0
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		raw, _ := cursor.Current.Lookup(field).StringValueOK()
+		normalized, err := phone.Normalize(raw)
+		if err != nil {
+			invalid++
+			continue
+		}
+		set := bson.M{field: normalized}
+		if collection.Name() == "leads" {
+			set["phone_key"] = leadModels.PhoneKey(normalized)
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doc.ID}).
+			SetUpdate(bson.M{"$set": set}))
+		if len(writes) == 500 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if invalid > 0 {
+		log.Printf("%s.%s: %d phone numbers could not be normalized and were left unchanged", collection.Name(), field, invalid)
+	}
+	return flush()
+}
@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"context"
+
+	syncModels "github.com/Arkariza/API_MyActivity/models/Sync"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// backfillModifiedAt dates the last change of records saved before changes
+// were tracked to when they were created, so that a full sync includes them.
+func backfillModifiedAt(ctx context.Context, db *mongo.Database) error {
+	created := map[string]interface{}{
+		"leads":    "$created_at",
+		"call":     "$created_at",
+		"meet":     "$created_at",
+		"comments": bson.M{"$ifNull": bson.A{"$updated_at", "$date"}},
+	}
+	for name, from := range created {
+		_, err := db.Collection(name).UpdateMany(ctx,
+			bson.M{"modified_at": bson.M{"$exists": false}},
+			mongo.Pipeline{{{Key: "$set", Value: bson.M{"modified_at": bson.M{"$ifNull": bson.A{from, "$$NOW"}}}}}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createSyncIndexes serves the sync reads: changes in modification order,
+// overall for staff and per owner for everyone else, and removals, which
+// expire after the retention period.
+func createSyncIndexes(ctx context.Context, db *mongo.Database) error {
+	changed := bson.D{{Key: "modified_at", Value: 1}, {Key: "_id", Value: 1}}
+	ownChanged := bson.D{{Key: "user_id", Value: 1}, {Key: "modified_at", Value: 1}, {Key: "_id", Value: 1}}
+	for _, name := range []string{"leads", "call", "meet"} {
+		_, err := db.Collection(name).Indexes().CreateMany(ctx, []mongo.IndexModel{
+			{Keys: changed, Options: options.Index().SetName("modified")},
+			{Keys: ownChanged, Options: options.Index().SetName("user_modified")},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	_, err := db.Collection("comments").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: changed, Options: options.Index().SetName("modified")},
+		{Keys: bson.D{{Key: "entity_id", Value: 1}, {Key: "modified_at", Value: 1}}, Options: options.Index().SetName("entity_modified")},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("tombstones").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "removed_at", Value: 1}, {Key: "_id", Value: 1}}, Options: options.Index().SetName("owner_removed")},
+		{Keys: bson.D{{Key: "reason", Value: 1}, {Key: "removed_at", Value: 1}, {Key: "_id", Value: 1}}, Options: options.Index().SetName("reason_removed")},
+		{Keys: bson.D{{Key: "removed_at", Value: 1}}, Options: options.Index().SetName("removed_at_ttl").
+			SetExpireAfterSeconds(int32(syncModels.TombstoneRetention.Seconds()))},
+	})
+	return err
+}
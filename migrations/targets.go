@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"context"
+
+	leadModels "github.com/Arkariza/API_MyActivity/models/ManageLead"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// createTargetIndexes allows one target per user or role, metric and period,
+// and one snapshot per target, user and period.
+func createTargetIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("targets").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "metric", Value: 1}, {Key: "period", Value: 1}},
+			Options: options.Index().SetName("user_metric_period").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"user_id": bson.M{"$exists": true}}),
+		},
+		{
+			Keys: bson.D{{Key: "role", Value: 1}, {Key: "metric", Value: 1}, {Key: "period", Value: 1}},
+			Options: options.Index().SetName("role_metric_period").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"role": bson.M{"$exists": true}}),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("target_snapshots").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "target_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "period_start", Value: 1}},
+			Options: options.Index().SetName("target_user_period").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "period_start", Value: -1}},
+			Options: options.Index().SetName("user_period"),
+		},
+	})
+	return err
+}
+
+// backfillLeadClosedAt dates the outcome of leads closed before closed_at
+// was recorded. Their creation time is the only date they have.
+func backfillLeadClosedAt(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("leads").UpdateMany(ctx,
+		bson.M{
+			"status":    bson.M{"$in": bson.A{leadModels.StatusWin, leadModels.StatusLose}},
+			"closed_at": bson.M{"$exists": false},
+		},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"closed_at": "$created_at"}}}},
+	)
+	return err
+}
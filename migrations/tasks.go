@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func createTaskIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("tasks").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "status", Value: 1}, {Key: "due_date", Value: 1}},
+			Options: options.Index().SetName("user_status_due"),
+		},
+		{
+			Keys:    bson.D{{Key: "call_id", Value: 1}},
+			Options: options.Index().SetName("call_id"),
+		},
+	})
+	return err
+}
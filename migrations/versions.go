@@ -0,0 +1,22 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// backfillVersions gives records saved before versioning the version new
+// records start at, so that every record has an ETag other than "0".
+func backfillVersions(ctx context.Context, db *mongo.Database) error {
+	for _, name := range []string{"leads", "call", "meet", "comments"} {
+		_, err := db.Collection(name).UpdateMany(ctx,
+			bson.M{"version": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"version": 1}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
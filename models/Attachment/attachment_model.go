@@ -0,0 +1,58 @@
+package models
+
+import (
+    "os"
+    "strconv"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+    AttachOnLead = "lead"
+    AttachOnMeet = "meet"
+
+    maxSizeEnvKey  = "ATTACHMENT_MAX_BYTES"
+    defaultMaxSize = 10 << 20
+)
+
+// AllowedTypes are the sniffed content types accepted for upload: photos of
+// forms and sites, and scanned documents.
+var AllowedTypes = map[string]bool{
+    "image/jpeg":      true,
+    "image/png":       true,
+    "image/gif":       true,
+    "image/webp":      true,
+    "application/pdf": true,
+}
+
+type Attachment struct {
+    ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    EntityType  string             `bson:"entity_type" json:"entity_type"`
+    EntityID    primitive.ObjectID `bson:"entity_id" json:"entity_id"`
+    UploadedBy  primitive.ObjectID `bson:"uploaded_by" json:"uploaded_by"`
+    FileName    string             `bson:"file_name" json:"file_name"`
+    ContentType string             `bson:"content_type" json:"content_type"`
+    Size        int64              `bson:"size" json:"size"`
+    SHA256      string             `bson:"sha256" json:"sha256"`
+    StorageKey  string             `bson:"storage_key" json:"-"`
+    CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// MaxSize is the largest accepted upload in bytes, from ATTACHMENT_MAX_BYTES
+// (default 10 MiB).
+func MaxSize() int64 {
+    if value := os.Getenv(maxSizeEnvKey); value != "" {
+        if size, err := strconv.ParseInt(value, 10, 64); err == nil && size > 0 {
+            return size
+        }
+    }
+    return defaultMaxSize
+}
+
+// Key is where a new attachment's contents are kept in storage. It is saved
+// as StorageKey, which stays put if the attachment later moves to another
+// lead, e.g. when leads are merged.
+func (a *Attachment) Key() string {
+    return a.EntityType + "/" + a.EntityID.Hex() + "/" + a.ID.Hex()
+}
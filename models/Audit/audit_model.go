@@ -0,0 +1,37 @@
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+    ActionCreated = "created"
+    ActionUpdated = "updated"
+    ActionDeleted = "deleted"
+)
+
+// Change is the value of one field before and after a mutation. Before is
+// unset for created entities and After for deleted ones.
+type Change struct {
+    Before interface{} `bson:"before,omitempty" json:"before,omitempty"`
+    After  interface{} `bson:"after,omitempty" json:"after,omitempty"`
+}
+
+// Entry records one mutation: who made it, from where, and which fields it
+// changed. Entries are only ever inserted.
+type Entry struct {
+    ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+    ActorID   *primitive.ObjectID `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+    ActorRole int                 `bson:"actor_role,omitempty" json:"actor_role,omitempty"`
+    Action    string              `bson:"action" json:"action"`
+    Entity    string              `bson:"entity" json:"entity"`
+    EntityID  primitive.ObjectID  `bson:"entity_id" json:"entity_id"`
+    Changes   map[string]Change   `bson:"changes" json:"changes"`
+    IP        string              `bson:"ip" json:"ip"`
+    RequestID string              `bson:"request_id" json:"request_id"`
+    Method    string              `bson:"method" json:"method"`
+    Path      string              `bson:"path" json:"path"`
+    Time      time.Time           `bson:"time" json:"time"`
+}
@@ -8,15 +8,21 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const ProspectFollowUp = "follow_up"
+
 type Call struct {
-    ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-    ClientName     string             `bson:"client_name" json:"client_name"`
-    PhoneNum       string             `bson:"phonenum" json:"phone_num"`
-    ProspectStatus string             `bson:"prospect_status" json:"prospect_status"`
-    Date           time.Time          `bson:"date" json:"date"`
-    Note           string             `bson:"note" json:"note"`
-    CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
-    CallResult     string             `bson:"call_result" json:"call_result"`
+    ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+    UserID         primitive.ObjectID  `bson:"user_id,omitempty" json:"user_id,omitempty"`
+    LeadID         *primitive.ObjectID `bson:"lead_id,omitempty" json:"lead_id,omitempty"`
+    ClientName     string              `bson:"client_name" json:"client_name"`
+    PhoneNum       string              `bson:"phonenum" json:"phone_num"`
+    ProspectStatus string              `bson:"prospect_status" json:"prospect_status"`
+    Date           time.Time           `bson:"date" json:"date"`
+    Note           string              `bson:"note" json:"note"`
+    CreatedAt      time.Time           `bson:"created_at" json:"created_at"`
+    CallResult     string              `bson:"call_result" json:"call_result"`
+    Version        int64               `bson:"version" json:"version"`
+    ModifiedAt     time.Time           `bson:"modified_at" json:"modified_at"`
 }
 
 func (c *Call) Validate() error {
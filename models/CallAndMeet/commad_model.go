@@ -2,18 +2,56 @@ package models
 
 import (
     "errors"
+    "regexp"
     "strings"
     "time"
     "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+    CommentOnLead = "lead"
+    CommentOnCall = "call"
+    CommentOnMeet = "meet"
+)
+
 type Comment struct {
-    ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-    Title           string             `bson:"title" json:"title"`
-    Description     string             `bson:"description" json:"description"`
-    Date            time.Time          `bson:"date" json:"date"`
-    PostedBy        string             `bson:"posted_by" json:"posted_by"`
-    UserRole        int                `bson:"user_role" json:"user_role"`
+    ID              primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+    Title           string               `bson:"title" json:"title"`
+    Description     string               `bson:"description" json:"description"`
+    Date            time.Time            `bson:"date" json:"date"`
+    PostedBy        string               `bson:"posted_by" json:"posted_by"`
+    UserRole        int                  `bson:"user_role" json:"user_role"`
+    UserID          primitive.ObjectID   `bson:"user_id,omitempty" json:"user_id,omitempty"`
+    EntityType      string               `bson:"entity_type,omitempty" json:"entity_type,omitempty"`
+    EntityID        primitive.ObjectID   `bson:"entity_id,omitempty" json:"entity_id,omitempty"`
+    ParentID        *primitive.ObjectID  `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
+    UpdatedAt       *time.Time           `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+    Mentions        []primitive.ObjectID `bson:"mentions,omitempty" json:"mentions,omitempty"`
+    Version         int64                `bson:"version" json:"version"`
+    ModifiedAt      time.Time            `bson:"modified_at" json:"modified_at"`
+}
+
+var mentionPattern = regexp.MustCompile(`(^|[^\w@])@([\w.-]+)`)
+
+// ParseMentions returns the distinct usernames mentioned as @username in
+// text, in order of first appearance. Trailing punctuation is not part of
+// the name, so "thanks @budi." mentions "budi".
+func ParseMentions(text string) []string {
+    seen := map[string]bool{}
+    var usernames []string
+    for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+        username := strings.TrimRight(match[2], ".-")
+        if username == "" || seen[username] {
+            continue
+        }
+        seen[username] = true
+        usernames = append(usernames, username)
+    }
+    return usernames
+}
+
+func ValidCommentEntity(entityType string) bool {
+    return entityType == CommentOnLead || entityType == CommentOnCall || entityType == CommentOnMeet
 }
 
 func (c *Comment) Validate() error {
@@ -35,6 +73,10 @@ func (c *Comment) Validate() error {
         return errors.New("posted by name must be between 2 and 255 characters")
     }
 
+    if c.EntityType != "" && !ValidCommentEntity(c.EntityType) {
+        return errors.New("invalid entity type, must be one of: lead, call, meet")
+    }
+
     return nil
 }
 
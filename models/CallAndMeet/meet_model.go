@@ -5,21 +5,89 @@ import (
     "strings"
     "time"
 
+    "github.com/Arkariza/API_MyActivity/geo"
     "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Meet struct {
-    ID             primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-    PhoneNum       string             `bson:"phone_num" json:"phone_num"`
-    ClientName     string             `bson:"client_name" json:"client_name"`
-    Address        string             `bson:"address" json:"address"`
-    ProspectStatus string             `bson:"prospect_status" json:"prospect_status"`
-    Latitude       float64            `bson:"latitude" json:"latitude"`
-    Longitude      float64            `bson:"longitude" json:"longitude"`
-    Date           time.Time          `bson:"date" json:"date"`
-    MeetResult     string             `bson:"meet_result" json:"meet_result"`
-    CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
-    Note           string             `bson:"note" json:"note"`
+    ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+    UserID         primitive.ObjectID  `bson:"user_id,omitempty" json:"user_id,omitempty"`
+    LeadID         *primitive.ObjectID `bson:"lead_id,omitempty" json:"lead_id,omitempty"`
+    PhoneNum       string              `bson:"phone_num" json:"phone_num"`
+    ClientName     string              `bson:"client_name" json:"client_name"`
+    Address        string              `bson:"address" json:"address"`
+    ProspectStatus string              `bson:"prospect_status" json:"prospect_status"`
+    Latitude       float64             `bson:"latitude" json:"latitude"`
+    Longitude      float64             `bson:"longitude" json:"longitude"`
+    Location       *geo.Point          `bson:"location,omitempty" json:"location,omitempty"`
+    Date           time.Time           `bson:"date" json:"date"`
+    FixedTime      bool                `bson:"fixed_time,omitempty" json:"fixed_time"`
+    MeetResult     string              `bson:"meet_result" json:"meet_result"`
+    CreatedAt      time.Time           `bson:"created_at" json:"created_at"`
+    Note           string              `bson:"note" json:"note"`
+    Status         string              `bson:"status" json:"status"`
+    CancelReason   string              `bson:"cancel_reason,omitempty" json:"cancel_reason,omitempty"`
+    CompletedAt    *time.Time          `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+    History        []MeetReschedule    `bson:"history,omitempty" json:"history,omitempty"`
+    CheckIn        *MeetVisit          `bson:"check_in,omitempty" json:"check_in,omitempty"`
+    CheckOut       *MeetVisit          `bson:"check_out,omitempty" json:"check_out,omitempty"`
+    VisitDuration  int64               `bson:"visit_duration_seconds,omitempty" json:"visit_duration_seconds,omitempty"`
+    VisitFlagged   bool                `bson:"visit_flagged,omitempty" json:"visit_flagged,omitempty"`
+    Version        int64               `bson:"version" json:"version"`
+    ModifiedAt     time.Time           `bson:"modified_at" json:"modified_at"`
+}
+
+// MeetVisit is a device position reported when the agent arrives at or
+// leaves the client. Distance is measured from the meet location in meters.
+type MeetVisit struct {
+    UserID     string    `bson:"user_id" json:"user_id"`
+    Latitude   float64   `bson:"latitude" json:"latitude"`
+    Longitude  float64   `bson:"longitude" json:"longitude"`
+    Accuracy   float64   `bson:"accuracy" json:"accuracy"`
+    Distance   float64   `bson:"distance" json:"distance"`
+    OutOfRange bool      `bson:"out_of_range" json:"out_of_range"`
+    At         time.Time `bson:"at" json:"at"`
+}
+
+type MeetReschedule struct {
+    PreviousDate  time.Time `bson:"previous_date" json:"previous_date"`
+    RescheduledAt time.Time `bson:"rescheduled_at" json:"rescheduled_at"`
+    Reason        string    `bson:"reason" json:"reason"`
+}
+
+const (
+    MeetScheduled = "scheduled"
+    MeetCompleted = "completed"
+    MeetCancelled = "cancelled"
+    MeetNoShow    = "no_show"
+)
+
+// meetTransitions lists, for each target status, the statuses a meet may be
+// in before moving there. Rescheduling moves a meet back to scheduled.
+var meetTransitions = map[string][]string{
+    MeetScheduled: {MeetScheduled, MeetNoShow},
+    MeetCompleted: {MeetScheduled},
+    MeetCancelled: {MeetScheduled},
+    MeetNoShow:    {MeetScheduled},
+}
+
+// MeetStatusesBefore returns the statuses a meet may transition from to reach
+// the given status.
+func MeetStatusesBefore(status string) []string {
+    return meetTransitions[status]
+}
+
+func (m *Meet) CanTransitionTo(status string) bool {
+    current := m.Status
+    if current == "" {
+        current = MeetScheduled
+    }
+    for _, from := range meetTransitions[status] {
+        if from == current {
+            return true
+        }
+    }
+    return false
 }
 
 func (m *Meet) Validate() error {
@@ -62,6 +130,9 @@ func (m *Meet) Validate() error {
 
 func (m *Meet) BeforeCreate() {
     m.CreatedAt = time.Now()
+    if m.Status == "" {
+        m.Status = MeetScheduled
+    }
     if m.ProspectStatus == "" {
         m.ProspectStatus = "potential"
     }
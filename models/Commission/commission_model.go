@@ -0,0 +1,65 @@
+package models
+
+import (
+    "math"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+    RuleFlat       = "flat"
+    RulePercentage = "percentage"
+
+    StatusAccrued   = "accrued"
+    StatusApproved  = "approved"
+    StatusPaid      = "paid"
+    StatusCancelled = "cancelled"
+)
+
+// Rule says what a referrer earns when a referral lead is won: a flat amount
+// or a percentage of the premium. Rules with a MinPremium form tiers; the
+// highest tier the premium reaches applies.
+type Rule struct {
+    ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    Name          string             `bson:"name" json:"name"`
+    Kind          string             `bson:"kind" json:"kind"`
+    Value         float64            `bson:"value" json:"value"`
+    MinPremium    float64            `bson:"min_premium" json:"min_premium"`
+    EffectiveFrom time.Time          `bson:"effective_from" json:"effective_from"`
+    Active        bool               `bson:"active" json:"active"`
+    CreatedBy     primitive.ObjectID `bson:"created_by" json:"created_by"`
+    CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+    UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// AmountFor returns the commission on a premium, rounded to whole rupiah.
+func (r *Rule) AmountFor(premium float64) float64 {
+    if r.Kind == RulePercentage {
+        return math.Round(premium * r.Value / 100)
+    }
+    return r.Value
+}
+
+// Commission is what a referrer earned on one won lead. It is accrued when
+// the lead is won, then approved and paid by staff. A lead that stops being
+// won before approval has its commission cancelled.
+type Commission struct {
+    ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+    LeadID      primitive.ObjectID  `bson:"lead_id" json:"lead_id"`
+    ClientName  string              `bson:"client_name" json:"client_name"`
+    ReferrerID  primitive.ObjectID  `bson:"referrer_id" json:"referrer_id"`
+    RuleID      primitive.ObjectID  `bson:"rule_id" json:"rule_id"`
+    RuleKind    string              `bson:"rule_kind" json:"rule_kind"`
+    RuleValue   float64             `bson:"rule_value" json:"rule_value"`
+    Premium     float64             `bson:"premium" json:"premium"`
+    Amount      float64             `bson:"amount" json:"amount"`
+    Status      string              `bson:"status" json:"status"`
+    AccruedAt   time.Time           `bson:"accrued_at" json:"accrued_at"`
+    ApprovedAt  *time.Time          `bson:"approved_at,omitempty" json:"approved_at,omitempty"`
+    ApprovedBy  *primitive.ObjectID `bson:"approved_by,omitempty" json:"approved_by,omitempty"`
+    PaidAt      *time.Time          `bson:"paid_at,omitempty" json:"paid_at,omitempty"`
+    PaidBy      *primitive.ObjectID `bson:"paid_by,omitempty" json:"paid_by,omitempty"`
+    PaymentRef  string              `bson:"payment_ref,omitempty" json:"payment_ref,omitempty"`
+    CancelledAt *time.Time          `bson:"cancelled_at,omitempty" json:"cancelled_at,omitempty"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+    StatusProcessing = "processing"
+    StatusCompleted  = "completed"
+)
+
+// Record remembers a request sent with an Idempotency-Key and, once it has
+// been handled, the response to replay when the request is retried. ID is
+// derived from the user and the key, so keys never collide across users.
+type Record struct {
+    ID          string             `bson:"_id" json:"id"`
+    UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+    Key         string             `bson:"key" json:"key"`
+    Method      string             `bson:"method" json:"method"`
+    Path        string             `bson:"path" json:"path"`
+    RequestHash string             `bson:"request_hash" json:"request_hash"`
+    RequestSize int64              `bson:"request_size" json:"request_size"`
+    Status      string             `bson:"status" json:"status"`
+    StatusCode  int                `bson:"status_code,omitempty" json:"status_code,omitempty"`
+    Headers     map[string]string  `bson:"headers,omitempty" json:"headers,omitempty"`
+    Body        []byte             `bson:"body,omitempty" json:"-"`
+    CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+    LockedUntil time.Time          `bson:"locked_until" json:"locked_until"`
+    ExpiresAt   time.Time          `bson:"expires_at" json:"expires_at"`
+}
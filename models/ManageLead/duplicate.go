@@ -0,0 +1,88 @@
+package models
+
+import (
+    "strings"
+    "unicode"
+)
+
+// DuplicateNameThreshold is the NameSimilarity from which two client names
+// are treated as the same person.
+const DuplicateNameThreshold = 0.9
+
+// honorifics are dropped from client names before comparing them, so that
+// "Bapak Budi Santoso" and "Budi Santoso" match.
+var honorifics = map[string]bool{
+    "bapak": true, "pak": true, "bpk": true, "ibu": true, "bu": true,
+    "sdr": true, "sdri": true, "mr": true, "mrs": true, "ms": true,
+    "dr": true, "h": true, "hj": true,
+}
+
+// PhoneKey reduces a phone number to the digits that identify the line,
+// without the country or trunk prefix: "+62 812-3456", "0062 812 3456",
+// "0812 3456" and "628123456" all give "8123456".
+func PhoneKey(phone string) string {
+    var digits strings.Builder
+    for _, r := range phone {
+        if r >= '0' && r <= '9' {
+            digits.WriteRune(r)
+        }
+    }
+    key := digits.String()
+    switch {
+    case strings.HasPrefix(key, "0062"):
+        key = key[4:]
+    case strings.HasPrefix(key, "62"):
+        key = key[2:]
+    case strings.HasPrefix(key, "0"):
+        key = key[1:]
+    }
+    return strings.TrimLeft(key, "0")
+}
+
+// NameKey lowercases a client name and strips punctuation and honorifics.
+func NameKey(name string) string {
+    fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+    })
+    kept := fields[:0]
+    for _, field := range fields {
+        if !honorifics[field] {
+            kept = append(kept, field)
+        }
+    }
+    return strings.Join(kept, " ")
+}
+
+// NameSimilarity compares two name keys from 0 (nothing alike) to 1 (equal),
+// as one minus the edit distance relative to the longer name.
+func NameSimilarity(a, b string) float64 {
+    if a == "" || b == "" {
+        return 0
+    }
+    ra, rb := []rune(a), []rune(b)
+    longer := len(ra)
+    if len(rb) > longer {
+        longer = len(rb)
+    }
+    return 1 - float64(levenshtein(ra, rb))/float64(longer)
+}
+
+func levenshtein(a, b []rune) int {
+    previous := make([]int, len(b)+1)
+    current := make([]int, len(b)+1)
+    for j := range previous {
+        previous[j] = j
+    }
+    for i := 1; i <= len(a); i++ {
+        current[0] = i
+        for j := 1; j <= len(b); j++ {
+            cost := 1
+            if a[i-1] == b[j-1] {
+                cost = 0
+            }
+            current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+        }
+        previous, current = current, previous
+    }
+    return previous[len(b)]
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPhoneKey(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string
+	}{
+		{"+6281234567890", "81234567890"},
+		{"+62 812-3456-7890", "81234567890"},
+		{"0812 3456 7890", "81234567890"},
+		{"6281234567890", "81234567890"},
+		{"81234567890", "81234567890"},
+		{"+62 0812 3456 7890", "81234567890"},
+		{"0062 812 3456 7890", "81234567890"},
+		{"+14155552671", "14155552671"},
+		{"", ""},
+		{"n/a", ""},
+	}
+	for _, tt := range tests {
+		if got := PhoneKey(tt.phone); got != tt.want {
+			t.Errorf("PhoneKey(%q) = %q, want %q", tt.phone, got, tt.want)
+		}
+	}
+}
+
+func TestNameKey(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Budi Santoso", "budi santoso"},
+		{"Bapak Budi Santoso", "budi santoso"},
+		{"Bpk. BUDI  Santoso, S.E.", "budi santoso s e"},
+		{"Hj. Siti Aminah", "siti aminah"},
+		{"Dr. José", "josé"},
+		{"Ibu", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NameKey(tt.name); got != tt.want {
+			t.Errorf("NameKey(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"budi santoso", "budi santoso", 1},
+		{"budi", "budy", 0.75},
+		{"ann", "anna", 0.75},
+		{"anna", "ann", 0.75},
+		{"josé", "jose", 0.75},
+		{"abc", "xyz", 0},
+		{"budi", "", 0},
+		{"", "", 0},
+	}
+	for _, tt := range tests {
+		if got := NameSimilarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("NameSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	if NameSimilarity(NameKey("Bapak Budi Santoso"), NameKey("Budi Santosa")) < DuplicateNameThreshold {
+		t.Error("a one-letter typo should count as the same person")
+	}
+	if NameSimilarity(NameKey("Budi Santoso"), NameKey("Budi Hartono")) >= DuplicateNameThreshold {
+		t.Error("different surnames should not count as the same person")
+	}
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+    ImportPending = "pending"
+    ImportRunning = "running"
+    ImportDone    = "done"
+    ImportFailed  = "failed"
+
+    // MaxImportErrors caps the row errors kept on a job so that a file with
+    // the wrong mapping does not produce an oversized document.
+    MaxImportErrors = 500
+)
+
+// ImportRowError explains why one spreadsheet row was not imported.
+type ImportRowError struct {
+    Row     int    `bson:"row" json:"row"`
+    Field   string `bson:"field,omitempty" json:"field,omitempty"`
+    Message string `bson:"message" json:"message"`
+}
+
+// ImportJob tracks a bulk lead import running in the background.
+type ImportJob struct {
+    ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserID     primitive.ObjectID `bson:"user_id" json:"user_id"`
+    FileName   string             `bson:"file_name" json:"file_name"`
+    Status     string             `bson:"status" json:"status"`
+    Total      int                `bson:"total" json:"total"`
+    Processed  int                `bson:"processed" json:"processed"`
+    Created    int                `bson:"created" json:"created"`
+    Duplicates int                `bson:"duplicates" json:"duplicates"`
+    Invalid    int                `bson:"invalid" json:"invalid"`
+    Errors     []ImportRowError   `bson:"errors" json:"errors"`
+    Failure    string             `bson:"failure,omitempty" json:"failure,omitempty"`
+    CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+    FinishedAt *time.Time         `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// AddError records a row error, dropping it once MaxImportErrors is reached.
+func (j *ImportJob) AddError(row int, field, message string) {
+    if len(j.Errors) < MaxImportErrors {
+        j.Errors = append(j.Errors, ImportRowError{Row: row, Field: field, Message: message})
+    }
+}
@@ -2,23 +2,34 @@ package models
 
 import (
     "time"
+
+    "github.com/Arkariza/API_MyActivity/geo"
     "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Lead struct {
-    ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
-    UserID      primitive.ObjectID  `bson:"user_id" json:"user_id"`
-    NumPhone    string              `bson:"numphone" json:"numPhone" binding:"required"`
-    Priority    string              `bson:"priority" json:"priority" binding:"required"`
-    Latitude    float64             `bson:"latitude" json:"latitude" binding:"required"`
-    Longitude   float64             `bson:"longitude" json:"longitude" binding:"required"`
-    CreateAt    time.Time           `bson:"created_at" json:"createdAt"`
-    DateSubmit  time.Time           `bson:"date_submit,omitempty" json:"dateSubmit"`
-    ClientName  string              `bson:"clientname" json:"clientName" binding:"required"`
-    TypeLead    string              `bson:"type_lead" json:"typeLead"`
-    NoPolicy    int32               `bson:"no_policy,omitempty" json:"noPolicy"`
-    Information string              `bson:"information" json:"information"`
-    Status      string              `bson:"status" json:"status" binding:"required"`
+    ID          primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+    UserID      primitive.ObjectID   `bson:"user_id" json:"user_id"`
+    NumPhone    string               `bson:"numphone" json:"numPhone" binding:"required"`
+    Priority    string               `bson:"priority" json:"priority" binding:"required"`
+    Latitude    float64              `bson:"latitude" json:"latitude" binding:"required"`
+    Longitude   float64              `bson:"longitude" json:"longitude" binding:"required"`
+    CreateAt    time.Time            `bson:"created_at" json:"createdAt"`
+    DateSubmit  time.Time            `bson:"date_submit,omitempty" json:"dateSubmit"`
+    ClientName  string               `bson:"clientname" json:"clientName" binding:"required"`
+    TypeLead    string               `bson:"type_lead" json:"typeLead"`
+    NoPolicy    int32                `bson:"no_policy,omitempty" json:"noPolicy"`
+    Information string               `bson:"information" json:"information"`
+    Status      string               `bson:"status" json:"status" binding:"required"`
+    Location    *geo.Point           `bson:"location,omitempty" json:"location,omitempty"`
+    PhoneKey    string               `bson:"phone_key,omitempty" json:"-"`
+    NameKey     string               `bson:"name_key,omitempty" json:"-"`
+    MergedFrom  []primitive.ObjectID `bson:"merged_from,omitempty" json:"merged_from,omitempty"`
+    ClosedAt    *time.Time           `bson:"closed_at,omitempty" json:"closedAt,omitempty"`
+    ReferrerID  *primitive.ObjectID  `bson:"referrer_id,omitempty" json:"referrerId,omitempty"`
+    Premium     float64              `bson:"premium,omitempty" json:"premium,omitempty"`
+    Version     int64                `bson:"version" json:"version"`
+    ModifiedAt  time.Time            `bson:"modified_at" json:"modifiedAt"`
 }
 
 const (
@@ -46,6 +57,20 @@ func (l *Lead) BeforeCreate() {
     if l.CreateAt.IsZero() {
         l.CreateAt = time.Now()
     }
+    if l.ModifiedAt.IsZero() {
+        l.ModifiedAt = l.CreateAt
+    }
+    if l.ClosedAt == nil && (l.Status == StatusWin || l.Status == StatusLose) {
+        closedAt := l.CreateAt
+        l.ClosedAt = &closedAt
+    }
+    l.SetKeys()
+}
+
+// SetKeys refreshes the phone and name keys used to find duplicates.
+func (l *Lead) SetKeys() {
+    l.PhoneKey = PhoneKey(l.NumPhone)
+    l.NameKey = NameKey(l.ClientName)
 }
 
 func (l *Lead) TableName() string {
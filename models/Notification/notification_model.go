@@ -0,0 +1,41 @@
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+    TypeTaskDue        = "task_due"
+    TypeLeadReassigned = "lead_reassigned"
+    TypeComment        = "comment"
+    TypeMention        = "mention"
+    TypeLeadMerged     = "lead_merged"
+    TypeCommission     = "commission"
+)
+
+type Notification struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+    Type      string             `bson:"type" json:"type"`
+    Title     string             `bson:"title" json:"title"`
+    Body      string             `bson:"body" json:"body"`
+    Data      map[string]string  `bson:"data,omitempty" json:"data,omitempty"`
+    Read      bool               `bson:"read" json:"read"`
+    ReadAt    *time.Time         `bson:"read_at,omitempty" json:"read_at,omitempty"`
+    CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+func (n *Notification) BeforeCreate() {
+    if n.ID.IsZero() {
+        n.ID = primitive.NewObjectID()
+    }
+    if n.CreatedAt.IsZero() {
+        n.CreatedAt = time.Now()
+    }
+}
+
+func (n *Notification) TableName() string {
+    return "notifications"
+}
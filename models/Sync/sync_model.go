@@ -0,0 +1,30 @@
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+    // ReasonDeleted marks a record that no longer exists.
+    ReasonDeleted = "deleted"
+    // ReasonReassigned marks a record that moved to another owner and is no
+    // longer visible to the previous one.
+    ReasonReassigned = "reassigned"
+
+    // TombstoneRetention is how long removals are kept. A sync token older
+    // than this cannot be brought up to date and needs a full sync.
+    TombstoneRetention = 90 * 24 * time.Hour
+)
+
+// Tombstone records that a lead, call, meet or comment was removed from
+// OwnerID's view, so that synced devices drop their copy.
+type Tombstone struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    Entity    string             `bson:"entity" json:"entity"`
+    EntityID  primitive.ObjectID `bson:"entity_id" json:"entity_id"`
+    OwnerID   primitive.ObjectID `bson:"owner_id,omitempty" json:"owner_id,omitempty"`
+    Reason    string             `bson:"reason" json:"reason"`
+    RemovedAt time.Time          `bson:"removed_at" json:"removed_at"`
+}
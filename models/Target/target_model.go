@@ -0,0 +1,84 @@
+package models
+
+import (
+    "time"
+
+    meetModels "github.com/Arkariza/API_MyActivity/models/CallAndMeet"
+    leadModels "github.com/Arkariza/API_MyActivity/models/ManageLead"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+    MetricCalls = "calls"
+    MetricMeets = "meets"
+    MetricLeads = "leads"
+    MetricWins  = "wins"
+
+    PeriodDay   = "day"
+    PeriodWeek  = "week"
+    PeriodMonth = "month"
+)
+
+// Target is a goal for one metric per period, set either for a single user
+// or for every user with a role. A user's own target replaces the role's
+// target for the same metric and period.
+type Target struct {
+    ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+    UserID    *primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+    Role      int                 `bson:"role,omitempty" json:"role,omitempty"`
+    Metric    string              `bson:"metric" json:"metric"`
+    Period    string              `bson:"period" json:"period"`
+    Goal      int64               `bson:"goal" json:"goal"`
+    CreatedBy primitive.ObjectID  `bson:"created_by" json:"created_by"`
+    CreatedAt time.Time           `bson:"created_at" json:"created_at"`
+    UpdatedAt time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// Snapshot records how a user did against a target over one period that has
+// ended, so history survives later changes to the goal or the target itself.
+type Snapshot struct {
+    ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    TargetID    primitive.ObjectID `bson:"target_id" json:"target_id"`
+    UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+    Metric      string             `bson:"metric" json:"metric"`
+    Period      string             `bson:"period" json:"period"`
+    PeriodStart time.Time          `bson:"period_start" json:"period_start"`
+    PeriodEnd   time.Time          `bson:"period_end" json:"period_end"`
+    Goal        int64              `bson:"goal" json:"goal"`
+    Actual      int64              `bson:"actual" json:"actual"`
+    Achieved    bool               `bson:"achieved" json:"achieved"`
+    CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// PeriodBounds returns the start of the period containing at and the start
+// of the next one, in loc. Weeks start on Monday.
+func PeriodBounds(period string, at time.Time, loc *time.Location) (time.Time, time.Time) {
+    at = at.In(loc)
+    day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, loc)
+    switch period {
+    case PeriodWeek:
+        start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+        return start, start.AddDate(0, 0, 7)
+    case PeriodMonth:
+        start := time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, loc)
+        return start, start.AddDate(0, 1, 0)
+    }
+    return day, day.AddDate(0, 0, 1)
+}
+
+// MetricFilter matches the documents that count towards a metric between
+// start and end. Calls and new leads count when created, meets when
+// completed and wins when the lead was closed.
+func MetricFilter(metric string, start, end time.Time) bson.M {
+    between := bson.M{"$gte": start, "$lt": end}
+    switch metric {
+    case MetricCalls:
+        return bson.M{"created_at": between, "deleted_at": bson.M{"$exists": false}}
+    case MetricMeets:
+        return bson.M{"status": meetModels.MeetCompleted, "completed_at": between}
+    case MetricWins:
+        return bson.M{"status": leadModels.StatusWin, "closed_at": between}
+    }
+    return bson.M{"created_at": between}
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+    "errors"
+    "strings"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+    TaskTypeCall = "call"
+    TaskTypeMeet = "meet"
+
+    TaskOpen = "open"
+    TaskDone = "done"
+)
+
+type Task struct {
+    ID           primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+    UserID       primitive.ObjectID  `bson:"user_id" json:"user_id"`
+    Type         string              `bson:"type" json:"type"`
+    Title        string              `bson:"title" json:"title"`
+    Note         string              `bson:"note,omitempty" json:"note,omitempty"`
+    DueDate      time.Time           `bson:"due_date" json:"due_date"`
+    Status       string              `bson:"status" json:"status"`
+    LeadID       *primitive.ObjectID `bson:"lead_id,omitempty" json:"lead_id,omitempty"`
+    CallID       *primitive.ObjectID `bson:"call_id,omitempty" json:"call_id,omitempty"`
+    ResultCallID *primitive.ObjectID `bson:"result_call_id,omitempty" json:"result_call_id,omitempty"`
+    ResultMeetID *primitive.ObjectID `bson:"result_meet_id,omitempty" json:"result_meet_id,omitempty"`
+    CreatedAt    time.Time           `bson:"created_at" json:"created_at"`
+    CompletedAt  *time.Time          `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+    NotifiedAt   *time.Time          `bson:"notified_at,omitempty" json:"-"`
+}
+
+func (t *Task) Validate() error {
+    t.Title = strings.TrimSpace(t.Title)
+    if t.Title == "" {
+        return errors.New("title is required and cannot be empty")
+    }
+    if t.Type != TaskTypeCall && t.Type != TaskTypeMeet {
+        return errors.New("invalid task type, must be one of: call, meet")
+    }
+    if t.DueDate.IsZero() {
+        return errors.New("due date is required")
+    }
+    return nil
+}
+
+func (t *Task) BeforeCreate() {
+    if t.ID.IsZero() {
+        t.ID = primitive.NewObjectID()
+    }
+    if t.CreatedAt.IsZero() {
+        t.CreatedAt = time.Now()
+    }
+    if t.Status == "" {
+        t.Status = TaskOpen
+    }
+}
+
+// NewFollowUpTask builds the task reminding an agent to call a prospect
+// again after a call ended with a follow_up status.
+func NewFollowUpTask(userID, callID primitive.ObjectID, leadID *primitive.ObjectID, clientName string, due time.Time) *Task {
+    task := &Task{
+        UserID:  userID,
+        Type:    TaskTypeCall,
+        Title:   "Follow up with " + clientName,
+        DueDate: due,
+        LeadID:  leadID,
+        CallID:  &callID,
+    }
+    task.BeforeCreate()
+    return task
+}
+
+func (t *Task) TableName() string {
+    return "tasks"
+}
@@ -12,15 +12,17 @@ const (
 )
 
 type User struct {
-    ID        primitive.ObjectID `bson:"_id,omitempty"`
-    Username  string             `bson:"username" json:"username"`
-    Email     string             `bson:"email" json:"email"`
-    PhoneNum  string             `bson:"phone_num" json:"phone_num"`
-    Password  string             `bson:"password" json:"password"`
-    Image     string             `bson:"image" json:"image"`
-    CreatedAt time.Time          `bson:"created_at" json:"created_at"`
-    LastLogin time.Time          `bson:"last_login,omitempty" json:"last_login"`
-    Role      int                `bson:"role" json:"role"` 
+    ID           primitive.ObjectID `bson:"_id,omitempty"`
+    Username     string             `bson:"username" json:"username"`
+    Email        string             `bson:"email" json:"email"`
+    PhoneNum     string             `bson:"phone_num" json:"phone_num"`
+    Team         string             `bson:"team,omitempty" json:"team,omitempty"`
+    Password     string             `bson:"password" json:"password"`
+    Image        string             `bson:"image" json:"image"`
+    CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+    LastLogin    time.Time          `bson:"last_login,omitempty" json:"last_login"`
+    Role         int                `bson:"role" json:"role"` 
+    DeviceTokens []string           `bson:"device_tokens,omitempty" json:"-"`
 }
 
 func (u *User) IsBFA() bool {
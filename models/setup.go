@@ -2,8 +2,13 @@ package models
 
 import(
 	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os"
 	"time"
+
+	"github.com/Arkariza/API_MyActivity/metrics"
 	"go.mongodb.org/mongo-driver/mongo"
     "go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -16,11 +21,54 @@ const (
     DbName     = "my_activity_api"
 )
 
+const (
+    queryTimeoutEnvKey  = "DB_QUERY_TIMEOUT"
+    defaultQueryTimeout = 10 * time.Second
+
+    // StatusClientClosedRequest is the non-standard status (popularised by
+    // nginx) reported when the client went away before we could answer.
+    StatusClientClosedRequest = 499
+)
+
 var (
     DB     *mongo.Database
     Client *mongo.Client
+
+    QueryTimeout = loadQueryTimeout()
 )
 
+func loadQueryTimeout() time.Duration {
+    value := os.Getenv(queryTimeoutEnvKey)
+    if value == "" {
+        return defaultQueryTimeout
+    }
+    timeout, err := time.ParseDuration(value)
+    if err != nil || timeout <= 0 {
+        log.Printf("Invalid %s %q, using %s", queryTimeoutEnvKey, value, defaultQueryTimeout)
+        return defaultQueryTimeout
+    }
+    return timeout
+}
+
+// QueryContext derives the context for a database call from the incoming
+// request context, so a client disconnect cancels the query and a slow query
+// is abandoned after QueryTimeout.
+func QueryContext(parent context.Context) (context.Context, context.CancelFunc) {
+    return context.WithTimeout(parent, QueryTimeout)
+}
+
+// ErrorStatus maps a database error to the HTTP status to report, turning
+// timeouts into 504 and client cancellations into 499.
+func ErrorStatus(err error, fallback int) int {
+    switch {
+    case errors.Is(err, context.DeadlineExceeded), mongo.IsTimeout(err):
+        return http.StatusGatewayTimeout
+    case errors.Is(err, context.Canceled):
+        return StatusClientClosedRequest
+    }
+    return fallback
+}
+
 func ConnectDatabase() {
     uri := "mongodb://"
     if DbUser != "" && DbPassword != "" {
@@ -28,7 +76,7 @@ func ConnectDatabase() {
     }
     uri += DbHost + ":" + DbPort
 
-    clientOptions := options.Client().ApplyURI(uri)
+    clientOptions := options.Client().ApplyURI(uri).SetMonitor(metrics.CommandMonitor())
 
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/Arkariza/API_MyActivity/models/Notification"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const fcmServerKeyEnvKey = "FCM_SERVER_KEY"
+
+// Notifier stores notifications in the inbox and pushes them to the
+// recipient's registered devices.
+type Notifier struct {
+	collection *mongo.Collection
+	users      *mongo.Collection
+	provider   Provider
+}
+
+func NewNotifier(collection, users *mongo.Collection, provider Provider) *Notifier {
+	return &Notifier{
+		collection: collection,
+		users:      users,
+		provider:   provider,
+	}
+}
+
+// ProviderFromEnv returns the FCM provider when FCM_SERVER_KEY is set and a
+// FakeProvider otherwise.
+func ProviderFromEnv() Provider {
+	if key := os.Getenv(fcmServerKeyEnvKey); key != "" {
+		return NewFCMProvider(key)
+	}
+	log.Printf("%s is not set, push notifications are recorded but not delivered", fcmServerKeyEnvKey)
+	return &FakeProvider{}
+}
+
+// Notify saves the notification and pushes it. A failed push is logged but
+// does not fail the call: the notification is still in the inbox.
+func (n *Notifier) Notify(ctx context.Context, userID primitive.ObjectID, kind, title, body string, data map[string]string) (*models.Notification, error) {
+	notification := models.Notification{
+		UserID: userID,
+		Type:   kind,
+		Title:  title,
+		Body:   body,
+		Data:   data,
+	}
+	notification.BeforeCreate()
+
+	if _, err := n.collection.InsertOne(ctx, notification); err != nil {
+		return nil, err
+	}
+
+	if err := n.push(ctx, userID, Message{Title: title, Body: body, Data: data}); err != nil {
+		log.Printf("Error pushing notification %s: %v", notification.ID.Hex(), err)
+	}
+
+	return &notification, nil
+}
+
+func (n *Notifier) push(ctx context.Context, userID primitive.ObjectID, msg Message) error {
+	var user struct {
+		DeviceTokens []string `bson:"device_tokens"`
+	}
+	err := n.users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		return err
+	}
+	return n.provider.Send(ctx, user.DeviceTokens, msg)
+}
@@ -0,0 +1,108 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+// Provider delivers a push message to a user's devices.
+type Provider interface {
+	Send(ctx context.Context, deviceTokens []string, msg Message) error
+}
+
+const defaultFCMEndpoint = "https://fcm.googleapis.com/fcm/send"
+
+// FCMProvider sends through the Firebase Cloud Messaging HTTP API.
+type FCMProvider struct {
+	ServerKey string
+	Endpoint  string
+	Client    *http.Client
+}
+
+func NewFCMProvider(serverKey string) *FCMProvider {
+	return &FCMProvider{
+		ServerKey: serverKey,
+		Endpoint:  defaultFCMEndpoint,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type fcmRequest struct {
+	RegistrationIDs []string          `json:"registration_ids"`
+	Notification    fcmNotification   `json:"notification"`
+	Data            map[string]string `json:"data,omitempty"`
+}
+
+type fcmNotification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+func (p *FCMProvider) Send(ctx context.Context, deviceTokens []string, msg Message) error {
+	if len(deviceTokens) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(fcmRequest{
+		RegistrationIDs: deviceTokens,
+		Notification:    fcmNotification{Title: msg.Title, Body: msg.Body},
+		Data:            msg.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "key="+p.ServerKey)
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fcm responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type SentMessage struct {
+	DeviceTokens []string
+	Message      Message
+}
+
+// FakeProvider records messages instead of sending them. It is used when no
+// push credentials are configured and in local testing.
+type FakeProvider struct {
+	mu   sync.Mutex
+	sent []SentMessage
+}
+
+func (p *FakeProvider) Send(_ context.Context, deviceTokens []string, msg Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sent = append(p.sent, SentMessage{DeviceTokens: deviceTokens, Message: msg})
+	return nil
+}
+
+func (p *FakeProvider) Sent() []SentMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]SentMessage(nil), p.sent...)
+}
@@ -0,0 +1,86 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"time"
+
+	notificationModels "github.com/Arkariza/API_MyActivity/models/Notification"
+	"github.com/Arkariza/API_MyActivity/models/Task"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RemindDueTasks notifies the owner of every open task that has come due and
+// has not been reminded about yet. A reminder that cannot be saved is
+// released again so that the next run retries it, and the rest of the batch
+// is still sent.
+func (n *Notifier) RemindDueTasks(ctx context.Context, tasks *mongo.Collection) error {
+	filter := bson.M{
+		"status":      models.TaskOpen,
+		"due_date":    bson.M{"$lte": time.Now()},
+		"notified_at": bson.M{"$exists": false},
+	}
+	cursor, err := tasks.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var task models.Task
+		if err := cursor.Decode(&task); err != nil {
+			return err
+		}
+
+		// Claim the task first so that two instances never remind twice.
+		claimedAt := time.Now()
+		claimed, err := tasks.UpdateOne(ctx,
+			bson.M{"_id": task.ID, "notified_at": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"notified_at": claimedAt}},
+		)
+		if err != nil {
+			return err
+		}
+		if claimed.ModifiedCount == 0 {
+			continue
+		}
+
+		_, err = n.Notify(ctx, task.UserID, notificationModels.TypeTaskDue,
+			"Follow-up due", task.Title,
+			map[string]string{"task_id": task.ID.Hex()},
+		)
+		if err != nil {
+			log.Printf("Error reminding about task %s: %v", task.ID.Hex(), err)
+			_, err = tasks.UpdateOne(ctx,
+				bson.M{"_id": task.ID, "notified_at": claimedAt},
+				bson.M{"$unset": bson.M{"notified_at": ""}},
+			)
+			if err != nil {
+				log.Printf("Error releasing reminder for task %s: %v", task.ID.Hex(), err)
+			}
+		}
+	}
+	return cursor.Err()
+}
+
+// StartReminders checks for due tasks every interval until ctx is cancelled.
+func (n *Notifier) StartReminders(ctx context.Context, tasks *mongo.Collection, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runCtx, cancel := context.WithTimeout(ctx, interval)
+				if err := n.RemindDueTasks(runCtx, tasks); err != nil {
+					log.Printf("Error sending task reminders: %v", err)
+				}
+				cancel()
+			}
+		}
+	}()
+}
@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRemindDueTasksContinuesAfterFailure(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("failed reminder is released", func(mt *mtest.T) {
+		failing, sent := primitive.NewObjectID(), primitive.NewObjectID()
+		owner := primitive.NewObjectID()
+		due := primitive.NewDateTimeFromTime(time.Now().Add(-time.Hour))
+		task := func(id primitive.ObjectID, title string) bson.D {
+			return bson.D{{Key: "_id", Value: id}, {Key: "user_id", Value: owner}, {Key: "title", Value: title}, {Key: "status", Value: "open"}, {Key: "due_date", Value: due}}
+		}
+		claim := bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}}
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.tasks", mtest.FirstBatch, task(failing, "Call back"), task(sent, "Send quote")),
+			claim,
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"}),
+			claim,
+			claim,
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateCursorResponse(0, "db.users", mtest.FirstBatch, bson.D{{Key: "_id", Value: owner}, {Key: "device_tokens", Value: bson.A{"device"}}}),
+		)
+
+		provider := &FakeProvider{}
+		notifier := NewNotifier(mt.DB.Collection("notifications"), mt.DB.Collection("users"), provider)
+		if err := notifier.RemindDueTasks(context.Background(), mt.Coll); err != nil {
+			t.Fatalf("RemindDueTasks() = %v", err)
+		}
+
+		messages := provider.Sent()
+		if len(messages) != 1 || messages[0].Message.Body != "Send quote" {
+			t.Fatalf("sent %+v, want only the reminder for the second task", messages)
+		}
+
+		var released bool
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName != "update" {
+				continue
+			}
+			updates, err := event.Command.LookupErr("updates")
+			if err != nil {
+				continue
+			}
+			values, _ := updates.Array().Values()
+			for _, value := range values {
+				update := value.Document()
+				id, _ := update.Lookup("q", "_id").ObjectIDOK()
+				if _, err := update.LookupErr("u", "$unset", "notified_at"); err == nil && id == failing {
+					released = true
+				}
+			}
+		}
+		if !released {
+			t.Error("the failed reminder was not released for a retry")
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package phone
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// DefaultCountryCode is assumed for numbers written without one, which is
+// how Indonesian numbers are usually typed: "0812-3456-7890".
+const DefaultCountryCode = "62"
+
+const (
+	// E.164 allows at most 15 digits including the country code.
+	maxDigits = 15
+	minDigits = 8
+
+	// Indonesian subscriber numbers run from 7 digits for small-town
+	// landlines to 12 for newer mobile numbers, without the trunk 0.
+	minNationalDigits = 7
+	maxNationalDigits = 12
+)
+
+var ErrInvalid = errors.New("invalid phone number")
+
+// Normalize converts a phone number to E.164, "+6281234567890". Spaces,
+// dashes, dots and parentheses are ignored. Numbers with a leading "+" or
+// "00" keep their country code; everything else is read as Indonesian, with
+// or without the trunk 0 or the 62 prefix.
+func Normalize(raw string) (string, error) {
+	number := strings.TrimSpace(raw)
+	international := false
+	switch {
+	case strings.HasPrefix(number, "+"):
+		international = true
+		number = number[1:]
+	case strings.HasPrefix(number, "00"):
+		international = true
+		number = number[2:]
+	}
+
+	var digits strings.Builder
+	for _, r := range number {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", ErrInvalid
+		}
+	}
+	number = digits.String()
+
+	if !international {
+		switch {
+		case strings.HasPrefix(number, "0"):
+			number = DefaultCountryCode + number[1:]
+		case !strings.HasPrefix(number, DefaultCountryCode):
+			number = DefaultCountryCode + number
+		}
+	}
+	// "+62 0812..." keeps the trunk 0 by mistake; it is never dialled.
+	if strings.HasPrefix(number, DefaultCountryCode+"0") {
+		number = DefaultCountryCode + number[len(DefaultCountryCode)+1:]
+	}
+
+	if len(number) < minDigits || len(number) > maxDigits || number[0] == '0' {
+		return "", ErrInvalid
+	}
+	if national, ok := strings.CutPrefix(number, DefaultCountryCode); ok {
+		if len(national) < minNationalDigits || len(national) > maxNationalDigits || national[0] == '0' {
+			return "", ErrInvalid
+		}
+	}
+	return "+" + number, nil
+}
+
+// Valid reports whether raw can be normalized.
+func Valid(raw string) bool {
+	_, err := Normalize(raw)
+	return err == nil
+}
+
+// ValidateField implements the "phone" binding tag for request structs.
+func ValidateField(fl validator.FieldLevel) bool {
+	return Valid(fl.Field().String())
+}
+
+// Format returns the E.164 form of raw, or raw trimmed when it cannot be
+// normalized. Use it on values already checked by the "phone" binding tag.
+func Format(raw string) string {
+	if normalized, err := Normalize(raw); err == nil {
+		return normalized
+	}
+	return strings.TrimSpace(raw)
+}
+
+// SearchDigits turns a search term such as "0812-34" into the digits to look
+// for in stored E.164 numbers, "81234", without the trunk 0 or country code.
+// It returns "" when the term does not look like part of a phone number.
+func SearchDigits(term string) string {
+	var digits strings.Builder
+	for _, r := range strings.TrimSpace(term) {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' || r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return ""
+		}
+	}
+	number := digits.String()
+	switch {
+	case strings.HasPrefix(number, "0"):
+		number = number[1:]
+	case strings.HasPrefix(number, DefaultCountryCode):
+		number = number[len(DefaultCountryCode):]
+	}
+	if len(number) < 3 {
+		return ""
+	}
+	return number
+}
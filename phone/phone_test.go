@@ -0,0 +1,93 @@
+package phone
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		// Indonesian numbers in the usual spellings.
+		{"0812-3456-7890", "+6281234567890"},
+		{"081234567890", "+6281234567890"},
+		{"(021) 555-1234", "+62215551234"},
+		{"0812.3456.7890", "+6281234567890"},
+		{"  0812 3456 7890  ", "+6281234567890"},
+		{"81234567890", "+6281234567890"},
+		{"6281234567890", "+6281234567890"},
+		{"+6281234567890", "+6281234567890"},
+		{"+62 812 3456 7890", "+6281234567890"},
+		// The trunk 0 written after the country code is dropped.
+		{"+62 0812 3456 7890", "+6281234567890"},
+		{"620812 3456 7890", "+6281234567890"},
+		{"0062 0812 3456 7890", "+6281234567890"},
+		// 00 is the international prefix.
+		{"0062 812 3456 7890", "+6281234567890"},
+		{"0044 20 7946 0958", "+442079460958"},
+		{"+1 (415) 555-2671", "+14155552671"},
+		// Shortest and longest Indonesian subscriber numbers.
+		{"021 12345", "+622112345"},
+		{"0812 3456 78901", "+62812345678901"},
+	}
+	for _, tt := range tests {
+		got, err := Normalize(tt.raw)
+		if err != nil || got != tt.want {
+			t.Errorf("Normalize(%q) = %q, %v, want %q", tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizeInvalid(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		"+",
+		"00",
+		"0",
+		"0812-3456-789a",
+		"0812/3456/7890",
+		"+62 812#34567",
+		// Too few or too many subscriber digits.
+		"0812 345",
+		"0812 3456 789012",
+		// Too few or too many digits in all.
+		"+1 234 56",
+		"+1 234 567 890 123 456",
+		// A country code cannot start with 0.
+		"+0812 3456 7890",
+		"0008 1234 5678",
+		// Nor can an Indonesian subscriber number after the trunk 0.
+		"+62 00812 3456 7890",
+	} {
+		if got, err := Normalize(raw); err != ErrInvalid {
+			t.Errorf("Normalize(%q) = %q, %v, want ErrInvalid", raw, got, err)
+		}
+	}
+}
+
+func TestSearchDigits(t *testing.T) {
+	tests := []struct {
+		term string
+		want string
+	}{
+		{"0812-34", "81234"},
+		{"+62 812", "812"},
+		{"62812", "812"},
+		{"(0812)", "812"},
+		{"3456 7890", "34567890"},
+		{" 555.12 ", "55512"},
+		// Too short once the prefix is gone.
+		{"08", ""},
+		{"081", ""},
+		{"6281", ""},
+		{"12", ""},
+		// Not part of a phone number.
+		{"", ""},
+		{"budi", ""},
+		{"0812 budi", ""},
+	}
+	for _, tt := range tests {
+		if got := SearchDigits(tt.term); got != tt.want {
+			t.Errorf("SearchDigits(%q) = %q, want %q", tt.term, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package respond
+
+import "github.com/gin-gonic/gin"
+
+// Error answers with the status and message, adding the error behind it as
+// details when there is one.
+func Error(c *gin.Context, status int, message string, err error) {
+	body := gin.H{"error": message}
+	if err != nil {
+		body["details"] = err.Error()
+	}
+	c.JSON(status, body)
+}
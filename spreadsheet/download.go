@@ -0,0 +1,58 @@
+package spreadsheet
+
+import (
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var extensions = map[string]string{
+	FormatCSV:    ".csv",
+	FormatXLSX:   ".xlsx",
+	FormatNDJSON: ".ndjson",
+}
+
+// Download streams an export as an attachment in the format chosen by the
+// format query parameter, with dates localized per tz and date_format. rows
+// is called once and should pass each row to write as it is read, so that
+// the export is never held in memory as a whole.
+func Download(c *gin.Context, name string, columns []Column, rows func(write func(values []interface{}) error) error) {
+	format, err := ParseFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export format", "details": err.Error()})
+		return
+	}
+	opts, err := ParseOptions(c.Query("tz"), c.Query("date_format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export options", "details": err.Error()})
+		return
+	}
+
+	fileName := name + "-" + time.Now().In(opts.Location).Format("20060102") + extensions[format]
+	c.Header("Content-Type", ContentType(format))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	c.Status(http.StatusOK)
+
+	writer, err := NewWriter(c.Writer, format, columns, opts)
+	if err == nil {
+		if err = rows(writer.Write); err == nil {
+			err = writer.Close()
+		} else if xw, ok := writer.(*xlsxWriter); ok {
+			// Drop the workbook's temporary files without sending it.
+			xw.book.Close()
+		}
+	}
+	if err != nil {
+		// Once rows have been sent the status can no longer change; the
+		// client sees a truncated file and the error is only logged.
+		log.Printf("Error exporting %s: %v", name, err)
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Disposition")
+			c.Writer.Header().Del("Content-Type")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export " + name, "details": err.Error()})
+		}
+	}
+}
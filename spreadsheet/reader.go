@@ -0,0 +1,120 @@
+package spreadsheet
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported file format, expected .csv or .xlsx")
+
+// FormatOf picks the format from the file name's extension.
+func FormatOf(fileName string) (string, error) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".xlsx":
+		return FormatXLSX, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// Table is a sheet read into memory: the header row, and the data rows below
+// it, each padded or cut to the width of the header.
+type Table struct {
+	Header []string
+	Rows   []Row
+}
+
+// Row is a data row. Line is its 1-based line in the file, so that errors can
+// point at the row the user sees in their spreadsheet.
+type Row struct {
+	Line   int
+	Values []string
+}
+
+// Read reads the first sheet of an XLSX workbook, or a CSV file. Blank rows
+// are skipped.
+func Read(r io.Reader, format string) (*Table, error) {
+	var records [][]string
+	switch format {
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		var err error
+		if records, err = reader.ReadAll(); err != nil {
+			return nil, fmt.Errorf("read csv: %w", err)
+		}
+	case FormatXLSX:
+		book, err := excelize.OpenReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("read xlsx: %w", err)
+		}
+		defer book.Close()
+		sheets := book.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, errors.New("read xlsx: workbook has no sheets")
+		}
+		if records, err = book.GetRows(sheets[0]); err != nil {
+			return nil, fmt.Errorf("read xlsx: %w", err)
+		}
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	table := &Table{}
+	for i, record := range records {
+		if blank(record) {
+			continue
+		}
+		if table.Header == nil {
+			table.Header = make([]string, len(record))
+			for j, name := range record {
+				// Strip the byte order mark Excel puts in front of UTF-8 CSVs.
+				table.Header[j] = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+			}
+			continue
+		}
+		values := make([]string, len(table.Header))
+		for j := range values {
+			if j < len(record) {
+				values[j] = strings.TrimSpace(record[j])
+			}
+		}
+		table.Rows = append(table.Rows, Row{Line: i + 1, Values: values})
+	}
+	if table.Header == nil {
+		return nil, errors.New("file has no header row")
+	}
+	return table, nil
+}
+
+// Column returns the index of the header named name, ignoring case, or -1.
+func (t *Table) Column(name string) int {
+	for i, header := range t.Header {
+		if strings.EqualFold(header, strings.TrimSpace(name)) {
+			return i
+		}
+	}
+	return -1
+}
+
+func blank(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,271 @@
+package spreadsheet
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	FormatNDJSON = "ndjson"
+
+	defaultTimeZone = "Asia/Jakarta"
+	flushEvery      = 100
+
+	// formulaPrefixes are the characters that make a spreadsheet read a
+	// cell as a formula.
+	formulaPrefixes = "=+-@\t\r"
+)
+
+// dateLayouts are the date styles an export can be asked for; "id" matches
+// what Indonesian spreadsheets expect.
+var dateLayouts = map[string]string{
+	"iso": "2006-01-02 15:04",
+	"id":  "02/01/2006 15:04",
+	"us":  "01/02/2006 15:04",
+}
+
+// Column is one exported field: Key names it in NDJSON, Title heads the
+// column in CSV and XLSX.
+type Column struct {
+	Key   string
+	Title string
+}
+
+// Options controls how dates are written.
+type Options struct {
+	Location   *time.Location
+	DateLayout string
+}
+
+// ParseOptions reads the tz and date_format query values, defaulting to
+// Jakarta time in ISO order.
+func ParseOptions(timeZone, dateFormat string) (Options, error) {
+	if timeZone == "" {
+		timeZone = defaultTimeZone
+	}
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return Options{}, fmt.Errorf("unknown time zone %q", timeZone)
+	}
+	if dateFormat == "" {
+		dateFormat = "iso"
+	}
+	layout, ok := dateLayouts[dateFormat]
+	if !ok {
+		return Options{}, fmt.Errorf("unknown date_format %q, expected iso, id or us", dateFormat)
+	}
+	return Options{Location: location, DateLayout: layout}, nil
+}
+
+// ParseFormat validates an export format name.
+func ParseFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case FormatCSV, "":
+		return FormatCSV, nil
+	case FormatXLSX:
+		return FormatXLSX, nil
+	case FormatNDJSON, "jsonl":
+		return FormatNDJSON, nil
+	}
+	return "", fmt.Errorf("unsupported format %q, expected csv, xlsx or ndjson", format)
+}
+
+func ContentType(format string) string {
+	switch format {
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Writer writes export rows one at a time. Values are written in column
+// order; time.Time and *time.Time values are localized per Options. CSV and
+// XLSX cells whose text would start a formula are escaped with a quote.
+type Writer interface {
+	Write(values []interface{}) error
+	Close() error
+}
+
+func NewWriter(w io.Writer, format string, columns []Column, opts Options) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, columns, opts)
+	case FormatXLSX:
+		return newXLSXWriter(w, columns, opts)
+	case FormatNDJSON:
+		return &ndjsonWriter{out: bufio.NewWriter(w), flusher: flusherOf(w), columns: columns, opts: opts}, nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// formatValue localizes dates; text formats get them as strings so that
+// spreadsheets do not reinterpret them in the viewer's own time zone.
+func (o Options) formatValue(value interface{}, layout string) interface{} {
+	switch v := value.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.In(o.Location).Format(layout)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return o.formatValue(*v, layout)
+	}
+	return value
+}
+
+// escapeFormula prefixes text that a spreadsheet would run as a formula with
+// a quote, so that user-entered text such as "=HYPERLINK(...)" stays text.
+// Numbers are left alone: a negative coordinate is not a formula.
+func escapeFormula(value interface{}) interface{} {
+	if value == nil || reflect.TypeOf(value).Kind() != reflect.String {
+		return value
+	}
+	text := reflect.ValueOf(value).String()
+	if text != "" && strings.ContainsRune(formulaPrefixes, rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+func flusherOf(w io.Writer) http.Flusher {
+	flusher, _ := w.(http.Flusher)
+	return flusher
+}
+
+type csvWriter struct {
+	out     *csv.Writer
+	flusher http.Flusher
+	opts    Options
+	rows    int
+}
+
+func newCSVWriter(w io.Writer, columns []Column, opts Options) (*csvWriter, error) {
+	writer := &csvWriter{out: csv.NewWriter(w), flusher: flusherOf(w), opts: opts}
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Title
+	}
+	return writer, writer.out.Write(header)
+}
+
+func (cw *csvWriter) Write(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = fmt.Sprint(escapeFormula(cw.opts.formatValue(value, cw.opts.DateLayout)))
+	}
+	if err := cw.out.Write(record); err != nil {
+		return err
+	}
+	cw.rows++
+	if cw.rows%flushEvery == 0 {
+		cw.out.Flush()
+		if cw.flusher != nil {
+			cw.flusher.Flush()
+		}
+	}
+	return cw.out.Error()
+}
+
+func (cw *csvWriter) Close() error {
+	cw.out.Flush()
+	return cw.out.Error()
+}
+
+// xlsxWriter uses excelize's stream writer, which spills rows to a temporary
+// file instead of holding the sheet in memory. The workbook is a zip whose
+// directory comes last, so nothing is sent until Close.
+type xlsxWriter struct {
+	out    io.Writer
+	book   *excelize.File
+	stream *excelize.StreamWriter
+	opts   Options
+	row    int
+}
+
+func newXLSXWriter(w io.Writer, columns []Column, opts Options) (*xlsxWriter, error) {
+	book := excelize.NewFile()
+	stream, err := book.NewStreamWriter(book.GetSheetName(0))
+	if err != nil {
+		book.Close()
+		return nil, err
+	}
+	writer := &xlsxWriter{out: w, book: book, stream: stream, opts: opts, row: 1}
+
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column.Title
+	}
+	return writer, writer.Write(header)
+}
+
+func (xw *xlsxWriter) Write(values []interface{}) error {
+	cells := make([]interface{}, len(values))
+	for i, value := range values {
+		cells[i] = escapeFormula(xw.opts.formatValue(value, xw.opts.DateLayout))
+	}
+	cell, err := excelize.CoordinatesToCellName(1, xw.row)
+	if err != nil {
+		return err
+	}
+	xw.row++
+	return xw.stream.SetRow(cell, cells)
+}
+
+func (xw *xlsxWriter) Close() error {
+	defer xw.book.Close()
+	if err := xw.stream.Flush(); err != nil {
+		return err
+	}
+	return xw.book.Write(xw.out)
+}
+
+type ndjsonWriter struct {
+	out     *bufio.Writer
+	flusher http.Flusher
+	columns []Column
+	opts    Options
+	rows    int
+}
+
+func (nw *ndjsonWriter) Write(values []interface{}) error {
+	record := make(map[string]interface{}, len(values))
+	for i, value := range values {
+		record[nw.columns[i].Key] = nw.opts.formatValue(value, time.RFC3339)
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := nw.out.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	nw.rows++
+	if nw.rows%flushEvery == 0 {
+		if err := nw.out.Flush(); err != nil {
+			return err
+		}
+		if nw.flusher != nil {
+			nw.flusher.Flush()
+		}
+	}
+	return nil
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nw.out.Flush()
+}
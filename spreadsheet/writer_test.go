@@ -0,0 +1,50 @@
+package spreadsheet
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriterEscapesFormulas(t *testing.T) {
+	type status string
+	columns := []Column{
+		{Key: "formula", Title: "Formula"},
+		{Key: "plus", Title: "Plus"},
+		{Key: "minus", Title: "Minus"},
+		{Key: "at", Title: "At"},
+		{Key: "typed", Title: "Typed"},
+		{Key: "text", Title: "Text"},
+		{Key: "latitude", Title: "Latitude"},
+	}
+	values := []interface{}{`=HYPERLINK("http://x","y")`, "+62811", "-1 fee", "@SUM(A1)", status("=1+1"), "Budi", -6.2}
+	want := []string{`'=HYPERLINK("http://x","y")`, "'+62811", "'-1 fee", "'@SUM(A1)", "'=1+1", "Budi", "-6.2"}
+
+	for _, format := range []string{FormatCSV, FormatXLSX} {
+		t.Run(format, func(t *testing.T) {
+			var out bytes.Buffer
+			writer, err := NewWriter(&out, format, columns, Options{Location: time.UTC, DateLayout: dateLayouts["iso"]})
+			if err != nil {
+				t.Fatalf("NewWriter() error = %v", err)
+			}
+			if err := writer.Write(values); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			table, err := Read(&out, format)
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if len(table.Rows) != 1 {
+				t.Fatalf("read %d rows, want 1", len(table.Rows))
+			}
+			if got := table.Rows[0].Values; !reflect.DeepEqual(got, want) {
+				t.Fatalf("row = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LocalDisk stores objects as files below Root.
+type LocalDisk struct {
+	Root string
+}
+
+func NewLocalDisk(root string) (*LocalDisk, error) {
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, fmt.Errorf("create storage root: %w", err)
+	}
+	return &LocalDisk{Root: root}, nil
+}
+
+// path maps a key to a file below Root, refusing keys that would escape it.
+func (d *LocalDisk) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(d.Root, filepath.FromSlash(clean)), nil
+}
+
+// Put writes to a temporary file first so that a failed or cancelled upload
+// never leaves a partial object under its final name.
+func (d *LocalDisk) Put(ctx context.Context, key string, r io.Reader) error {
+	target, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, contextReader{ctx: ctx, r: r}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+func (d *LocalDisk) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	target, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+func (d *LocalDisk) Delete(ctx context.Context, key string) error {
+	target, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// contextReader stops a copy once the request that feeds it is gone.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
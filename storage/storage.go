@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+const attachmentsDirEnvKey = "ATTACHMENTS_DIR"
+
+var ErrNotFound = errors.New("stored object not found")
+
+// Storage keeps uploaded file contents. Keys are slash separated paths such
+// as "meet/<meet id>/<attachment id>"; metadata lives in MongoDB.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// FromEnv returns local disk storage rooted at ATTACHMENTS_DIR, or at
+// ./uploads when it is not set.
+func FromEnv() (Storage, error) {
+	root := os.Getenv(attachmentsDirEnvKey)
+	if root == "" {
+		root = "uploads"
+	}
+	return NewLocalDisk(root)
+}
@@ -0,0 +1,93 @@
+package tombstone
+
+import (
+	"context"
+	"log"
+	"time"
+
+	database "github.com/Arkariza/API_MyActivity/models"
+	models "github.com/Arkariza/API_MyActivity/models/Sync"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	Deleted    = models.ReasonDeleted
+	Reassigned = models.ReasonReassigned
+)
+
+// Store keeps the removals the sync endpoint reports. Records are deleted
+// outright, so this is the only trace a device can learn of them from.
+type Store struct {
+	collection *mongo.Collection
+}
+
+func NewStore(collection *mongo.Collection) *Store {
+	return &Store{collection: collection}
+}
+
+// Default is the store Record writes to. Until it is set, removals are not
+// recorded.
+var Default *Store
+
+// Record notes on the default store that the entity was removed from owner's
+// view for the given reason.
+func Record(entity string, entityID, owner primitive.ObjectID, reason string) {
+	if Default == nil {
+		return
+	}
+	Default.Record(entity, entityID, owner, reason)
+}
+
+// RecordAll notes on the default store that each of the entities was removed
+// from owner's view for the given reason.
+func RecordAll(entity string, entityIDs []primitive.ObjectID, owner primitive.ObjectID, reason string) {
+	if Default == nil {
+		return
+	}
+	Default.RecordAll(entity, entityIDs, owner, reason)
+}
+
+// Record writes the tombstone synchronously. The removal is already saved, so
+// a failure is logged rather than failing the request, and the write is not
+// tied to the client's connection.
+func (s *Store) Record(entity string, entityID, owner primitive.ObjectID, reason string) {
+	ctx, cancel := database.QueryContext(context.Background())
+	defer cancel()
+	_, err := s.collection.InsertOne(ctx, models.Tombstone{
+		ID:        primitive.NewObjectID(),
+		Entity:    entity,
+		EntityID:  entityID,
+		OwnerID:   owner,
+		Reason:    reason,
+		RemovedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error recording %s of %s %s for sync: %v", reason, entity, entityID.Hex(), err)
+	}
+}
+
+// RecordAll writes the tombstones for several entities at once, the same way
+// as Record.
+func (s *Store) RecordAll(entity string, entityIDs []primitive.ObjectID, owner primitive.ObjectID, reason string) {
+	if len(entityIDs) == 0 {
+		return
+	}
+	ctx, cancel := database.QueryContext(context.Background())
+	defer cancel()
+	now := time.Now()
+	tombstones := make([]interface{}, len(entityIDs))
+	for i, id := range entityIDs {
+		tombstones[i] = models.Tombstone{
+			ID:        primitive.NewObjectID(),
+			Entity:    entity,
+			EntityID:  id,
+			OwnerID:   owner,
+			Reason:    reason,
+			RemovedAt: now,
+		}
+	}
+	if _, err := s.collection.InsertMany(ctx, tombstones); err != nil {
+		log.Printf("Error recording %s of %d %ss for sync: %v", reason, len(entityIDs), entity, err)
+	}
+}